@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/quota"
+	"github.com/rss-creator/storage"
+	"github.com/rss-creator/utils"
+)
+
+// AdminController manages other users' accounts. Every route must be wrapped
+// with the Admin policy.
+type AdminController interface {
+	GetUsers(w http.ResponseWriter, r *http.Request)
+	PutUser(w http.ResponseWriter, r *http.Request)
+	DeleteUser(w http.ResponseWriter, r *http.Request)
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type adminController struct {
+	db    storage.DB
+	plans quota.Plans
+}
+
+// accessRequest changes a user's role or plan, or disables their account.
+// Fields that are left out keep their current value.
+type accessRequest struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+	Plan     *string `json:"plan"`
+}
+
+func NewAdminController(db storage.DB, plans quota.Plans) AdminController {
+	return &adminController{db, plans}
+}
+
+// GetUsers lists users a page at a time, optionally filtered by username
+// prefix, email domain and creation time, and sorted by any of
+// storage.UserSorts.
+func (a *adminController) GetUsers(w http.ResponseWriter, r *http.Request) {
+	query := models.UserQuery{Count: defaultPageSize}
+	err := utils.ParseArgs(r, &query)
+	if err != nil {
+		utils.SendError(w, fmt.Sprintf("Invalid query, %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if query.Offset < 0 || query.Count < 1 || query.Count > maxPageSize {
+		utils.SendError(w, fmt.Sprintf("Offset must not be negative and count must be between 1 and %v", maxPageSize), http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := storage.UserSorts[strings.TrimPrefix(query.Sort, "-")]; query.Sort != "" && !ok {
+		utils.SendError(w, "Sort must be one of 'username', 'email' or 'created', optionally prefixed with '-'", http.StatusBadRequest)
+		return
+	}
+
+	count := query.Count
+	// fetching one extra user tells us whether there is another page
+	query.Count++
+	users, err := a.db.GetUsers(&query)
+	if err != nil {
+		log.Printf("could not get users from the database\n%v", err)
+		utils.SendError(w, "Error getting users from database", http.StatusInternalServerError)
+		return
+	}
+
+	more := len(users) > count
+	if more {
+		users = users[:count]
+	}
+
+	for _, user := range users {
+		user.Password = ""
+	}
+
+	utils.SendPage(w, r, users, query.Offset+count, count, more)
+}
+
+// PutUser changes a user's role or plan, or disables their account. Changing
+// their access revokes every token and API key issued to them so far, so the
+// change applies everywhere at once.
+func (a *adminController) PutUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	var req accessRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Printf("could not unmarshal PutUser request body\n%v", err)
+		utils.SendError(w, "Could not parse body as JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role != nil && *req.Role != models.UserRole && *req.Role != models.AdminRole {
+		utils.SendError(w, fmt.Sprintf("Role must be '%v' or '%v'", models.UserRole, models.AdminRole), http.StatusBadRequest)
+		return
+	}
+
+	if req.Plan != nil && !a.plans.Exists(*req.Plan) {
+		utils.SendError(w, fmt.Sprintf("Unknown plan %v", *req.Plan), http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.db.GetUser(username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("User %v not found", username), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not get user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
+		return
+	}
+
+	role, disabled := user.Role, user.Disabled
+	if req.Role != nil {
+		role = *req.Role
+	}
+	if req.Disabled != nil {
+		disabled = *req.Disabled
+	}
+
+	// stops the last admin from locking everyone out
+	if username == Principal(r).Username && (role != models.AdminRole || disabled) {
+		utils.SendError(w, "Admins cannot demote or disable themselves", http.StatusBadRequest)
+		return
+	}
+
+	if role != user.Role || disabled != user.Disabled {
+		err = a.db.UpdateUserAccess(username, role, disabled)
+		if err == nil {
+			err = a.db.RevokeAllTokens(username)
+		}
+		if storage.IsNotFound(err) {
+			utils.SendError(w, fmt.Sprintf("User %v not found", username), http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("could not update access of user %v\n%v", username, err)
+			utils.SendError(w, "Error updating user", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.Plan != nil && *req.Plan != user.Plan {
+		err = a.db.UpdateUserPlan(username, *req.Plan)
+		if storage.IsNotFound(err) {
+			utils.SendError(w, fmt.Sprintf("User %v not found", username), http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("could not update plan of user %v\n%v", username, err)
+			utils.SendError(w, "Error updating user", http.StatusInternalServerError)
+			return
+		}
+		user.Plan = *req.Plan
+	}
+
+	user.Password = ""
+	user.Role = role
+	user.Disabled = disabled
+
+	utils.SendSuccess(w, user, http.StatusOK)
+}
+
+func (a *adminController) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	err := a.db.DeleteUser(username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("User %v not found", username), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not delete user %v\n%v", username, err)
+		utils.SendError(w, "Error deleting user", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+// getUsers lists users as the admin, returning the page and the link to the
+// next one.
+func (s *testServer) getUsers(accessToken string, query string) ([]models.User, string) {
+	w := s.do(http.MethodGet, "/v1/admin/users?"+query, bearer(accessToken), "", nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("listing users with %q returned %v %v", query, w.Code, w.Body)
+	}
+
+	var page struct {
+		NextLink string
+		Data     []models.User
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		s.t.Fatalf("could not decode users: %v", err)
+	}
+	return page.Data, page.NextLink
+}
+
+func usernames(users []models.User) []string {
+	names := []string{}
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	return names
+}
+
+func TestAdminGetUsersPaging(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.createAdmin("root")
+	for _, username := range []string{"carol", "alice", "bob"} {
+		s.createUser(username)
+	}
+
+	users, next := s.getUsers(admin.AccessToken, "count=2")
+	if got := usernames(users); len(got) != 2 || got[0] != "alice" || got[1] != "bob" {
+		t.Errorf("first page is %v, want alice and bob", got)
+	}
+	for _, u := range users {
+		if u.Password != "" {
+			t.Errorf("user %v is listed with their password hash", u.Username)
+		}
+	}
+
+	link, err := url.Parse(next)
+	if err != nil || link.Query().Get("offset") != "2" || link.Query().Get("count") != "2" {
+		t.Fatalf("next link is %q, want the next two users", next)
+	}
+	users, next = s.getUsers(admin.AccessToken, link.RawQuery)
+	if got := usernames(users); len(got) != 2 || got[0] != "carol" || got[1] != "root" {
+		t.Errorf("second page is %v, want carol and root", got)
+	}
+	if next != "" {
+		t.Errorf("last page links to %v, want no next page", next)
+	}
+}
+
+func TestAdminGetUsersFilters(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.createAdmin("root")
+	for _, username := range []string{"alice", "albert", "bob"} {
+		s.createUser(username)
+	}
+
+	future := url.QueryEscape(time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	for query, want := range map[string][]string{
+		"username=al":                     {"albert", "alice"},
+		"username=al&sort=-username":      {"alice", "albert"},
+		"emailDomain=example.com":         {"albert", "alice", "bob", "root"},
+		"emailDomain=EXAMPLE.COM&count=1": {"albert"},
+		"emailDomain=ample.com":           {},
+		"createdBefore=" + future:         {"albert", "alice", "bob", "root"},
+		"createdAfter=" + future:          {},
+	} {
+		users, _ := s.getUsers(admin.AccessToken, query)
+		if got := usernames(users); !reflect.DeepEqual(got, want) {
+			t.Errorf("listing users with %q gave %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestAdminGetUsersInvalid(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.createAdmin("root")
+
+	for _, query := range []string{"count=0", "count=201", "offset=-1", "sort=password", "createdAfter=yesterday"} {
+		if w := s.do(http.MethodGet, "/v1/admin/users?"+query, bearer(admin.AccessToken), "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("listing users with %q returned %v, want 400", query, w.Code)
+		}
+	}
+
+	s.createUser("alice")
+	login := s.login("alice", nil)
+	if w := s.do(http.MethodGet, "/v1/admin/users", bearer(login.AccessToken), "", nil); w.Code != http.StatusForbidden {
+		t.Errorf("listing users as a user returned %v, want 403", w.Code)
+	}
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+	"github.com/rss-creator/utils"
+)
+
+const (
+	// APIKeyPrefix starts every API key, so keys can be told apart from JWTs
+	// and found by secret scanners
+	APIKeyPrefix = "rssk_"
+
+	apiKeyNameMaxLength = 128
+	// lastUsedResolution limits how often using a key writes to the database
+	lastUsedResolution = time.Minute
+)
+
+type apiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Expires is optional, keys without it never expire
+	Expires time.Time `json:"expires"`
+}
+
+// PostAPIKey mints a new API key. The key is only ever returned in this
+// response, since only its hash is stored.
+func (a *authController) PostAPIKey(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	var req apiKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Printf("could not unmarshal PostAPIKey request body\n%v", err)
+		utils.SendError(w, "Could not parse body as JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" || len(req.Name) > apiKeyNameMaxLength {
+		utils.SendError(w, fmt.Sprintf("Name of at most %v characters required", apiKeyNameMaxLength), http.StatusBadRequest)
+		return
+	}
+
+	// keys default to the scopes of the token creating them, and cannot be
+	// granted any more than that
+	principal := Principal(r)
+	if len(req.Scopes) == 0 {
+		req.Scopes = grantedScopes(principal)
+	}
+	for _, scope := range req.Scopes {
+		if !contains(allScopes, scope) {
+			utils.SendError(w, fmt.Sprintf("Invalid scope '%v'", scope), http.StatusBadRequest)
+			return
+		} else if !principal.HasScope(scope) {
+			utils.SendError(w, fmt.Sprintf("Token does not grant the '%v' scope", scope), http.StatusForbidden)
+			return
+		}
+	}
+
+	now := time.Now()
+	if !req.Expires.IsZero() && !req.Expires.After(now) {
+		utils.SendError(w, "Expiry must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	id, secret, err := newAPIKeySecret()
+	if err != nil {
+		log.Printf("could not generate api key\n%v", err)
+		utils.SendError(w, "Error generating API key", http.StatusInternalServerError)
+		return
+	}
+
+	key := models.APIKey{
+		ID:      id,
+		Owner:   username,
+		Name:    req.Name,
+		Scopes:  req.Scopes,
+		Hash:    hashToken(secret),
+		Created: now.UTC().Truncate(time.Second),
+		Expires: req.Expires,
+	}
+
+	err = a.db.CreateAPIKey(&key)
+	if err != nil {
+		log.Printf("could not insert api key %v into database\n%v", id, err)
+		utils.SendError(w, "Error inserting API key into database", http.StatusInternalServerError)
+		return
+	}
+
+	key.Key = APIKeyPrefix + id + "_" + secret
+	utils.SendSuccess(w, key, http.StatusCreated)
+}
+
+func (a *authController) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := a.db.GetAPIKeys(username)
+	if err != nil {
+		log.Printf("could not get api keys of user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting API keys from database", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, keys, http.StatusOK)
+}
+
+func (a *authController) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	username := vars["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	id := vars["id"]
+	err := a.db.DeleteAPIKey(username, id)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("API key %v not found", id), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not delete api key %v\n%v", id, err)
+		utils.SendError(w, "Error deleting API key", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+// validateAPIKey checks the key's secret and expiry, and returns claims
+// equivalent to an access token for the key's owner with the key's scopes.
+func (a *authController) validateAPIKey(apiKey string) (*TokenClaims, error) {
+	invalid := &tokenError{"Invalid API key", http.StatusUnauthorized}
+
+	parts := strings.SplitN(strings.TrimPrefix(apiKey, APIKeyPrefix), "_", 2)
+	if len(parts) != 2 {
+		return nil, invalid
+	}
+	id, secret := parts[0], parts[1]
+
+	key, err := a.db.GetAPIKey(id)
+	if storage.IsNotFound(err) {
+		return nil, invalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	// a key without scopes would otherwise be read as granting all of them
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(key.Hash)) != 1 || len(key.Scopes) == 0 {
+		return nil, invalid
+	}
+
+	now := time.Now()
+	if !key.Expires.IsZero() && now.After(key.Expires) {
+		return nil, &tokenError{"API key has expired", http.StatusUnauthorized}
+	}
+
+	owner, err := a.db.GetUser(key.Owner)
+	if storage.IsNotFound(err) {
+		return nil, invalid
+	} else if err != nil {
+		return nil, err
+	} else if owner.Disabled {
+		return nil, errAccountDisabled
+	}
+
+	if now.Sub(key.LastUsed) >= lastUsedResolution {
+		// a failure to record use should not lock the key out
+		a.db.UpdateAPIKeyLastUsed(id, now)
+	}
+
+	claims := &TokenClaims{
+		Type:     AccessTokenType,
+		Username: key.Owner,
+		Role:     owner.Role,
+		Scope:    strings.Join(key.Scopes, " "),
+		StandardClaims: jwt.StandardClaims{
+			Id:       key.ID,
+			IssuedAt: key.Created.Unix(),
+		},
+	}
+	if !key.Expires.IsZero() {
+		claims.ExpiresAt = key.Expires.Unix()
+	}
+	return claims, nil
+}
+
+// newAPIKeySecret generates the public id and the secret of a new key.
+func newAPIKeySecret() (string, string, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(id), hex.EncodeToString(secret), nil
+}
+
+// getAPIKey reads an API key from an "ApiKey" Authorization header, or from a
+// bearer token with the key prefix, since some clients only send bearer tokens.
+func getAPIKey(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "ApiKey ") {
+		return strings.TrimPrefix(authorization, "ApiKey ")
+	}
+
+	if bearer := strings.TrimPrefix(authorization, "Bearer "); strings.HasPrefix(bearer, APIKeyPrefix) {
+		return bearer
+	}
+	return ""
+}
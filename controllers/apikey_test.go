@@ -0,0 +1,226 @@
+package controllers_test
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	var key models.APIKey
+	w := s.do(http.MethodPost, "/v1/users/alice/keys", bearer(login.AccessToken), `{"name": "reader"}`, &key)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("creating a key returned %v %v", w.Code, w.Body)
+	}
+	if !strings.HasPrefix(key.Key, "rssk_") {
+		t.Fatalf("created key %q, want the rssk_ prefix", key.Key)
+	}
+	apiKey := map[string]string{"Authorization": "ApiKey " + key.Key}
+
+	if w := s.do(http.MethodGet, "/v1/users/alice", apiKey, "", nil); w.Code != http.StatusOK {
+		t.Errorf("getting alice with her key returned %v %v", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice", bearer(key.Key), "", nil); w.Code != http.StatusOK {
+		t.Errorf("getting alice with her key as a bearer token returned %v %v", w.Code, w.Body)
+	}
+
+	// keys stand in for access tokens, not refresh tokens
+	if w := s.do(http.MethodGet, "/v1/users/alice/token", apiKey, "", nil); w.Code == http.StatusOK {
+		t.Errorf("exchanging a key for tokens succeeded")
+	}
+
+	wrongSecret := map[string]string{"Authorization": "ApiKey " + key.Key + "0"}
+	if w := s.do(http.MethodGet, "/v1/users/alice", wrongSecret, "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("key with a wrong secret returned %v %v, want 401", w.Code, w.Body)
+	}
+
+	// only the hash is kept, so the key is never shown again
+	var keys []models.APIKey
+	if w := s.do(http.MethodGet, "/v1/users/alice/keys", bearer(login.AccessToken), "", &keys); w.Code != http.StatusOK {
+		t.Fatalf("listing keys returned %v %v", w.Code, w.Body)
+	}
+	if len(keys) != 1 || keys[0].ID != key.ID || keys[0].Key != "" {
+		t.Errorf("listed keys %+v, want only %v without its secret", keys, key.ID)
+	}
+
+	if w := s.do(http.MethodDelete, "/v1/users/alice/keys/"+key.ID, bearer(login.AccessToken), "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("deleting the key returned %v %v", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice", apiKey, "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("deleted key returned %v %v, want 401", w.Code, w.Body)
+	}
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	w := s.do(http.MethodPost, "/v1/users/alice/keys", bearer(login.AccessToken), `{"name": "expired", "expires": "`+past+`"}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("creating an expired key returned %v %v, want 400", w.Code, w.Body)
+	}
+
+	var key models.APIKey
+	soon := time.Now().Add(2 * time.Second).UTC().Format(time.RFC3339)
+	w = s.do(http.MethodPost, "/v1/users/alice/keys", bearer(login.AccessToken), `{"name": "short lived", "expires": "`+soon+`"}`, &key)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("creating a short lived key returned %v %v", w.Code, w.Body)
+	}
+
+	apiKey := map[string]string{"Authorization": "ApiKey " + key.Key}
+	if w := s.do(http.MethodGet, "/v1/users/alice", apiKey, "", nil); w.Code != http.StatusOK {
+		t.Errorf("key before its expiry returned %v %v", w.Code, w.Body)
+	}
+	time.Sleep(time.Until(key.Expires) + time.Second)
+	if w := s.do(http.MethodGet, "/v1/users/alice", apiKey, "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("key after its expiry returned %v %v, want 401", w.Code, w.Body)
+	}
+}
+
+func TestAPIKeyRevocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(t *testing.T, s *testServer, login tokens)
+	}{
+		{"revoking all tokens", func(t *testing.T, s *testServer, login tokens) {
+			if w := s.do(http.MethodDelete, "/v1/users/alice/tokens", bearer(login.AccessToken), "", nil); w.Code != http.StatusNoContent {
+				t.Fatalf("revoking all tokens returned %v %v", w.Code, w.Body)
+			}
+		}},
+		{"changing the role", func(t *testing.T, s *testServer, login tokens) {
+			admin := s.createAdmin("root")
+			w := s.do(http.MethodPut, "/v1/admin/users/alice", bearer(admin.AccessToken), `{"role": "admin"}`, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("promoting alice returned %v %v", w.Code, w.Body)
+			}
+		}},
+		{"disabling the account", func(t *testing.T, s *testServer, login tokens) {
+			admin := s.createAdmin("root")
+			for _, disabled := range []string{"true", "false"} {
+				w := s.do(http.MethodPut, "/v1/admin/users/alice", bearer(admin.AccessToken), `{"disabled": `+disabled+`}`, nil)
+				if w.Code != http.StatusOK {
+					t.Fatalf("setting alice disabled to %v returned %v %v", disabled, w.Code, w.Body)
+				}
+			}
+		}},
+		{"resetting the password", func(t *testing.T, s *testServer, login tokens) {
+			if w := s.do(http.MethodPost, "/v1/password/forgot", nil, `{"username": "alice"}`, nil); w.Code != http.StatusAccepted {
+				t.Fatalf("asking for a password reset returned %v %v", w.Code, w.Body)
+			}
+			body := `{"token": "` + s.mailedToken("/reset-password") + `", "password": "battery staple"}`
+			if w := s.do(http.MethodPost, "/v1/password/reset", nil, body, nil); w.Code != http.StatusNoContent {
+				t.Fatalf("resetting the password returned %v %v", w.Code, w.Body)
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.createUser("alice")
+			login := s.login("alice", nil)
+
+			var key models.APIKey
+			w := s.do(http.MethodPost, "/v1/users/alice/keys", bearer(login.AccessToken), `{"name": "reader"}`, &key)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("creating a key returned %v %v", w.Code, w.Body)
+			}
+
+			test.revoke(t, s, login)
+			apiKey := map[string]string{"Authorization": "ApiKey " + key.Key}
+			if w := s.do(http.MethodGet, "/v1/users/alice", apiKey, "", nil); w.Code != http.StatusUnauthorized {
+				t.Errorf("key after %v returned %v %v, want 401", test.name, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	s.createUser("bob")
+	login := s.login("alice", nil)
+
+	var key models.APIKey
+	w := s.do(http.MethodPost, "/v1/users/alice/keys", bearer(login.AccessToken), `{"name": "reader", "scopes": ["feeds:read"]}`, &key)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("creating a key returned %v %v", w.Code, w.Body)
+	}
+	apiKey := map[string]string{"Authorization": "ApiKey " + key.Key}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{http.MethodGet, "/v1/users/alice/feeds", "", http.StatusOK},
+		{http.MethodGet, "/v1/users/alice", "", http.StatusOK},
+		{http.MethodGet, "/v1/users/alice/usage", "", http.StatusOK},
+		{http.MethodPost, "/v1/users/alice/feeds", `{"title": "Feed"}`, http.StatusForbidden},
+		{http.MethodGet, "/v1/scraper/website?url=http://localhost", "", http.StatusForbidden},
+		{http.MethodPut, "/v1/users/alice", `{"email": "mallory@example.com"}`, http.StatusForbidden},
+		{http.MethodDelete, "/v1/users/alice", "", http.StatusForbidden},
+		{http.MethodPost, "/v1/users/alice/keys", `{"name": "escalated"}`, http.StatusForbidden},
+		{http.MethodGet, "/v1/users/bob/feeds", "", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		if w := s.do(test.method, test.path, apiKey, test.body, nil); w.Code != test.want {
+			t.Errorf("%v %v with a feeds:read key returned %v %v, want %v", test.method, test.path, w.Code, w.Body, test.want)
+		}
+	}
+
+	// the same key presented as a bearer token is limited the same way
+	if w := s.do(http.MethodPost, "/v1/users/alice/feeds", bearer(key.Key), `{"title": "Feed"}`, nil); w.Code != http.StatusForbidden {
+		t.Errorf("creating a feed with a feeds:read bearer key returned %v %v, want 403", w.Code, w.Body)
+	}
+}
+
+func TestAPIKeyScopesLimitedByToken(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+
+	var narrow tokens
+	w := s.do(http.MethodGet, "/v1/users/alice/authorize?scope=account:admin", withPassword(nil), "", &narrow)
+	if w.Code != http.StatusOK {
+		t.Fatalf("signing in with the account:admin scope returned %v %v", w.Code, w.Body)
+	}
+
+	// keys cannot be granted scopes the token creating them lacks
+	w = s.do(http.MethodPost, "/v1/users/alice/keys", bearer(narrow.AccessToken), `{"name": "writer", "scopes": ["feeds:write"]}`, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("creating a key with a scope the token lacks returned %v %v, want 403", w.Code, w.Body)
+	}
+
+	w = s.do(http.MethodPost, "/v1/users/alice/keys", bearer(narrow.AccessToken), `{"name": "unknown", "scopes": ["feeds:everything"]}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("creating a key with an unknown scope returned %v %v, want 400", w.Code, w.Body)
+	}
+
+	// and default to the token's scopes
+	var key models.APIKey
+	w = s.do(http.MethodPost, "/v1/users/alice/keys", bearer(narrow.AccessToken), `{"name": "admin"}`, &key)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("creating a key without scopes returned %v %v", w.Code, w.Body)
+	}
+	if want := []string{"account:admin"}; !reflect.DeepEqual(key.Scopes, want) {
+		t.Errorf("key created without scopes has scopes %q, want %q", key.Scopes, want)
+	}
+
+	apiKey := map[string]string{"Authorization": "ApiKey " + key.Key}
+	if w := s.do(http.MethodGet, "/v1/users/alice/feeds", apiKey, "", nil); w.Code != http.StatusForbidden {
+		t.Errorf("reading feeds with an account:admin key returned %v %v, want 403", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice/keys", apiKey, "", nil); w.Code != http.StatusOK {
+		t.Errorf("listing keys with an account:admin key returned %v %v", w.Code, w.Body)
+	}
+}
@@ -1,6 +1,10 @@
 package controllers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,6 +15,8 @@ import (
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/rss-creator/keys"
+	"github.com/rss-creator/models"
 	"github.com/rss-creator/storage"
 	"github.com/rss-creator/utils"
 )
@@ -28,12 +34,29 @@ type handler func(w http.ResponseWriter, r *http.Request)
 type AuthController interface {
 	GetRefreshToken(w http.ResponseWriter, r *http.Request)
 	GetAuthToken(w http.ResponseWriter, r *http.Request)
-	Wrapper(tokenType string, h handler) handler
+	PostRevokeToken(w http.ResponseWriter, r *http.Request)
+	DeleteTokens(w http.ResponseWriter, r *http.Request)
+	GetJWKS(w http.ResponseWriter, r *http.Request)
+	PostAPIKey(w http.ResponseWriter, r *http.Request)
+	GetAPIKeys(w http.ResponseWriter, r *http.Request)
+	DeleteAPIKey(w http.ResponseWriter, r *http.Request)
+	PostTOTP(w http.ResponseWriter, r *http.Request)
+	PostTOTPVerify(w http.ResponseWriter, r *http.Request)
+	DeleteTOTP(w http.ResponseWriter, r *http.Request)
+	GetOIDCLogin(w http.ResponseWriter, r *http.Request)
+	PostOIDCCallback(w http.ResponseWriter, r *http.Request)
+	PostOIDCSecondFactor(w http.ResponseWriter, r *http.Request)
+	PostIdentity(w http.ResponseWriter, r *http.Request)
+	GetIdentities(w http.ResponseWriter, r *http.Request)
+	DeleteIdentity(w http.ResponseWriter, r *http.Request)
+	Wrapper(tokenType string, scope string, policy Policy, h handler) handler
 }
 
 type authController struct {
-	db        storage.DB
-	jwtSecret string
+	db   storage.DB
+	keys *keys.KeySet
+	// oidc is nil when OpenID Connect login is not configured
+	oidc *OIDCProvider
 }
 
 type tokens struct {
@@ -41,14 +64,49 @@ type tokens struct {
 	AccessToken  string `json:"accessToken"`
 }
 
+type revokeRequest struct {
+	Token string `json:"token"`
+}
+
+// TokenClaims are carried by every issued token. The standard Id claim (jti)
+// identifies the token in the revocation list, and Generation must match the
+// user's current token generation, which is bumped to revoke every token at
+// once. Family is shared by every token descended from the same login through
+// refresh token rotation. Role is the user's role when the token was issued,
+// and is replaced with their current role when the token is validated. Scope
+// is the space separated list of scopes the token grants.
 type TokenClaims struct {
-	Type     string `json:"type"`
-	Username string `json:"username"`
+	Type       string `json:"type"`
+	Username   string `json:"username"`
+	Role       string `json:"role,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	Generation int    `json:"gen"`
+	Family     string `json:"fam,omitempty"`
 	jwt.StandardClaims
 }
 
-func NewAuthController(db storage.DB, jwtSecret string) AuthController {
-	return &authController{db, jwtSecret}
+// tokenError is a token validation failure that is the client's fault, as
+// opposed to a failure to reach the database.
+type tokenError struct {
+	message string
+	status  int
+}
+
+func (err *tokenError) Error() string {
+	return err.message
+}
+
+var (
+	// errTokenRevoked is for tokens revoked individually or with their
+	// family, and errTokensRevoked for those revoked along with every other
+	// token of their user
+	errTokenRevoked    = &tokenError{"Token has been revoked", http.StatusUnauthorized}
+	errTokensRevoked   = &tokenError{"Token has been revoked", http.StatusUnauthorized}
+	errAccountDisabled = &tokenError{"Account is disabled", http.StatusForbidden}
+)
+
+func NewAuthController(db storage.DB, keySet *keys.KeySet, oidcProvider *OIDCProvider) AuthController {
+	return &authController{db, keySet, oidcProvider}
 }
 
 func (a *authController) GetRefreshToken(w http.ResponseWriter, r *http.Request) {
@@ -64,59 +122,106 @@ func (a *authController) GetRefreshToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := a.db.GetUser(username)
-	if storage.IsNotFound(err) {
-		utils.SendError(w, fmt.Sprintf("User %v not found", username), http.StatusNotFound)
+	scopes, err := parseScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		utils.SendError(w, fmt.Sprintf("Invalid scope, %v", err), http.StatusBadRequest)
 		return
-	} else if err != nil {
+	}
+
+	attempt, wait, err := a.reserveLoginAttempt(username, clientIP(r), passwordFailure)
+	if err != nil {
+		log.Printf("could not check login failures of user %v\n%v", username, err)
+		utils.SendError(w, "Error checking login attempts", http.StatusInternalServerError)
+		return
+	} else if wait > 0 {
+		w.Header().Set("Retry-After", retryAfter(wait))
+		utils.SendError(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	defer attempt.finish()
+
+	user, err := a.db.GetUser(username)
+	if err != nil && !storage.IsNotFound(err) {
 		log.Printf("could not get user %v from the database\n%v", username, err)
 		utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
 		return
 	}
 
-	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
-		utils.SendError(w, "Password incorrect", http.StatusUnauthorized)
+	hash := dummyPasswordHash
+	if user != nil {
+		hash = user.Password
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil || user == nil {
+		if err := attempt.fail(passwordFailure); err != nil {
+			log.Printf("could not record login failure of user %v\n%v", username, err)
+		}
+		utils.SendError(w, invalidCredentials, http.StatusUnauthorized)
 		return
 	}
 
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-		"exp":      time.Now().Add(refreshExpiryTime).Unix(),
-		"type":     RefreshTokenType,
-		"username": username,
-	}).SignedString([]byte(a.jwtSecret))
-	if err != nil {
-		log.Printf("could not generate refresh token\n%v", err)
-		utils.SendError(w, "Error generating token", http.StatusInternalServerError)
+	if user.Disabled {
+		sendTokenError(w, errAccountDisabled)
 		return
 	}
 
-	accessToken, err := a.getAccessToken(username)
-	if err != nil {
-		log.Printf("could not generate access token\n%v", err)
-		utils.SendError(w, "Error generating token", http.StatusInternalServerError)
+	enrollment, err := a.db.GetTOTP(username)
+	if err != nil && !storage.IsNotFound(err) {
+		log.Printf("could not get totp of user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
 		return
 	}
 
-	t := tokens{
-		RefreshToken: refreshToken,
-		AccessToken:  accessToken,
+	if err == nil && enrollment.Enabled {
+		code := r.Header.Get("Otp")
+		if code == "" {
+			utils.SendError(w, "Otp header required", http.StatusUnauthorized)
+			return
+		}
+
+		ok, err := a.checkSecondFactor(enrollment, code)
+		if err != nil {
+			log.Printf("could not check second factor of user %v\n%v", username, err)
+			utils.SendError(w, "Error checking code", http.StatusInternalServerError)
+			return
+		} else if !ok {
+			if err := attempt.fail(otpFailure); err != nil {
+				log.Printf("could not record login failure of user %v\n%v", username, err)
+			}
+			utils.SendError(w, "Code incorrect", http.StatusUnauthorized)
+			return
+		}
 	}
 
-	utils.SendSuccess(w, t, http.StatusOK)
+	err = a.db.ClearLoginFailures(username)
+	if err != nil {
+		log.Printf("could not clear login failures of user %v\n%v", username, err)
+	}
 
-	err = a.db.UpdateTokenValidity(username, true)
+	family, err := newTokenID()
 	if err != nil {
-		log.Printf("could not set user token validity to valid\n%v", err)
+		log.Printf("could not generate token family\n%v", err)
+		utils.SendError(w, "Error generating token", http.StatusInternalServerError)
+		return
 	}
-}
 
-func (a *authController) GetAuthToken(w http.ResponseWriter, r *http.Request) {
-	var bearerToken string
-	bearerTokens, ok := r.Header["Authorization"]
-	if ok && len(bearerTokens) >= 1 {
-		bearerToken = strings.TrimPrefix(bearerTokens[0], "Bearer ")
+	t, err := a.issueTokens(user, family, strings.Join(scopes, " "))
+	if err != nil {
+		log.Printf("could not generate tokens\n%v", err)
+		utils.SendError(w, "Error generating token", http.StatusInternalServerError)
+		return
 	}
 
+	utils.SendSuccess(w, t, http.StatusOK)
+}
+
+// GetAuthToken exchanges a refresh token for a new access and refresh token
+// pair, revoking the refresh token that was presented. Presenting a refresh
+// token that has already been exchanged means it has leaked, so every token
+// descended from the same login is revoked. The new tokens keep the refresh
+// token's scopes, or can be narrowed to some of them with the scope parameter.
+func (a *authController) GetAuthToken(w http.ResponseWriter, r *http.Request) {
+	bearerToken := getBearerToken(r)
 	if bearerToken == "" {
 		utils.SendError(w, "Bearer token required", http.StatusUnauthorized)
 		return
@@ -128,6 +233,44 @@ func (a *authController) GetAuthToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	claims, err := a.parseToken(bearerToken, RefreshTokenType)
+	if err != nil {
+		sendTokenError(w, err)
+		return
+	}
+
+	if claims.Username != username {
+		utils.SendError(w, "Token was not issued to this user", http.StatusForbidden)
+		return
+	}
+
+	// a refresh token that was revoked on its own has been exchanged before,
+	// while one revoked along with the rest of the user's tokens may not have
+	err = a.checkRevocation(claims)
+	if err == errTokenRevoked && claims.Family != "" {
+		a.rejectReuse(w, claims)
+		return
+	} else if err != nil {
+		sendTokenError(w, err)
+		return
+	}
+
+	scopes := grantedScopes(claims)
+	if scope := r.URL.Query().Get("scope"); scope != "" {
+		requested, err := parseScope(scope)
+		if err != nil {
+			utils.SendError(w, fmt.Sprintf("Invalid scope, %v", err), http.StatusBadRequest)
+			return
+		}
+		for _, s := range requested {
+			if !claims.HasScope(s) {
+				utils.SendError(w, fmt.Sprintf("Refresh token does not grant the '%v' scope", s), http.StatusForbidden)
+				return
+			}
+		}
+		scopes = requested
+	}
+
 	user, err := a.db.GetUser(username)
 	if storage.IsNotFound(err) {
 		utils.SendError(w, fmt.Sprintf("User %v not found", username), http.StatusNotFound)
@@ -138,78 +281,313 @@ func (a *authController) GetAuthToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if user.InvalidatedTokens {
-		utils.SendError(w, "Refresh token has been invalidated", http.StatusUnauthorized)
+	// revoking is what claims the token, so of concurrent requests presenting
+	// it only the first is issued new tokens and the rest count as reuse
+	revoked, err := a.db.RevokeToken(claims.Id, username, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		log.Printf("could not revoke rotated refresh token %v\n%v", claims.Id, err)
+		utils.SendError(w, "Error rotating refresh token", http.StatusInternalServerError)
+		return
+	} else if !revoked {
+		a.rejectReuse(w, claims)
 		return
 	}
 
-	if err := a.validateAccessToken(bearerToken, user.Username, RefreshTokenType); err != nil {
-		utils.SendError(w, err.Error(), http.StatusBadRequest)
-		return
+	family := claims.Family
+	if family == "" {
+		// tokens issued before rotation existed start a family when first used
+		if family, err = newTokenID(); err != nil {
+			log.Printf("could not generate token family\n%v", err)
+			utils.SendError(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	accessToken, err := a.getAccessToken(username)
+	t, err := a.issueTokens(user, family, strings.Join(scopes, " "))
 	if err != nil {
-		log.Printf("could not generate access token\n%v", err)
+		log.Printf("could not generate tokens\n%v", err)
 		utils.SendError(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	utils.SendSuccess(w, tokens{AccessToken: accessToken}, http.StatusOK)
+	utils.SendSuccess(w, t, http.StatusOK)
+}
+
+// rejectReuse answers a refresh token that has already been exchanged, which
+// means it has leaked, by revoking every token of its family.
+func (a *authController) rejectReuse(w http.ResponseWriter, claims *TokenClaims) {
+	if claims.Family != "" {
+		log.Printf("refresh token %v of user %v reused, revoking family %v", claims.Id, claims.Username, claims.Family)
+		err := a.db.RevokeTokenFamily(claims.Family, claims.Username, time.Now().Add(refreshExpiryTime))
+		if err != nil {
+			log.Printf("could not revoke token family %v\n%v", claims.Family, err)
+		}
+	}
+	utils.SendError(w, "Refresh token has already been used", http.StatusUnauthorized)
+}
+
+// PostRevokeToken adds a single token, of either type, to the revocation list.
+// Tokens that have already expired are accepted and ignored.
+func (a *authController) PostRevokeToken(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	var req revokeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Token == "" {
+		utils.SendError(w, "Body with token required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := jwt.ParseWithClaims(req.Token, &TokenClaims{}, a.keyFunc)
+	if verr, ok := err.(*jwt.ValidationError); ok && verr.Errors == jwt.ValidationErrorExpired {
+		utils.SendSuccess(w, nil, http.StatusNoContent)
+		return
+	} else if err != nil {
+		utils.SendError(w, "Invalid token", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := token.Claims.(*TokenClaims)
+	if !ok || claims.Id == "" {
+		utils.SendError(w, "Invalid token", http.StatusBadRequest)
+		return
+	}
+
+	if claims.Username != username {
+		utils.SendError(w, "Token was not issued to this user", http.StatusForbidden)
+		return
+	}
+
+	_, err = a.db.RevokeToken(claims.Id, username, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		log.Printf("could not revoke token %v\n%v", claims.Id, err)
+		utils.SendError(w, "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
 }
 
-func (a *authController) Wrapper(tokenType string, h handler) handler {
+// DeleteTokens revokes every token issued to the user so far, and deletes
+// their API keys.
+func (a *authController) DeleteTokens(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	err := a.db.RevokeAllTokens(username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("User %v not found", username), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not revoke tokens of user %v\n%v", username, err)
+		utils.SendError(w, "Error revoking tokens", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+// GetJWKS publishes the public signing keys so other services can verify our
+// tokens without sharing a secret
+func (a *authController) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(a.keys.JWKS())
+	if err != nil {
+		log.Printf("could not marshal signing keys\n%v", err)
+		utils.SendError(w, "Could not get signing keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	utils.SendRaw(w, "application/jwk-set+json", body, http.StatusOK)
+}
+
+// Wrapper only calls h once the request carries a valid token of the given
+// type, or an API key in place of an access token, that grants the scope and
+// that the policy allows. An empty scope is granted by every token. The
+// token's claims are available to h through Principal.
+func (a *authController) Wrapper(tokenType string, scope string, policy Policy, h handler) handler {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var bearerToken string
-		bearerTokens, ok := r.Header["Authorization"]
-		if ok && len(bearerTokens) >= 1 {
-			bearerToken = strings.TrimPrefix(bearerTokens[0], "Bearer ")
+		apiKey := getAPIKey(r)
+		bearerToken := getBearerToken(r)
+		if apiKey == "" && bearerToken == "" {
+			utils.SendError(w, "Bearer token or API key required", http.StatusUnauthorized)
+			return
 		}
 
-		if bearerToken == "" {
-			utils.SendError(w, "Bearer token required", http.StatusUnauthorized)
+		var claims *TokenClaims
+		var err error
+		if apiKey == "" {
+			claims, err = a.validateAccessToken(bearerToken, tokenType)
+		} else if tokenType != AccessTokenType {
+			err = &tokenError{"API keys can only be used in place of access tokens", http.StatusBadRequest}
+		} else {
+			claims, err = a.validateAPIKey(apiKey)
+		}
+		if err != nil {
+			sendTokenError(w, err)
 			return
 		}
 
-		username := mux.Vars(r)["username"]
-		if username == "" {
-			utils.SendError(w, "Username required", http.StatusBadRequest)
+		if scope != AnyScope && !claims.HasScope(scope) {
+			utils.SendError(w, fmt.Sprintf("Token does not grant the '%v' scope", scope), http.StatusForbidden)
 			return
 		}
 
-		err := a.validateAccessToken(bearerToken, username, tokenType)
-		if err != nil {
-			utils.SendError(w, err.Error(), http.StatusBadRequest)
+		if !policy(claims, r) {
+			utils.SendError(w, "Not allowed to access this resource", http.StatusForbidden)
 			return
 		}
 
-		h(w, r)
-		return
+		h(w, withPrincipal(r, claims))
 	}
 }
 
-func (a *authController) validateAccessToken(token string, username string, tokenType string) error {
-	refreshToken, err := jwt.ParseWithClaims(token, &TokenClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(a.jwtSecret), nil
-		},
-	)
+// validateAccessToken checks the token's signature, expiry and type, and that
+// it has not been revoked.
+func (a *authController) validateAccessToken(token string, tokenType string) (*TokenClaims, error) {
+	claims, err := a.parseToken(token, tokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.checkRevocation(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
 
-	if claims, ok := refreshToken.Claims.(*TokenClaims); ok && refreshToken.Valid && err == nil {
-		if claims.Type != tokenType {
-			return fmt.Errorf("Invalid token provided, '%v' token expected, got token with type '%v'", tokenType, claims.Type)
+// parseToken checks the token's signature, expiry and type.
+func (a *authController) parseToken(token string, tokenType string) (*TokenClaims, error) {
+	parsed, err := jwt.ParseWithClaims(token, &TokenClaims{}, a.keyFunc)
+	if err != nil || !parsed.Valid {
+		return nil, &tokenError{"Invalid token", http.StatusBadRequest}
+	}
+
+	claims, ok := parsed.Claims.(*TokenClaims)
+	if !ok {
+		return nil, &tokenError{"Invalid token", http.StatusBadRequest}
+	}
+
+	if claims.Type != tokenType {
+		return nil, &tokenError{
+			fmt.Sprintf("Invalid token provided, '%v' token expected, got token with type '%v'", tokenType, claims.Type),
+			http.StatusBadRequest,
 		}
-	} else {
-		return fmt.Errorf("Invalid token")
 	}
 
+	return claims, nil
+}
+
+// checkRevocation checks that the token has not been revoked individually, as
+// part of its family, or by revoking all of the user's tokens, and that the
+// user's account has not been disabled since. The claimed role is replaced with
+// the user's current role.
+func (a *authController) checkRevocation(claims *TokenClaims) error {
+	revoked, err := a.db.IsTokenRevoked(claims.Id, claims.Family)
+	if err != nil {
+		return err
+	}
+
+	user, err := a.db.GetUser(claims.Username)
+	if storage.IsNotFound(err) {
+		return &tokenError{"Token user no longer exists", http.StatusUnauthorized}
+	} else if err != nil {
+		return err
+	}
+
+	if claims.Generation < user.TokenGeneration {
+		return errTokensRevoked
+	} else if revoked {
+		return errTokenRevoked
+	}
+
+	if user.Disabled {
+		return errAccountDisabled
+	}
+
+	claims.Role = user.Role
 	return nil
 }
 
-func (a *authController) getAccessToken(username string) (string, error) {
-	return jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-		"exp":      time.Now().Add(accessExpiryTime).Unix(),
-		"type":     AccessTokenType,
-		"username": username,
-	}).SignedString([]byte(a.jwtSecret))
+func (a *authController) keyFunc(token *jwt.Token) (interface{}, error) {
+	return a.keys.KeyFunc(token)
+}
+
+// issueTokens creates an access and refresh token pair belonging to the given
+// token family and granting the given scopes.
+func (a *authController) issueTokens(user *models.User, family string, scope string) (tokens, error) {
+	refreshToken, err := a.newToken(user, family, scope, RefreshTokenType, refreshExpiryTime)
+	if err != nil {
+		return tokens{}, err
+	}
+
+	accessToken, err := a.newToken(user, family, scope, AccessTokenType, accessExpiryTime)
+	if err != nil {
+		return tokens{}, err
+	}
+
+	return tokens{RefreshToken: refreshToken, AccessToken: accessToken}, nil
+}
+
+func (a *authController) newToken(user *models.User, family string, scope string, tokenType string, expiry time.Duration) (string, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return a.keys.Sign(TokenClaims{
+		Type:       tokenType,
+		Username:   user.Username,
+		Role:       user.Role,
+		Scope:      scope,
+		Generation: user.TokenGeneration,
+		Family:     family,
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(expiry).Unix(),
+		},
+	})
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken hashes a secret we generated for storage. Unlike passwords such
+// secrets are random, so a fast hash is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func getBearerToken(r *http.Request) string {
+	bearerTokens, ok := r.Header["Authorization"]
+	if ok && len(bearerTokens) >= 1 {
+		return strings.TrimPrefix(bearerTokens[0], "Bearer ")
+	}
+	return ""
+}
+
+func sendTokenError(w http.ResponseWriter, err error) {
+	if terr, ok := err.(*tokenError); ok {
+		utils.SendError(w, terr.message, terr.status)
+		return
+	}
+
+	log.Printf("could not validate token\n%v", err)
+	utils.SendError(w, "Error validating token", http.StatusInternalServerError)
 }
@@ -0,0 +1,188 @@
+package controllers_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	var rotated tokens
+	w := s.do(http.MethodGet, "/v1/users/alice/token", bearer(login.RefreshToken), "", &rotated)
+	if w.Code != http.StatusOK {
+		t.Fatalf("exchanging a refresh token returned %v %v", w.Code, w.Body)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatalf("exchanging a refresh token returned refresh token %q, want a new one", rotated.RefreshToken)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice", bearer(rotated.AccessToken), "", nil); w.Code != http.StatusOK {
+		t.Errorf("rotated access token returned %v %v", w.Code, w.Body)
+	}
+
+	// presenting the exchanged token again means it leaked, so the whole
+	// family is revoked, including the tokens it was exchanged for
+	w = s.do(http.MethodGet, "/v1/users/alice/token", bearer(login.RefreshToken), "", nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("reusing a refresh token returned %v %v, want 401", w.Code, w.Body)
+	} else if got, want := s.errorMessage(w), "Refresh token has already been used"; got != want {
+		t.Errorf("reused refresh token was rejected with %q, want %q", got, want)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice/token", bearer(rotated.RefreshToken), "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token of a revoked family returned %v %v, want 401", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice", bearer(rotated.AccessToken), "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token of a revoked family returned %v %v, want 401", w.Code, w.Body)
+	}
+
+	// other logins are not affected
+	other := s.login("alice", nil)
+	if w := s.do(http.MethodGet, "/v1/users/alice/token", bearer(other.RefreshToken), "", nil); w.Code != http.StatusOK {
+		t.Errorf("refresh token of another login returned %v %v", w.Code, w.Body)
+	}
+}
+
+func TestRevokedRefreshTokenNotReuse(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	if w := s.do(http.MethodDelete, "/v1/users/alice/tokens", bearer(login.AccessToken), "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("revoking all tokens returned %v %v", w.Code, w.Body)
+	}
+
+	// the token was never exchanged, so it is only revoked, not reused
+	w := s.do(http.MethodGet, "/v1/users/alice/token", bearer(login.RefreshToken), "", nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked refresh token returned %v %v, want 401", w.Code, w.Body)
+	}
+	if got, want := s.errorMessage(w), "Token has been revoked"; got != want {
+		t.Errorf("revoked refresh token was rejected with %q, want %q", got, want)
+	}
+}
+
+func TestConcurrentRefreshTokenReuse(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	const attempts = 20
+	codes := make([]int, attempts)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = s.do(http.MethodGet, "/v1/users/alice/token", bearer(login.RefreshToken), "", nil).Code
+		}(i)
+	}
+	wg.Wait()
+
+	exchanged := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			exchanged++
+		case http.StatusUnauthorized:
+		default:
+			t.Errorf("concurrent exchange returned %v", code)
+		}
+	}
+	if exchanged != 1 {
+		t.Errorf("refresh token was exchanged %v times concurrently, want once", exchanged)
+	}
+
+	// the losing requests count as reuse, so the winner's tokens are revoked
+	// along with the rest of the family
+	if w := s.do(http.MethodGet, "/v1/users/alice", bearer(login.AccessToken), "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token of a reused family returned %v %v, want 401", w.Code, w.Body)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	s.createUser("bob")
+
+	wrong := map[string]string{"Password": "wrong password"}
+	for i := 0; i < 5; i++ {
+		if w := s.do(http.MethodGet, "/v1/users/alice/authorize", wrong, "", nil); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %v returned %v %v, want 401", i+1, w.Code, w.Body)
+		}
+	}
+
+	// once the free failures are used up even the right password has to wait
+	w := s.do(http.MethodGet, "/v1/users/alice/authorize", withPassword(nil), "", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("login after 5 failures returned %v %v, want 429", w.Code, w.Body)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("locked out login has no Retry-After header")
+	}
+
+	// unknown users are throttled the same way, so they cannot be told apart
+	for i := 0; i < 5; i++ {
+		s.do(http.MethodGet, "/v1/users/nobody/authorize", wrong, "", nil)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/nobody/authorize", wrong, "", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("login of an unknown user after 5 failures returned %v %v, want 429", w.Code, w.Body)
+	}
+
+	s.login("bob", nil)
+}
+
+func TestConcurrentLoginLockout(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+
+	// the free failures were used up long enough ago for one more attempt
+	for i := 0; i < 5; i++ {
+		failure := &models.LoginFailure{Username: "alice", IP: "192.0.2.1", Reason: "password", Attempted: time.Now().Add(-time.Hour)}
+		if _, err := s.db.ReserveLoginFailure(failure, time.Now().Add(-24*time.Hour)); err != nil {
+			t.Fatalf("could not record login failure: %v", err)
+		}
+	}
+
+	// parallel guesses cannot all be checked before any of them fails
+	codes := make(chan int, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- s.do(http.MethodGet, "/v1/users/alice/authorize", map[string]string{"Password": "wrong password"}, "", nil).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	checked := 0
+	for code := range codes {
+		switch code {
+		case http.StatusUnauthorized:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("parallel guess returned %v, want 401 or 429", code)
+		}
+	}
+	if checked != 1 {
+		t.Errorf("%v parallel guesses were checked, want 1", checked)
+	}
+}
+
+func TestLoginSuccessesNotCounted(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+
+	// more than the failures an IP is allowed
+	for i := 0; i < 25; i++ {
+		s.login("alice", nil)
+	}
+}
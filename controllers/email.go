@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rss-creator/mail"
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+	"github.com/rss-creator/utils"
+)
+
+const (
+	verifyEmailExpiryTime   = time.Hour * 24
+	resetPasswordExpiryTime = time.Hour
+)
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type forgotPasswordRequest struct {
+	Username string `json:"username"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// PostEmailVerification sends the user a new verification email.
+func (u *userController) PostEmailVerification(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := u.db.GetUser(username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("User %v not found", username), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not get user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
+		return
+	}
+
+	if user.Email == "" {
+		utils.SendError(w, "User has no email address", http.StatusBadRequest)
+		return
+	}
+
+	if user.EmailVerified {
+		utils.SendError(w, "Email address is already verified", http.StatusConflict)
+		return
+	}
+
+	err = u.sendVerification(user)
+	if err != nil {
+		log.Printf("could not send verification email to user %v\n%v", username, err)
+		utils.SendError(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusAccepted)
+}
+
+// PostVerifyEmail consumes a token from a verification email.
+func (u *userController) PostVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Token == "" {
+		utils.SendError(w, "Body with token required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := u.db.ConsumeUserToken(hashToken(req.Token), models.VerifyEmailPurpose)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("could not consume email verification token\n%v", err)
+		utils.SendError(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+
+	err = u.db.VerifyEmail(token.Username, token.Email)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, "Email address has changed since the token was sent", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("could not verify email of user %v\n%v", token.Username, err)
+		utils.SendError(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+// PostForgotPassword emails the user a password reset link. It responds the
+// same way whether or not the user exists, so it cannot be used to find
+// accounts.
+func (u *userController) PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Username == "" {
+		utils.SendError(w, "Body with username required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := u.db.GetUser(req.Username)
+	if err == nil && user.Email != "" {
+		err = u.sendPasswordReset(user)
+	}
+	if err != nil && !storage.IsNotFound(err) {
+		log.Printf("could not send password reset to user %v\n%v", req.Username, err)
+	}
+
+	utils.SendSuccess(w, nil, http.StatusAccepted)
+}
+
+// PostResetPassword sets a new password using a token from a password reset
+// email, and revokes every token and API key issued with the old password.
+func (u *userController) PostResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Token == "" {
+		utils.SendError(w, "Body with token and password required", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Password) < passMinLength {
+		utils.SendError(w, fmt.Sprintf("Password must be at least %v characters", passMinLength), http.StatusBadRequest)
+		return
+	}
+
+	token, err := u.db.ConsumeUserToken(hashToken(req.Token), models.ResetPasswordPurpose)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("could not consume password reset token\n%v", err)
+		utils.SendError(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	password, err := hashAndSalt(req.Password)
+	if err != nil {
+		log.Printf("could not hash password\n%v", err)
+		utils.SendError(w, "Could not hash password", http.StatusInternalServerError)
+		return
+	}
+
+	err = u.db.UpdateUser(token.Username, &models.User{Password: password})
+	if err == nil {
+		err = u.db.RevokeAllTokens(token.Username)
+	}
+	if storage.IsNotFound(err) {
+		utils.SendError(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("could not reset password of user %v\n%v", token.Username, err)
+		utils.SendError(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+func (u *userController) sendVerification(user *models.User) error {
+	link, err := u.newEmailLink(user, models.VerifyEmailPurpose, verifyEmailExpiryTime, "/verify-email")
+	if err != nil {
+		return err
+	}
+
+	sendMail(u.mailer, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %v,\n\nOpen the link below within 24 hours to verify your email address.\n\n%v\n\n"+
+			"If you did not create an account you can ignore this email.\n", user.Username, link),
+	})
+	return nil
+}
+
+func (u *userController) sendPasswordReset(user *models.User) error {
+	link, err := u.newEmailLink(user, models.ResetPasswordPurpose, resetPasswordExpiryTime, "/reset-password")
+	if err != nil {
+		return err
+	}
+
+	sendMail(u.mailer, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %v,\n\nOpen the link below within an hour to choose a new password.\n\n%v\n\n"+
+			"If you did not ask to reset your password you can ignore this email.\n", user.Username, link),
+	})
+	return nil
+}
+
+// newEmailLink stores a new single use token and returns the link to the given
+// page of the web app that will submit it.
+func (u *userController) newEmailLink(user *models.User, purpose string, expiry time.Duration, page string) (string, error) {
+	token, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	err = u.db.CreateUserToken(&models.UserToken{
+		Hash:     hashToken(token),
+		Username: user.Username,
+		Purpose:  purpose,
+		Email:    user.Email,
+		Expires:  time.Now().Add(expiry),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return u.appURL + page + "?token=" + url.QueryEscape(token), nil
+}
+
+// sendMail delivers the message in the background, so that slow mail servers
+// do not hold up requests and response times do not reveal which users exist.
+func sendMail(mailer mail.Mailer, msg mail.Message) {
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			log.Printf("could not send %q to %v\n%v", msg.Subject, msg.To, err)
+		}
+	}()
+}
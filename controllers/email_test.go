@@ -0,0 +1,110 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	// signing up mails a verification link
+	body := `{"token": "` + s.mailedToken("/verify-email") + `"}`
+	if w := s.do(http.MethodPost, "/v1/email/verify", nil, body, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("verifying the email returned %v %v", w.Code, w.Body)
+	}
+	user, err := s.db.GetUser("alice")
+	if err != nil {
+		t.Fatalf("could not get user: %v", err)
+	}
+	if !user.EmailVerified {
+		t.Errorf("email is not verified after following the link")
+	}
+
+	if w := s.do(http.MethodPost, "/v1/email/verify", nil, body, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("verifying with a used token returned %v, want 400", w.Code)
+	}
+	if w := s.do(http.MethodPost, "/v1/users/alice/email/verification", bearer(login.AccessToken), "", nil); w.Code != http.StatusConflict {
+		t.Errorf("asking to verify a verified email returned %v, want 409", w.Code)
+	}
+}
+
+func TestVerifyEmailChanged(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+	old := s.mailedToken("/verify-email")
+
+	body := `{"password": "` + testPassword + `", "email": "alice@example.org"}`
+	if w := s.do(http.MethodPut, "/v1/users/alice", bearer(login.AccessToken), body, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("changing the email returned %v %v", w.Code, w.Body)
+	}
+
+	// a link sent to the old address cannot verify the new one
+	if w := s.do(http.MethodPost, "/v1/email/verify", nil, `{"token": "`+old+`"}`, nil); w.Code != http.StatusConflict {
+		t.Errorf("verifying with a link to the old address returned %v, want 409", w.Code)
+	}
+	user, err := s.db.GetUser("alice")
+	if err != nil {
+		t.Fatalf("could not get user: %v", err)
+	}
+	if user.Email != "alice@example.org" || user.EmailVerified {
+		t.Errorf("user has email %v verified %v, want the new email unverified", user.Email, user.EmailVerified)
+	}
+
+	// while the link mailed to the new address can
+	token := s.mailedToken("/verify-email")
+	for deadline := time.Now().Add(5 * time.Second); token == old && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		token = s.mailedToken("/verify-email")
+	}
+	if w := s.do(http.MethodPost, "/v1/email/verify", nil, `{"token": "`+token+`"}`, nil); w.Code != http.StatusNoContent {
+		t.Errorf("verifying with a link to the new address returned %v %v", w.Code, w.Body)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+
+	if w := s.do(http.MethodPost, "/v1/password/forgot", nil, `{"username": "alice"}`, nil); w.Code != http.StatusAccepted {
+		t.Fatalf("asking for a password reset returned %v %v", w.Code, w.Body)
+	}
+	token := s.mailedToken("/reset-password")
+
+	short := `{"token": "` + token + `", "password": "short"}`
+	if w := s.do(http.MethodPost, "/v1/password/reset", nil, short, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("resetting to a short password returned %v, want 400", w.Code)
+	}
+	wrong := `{"token": "not a token", "password": "battery staple"}`
+	if w := s.do(http.MethodPost, "/v1/password/reset", nil, wrong, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("resetting with an invalid token returned %v, want 400", w.Code)
+	}
+
+	body := `{"token": "` + token + `", "password": "battery staple"}`
+	if w := s.do(http.MethodPost, "/v1/password/reset", nil, body, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("resetting the password returned %v %v", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodPost, "/v1/password/reset", nil, body, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("resetting with a used token returned %v, want 400", w.Code)
+	}
+
+	if w := s.do(http.MethodGet, "/v1/users/alice/authorize", withPassword(nil), "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("signing in with the old password returned %v, want 401", w.Code)
+	}
+	header := map[string]string{"Password": "battery staple"}
+	if w := s.do(http.MethodGet, "/v1/users/alice/authorize", header, "", nil); w.Code != http.StatusOK {
+		t.Errorf("signing in with the new password returned %v %v", w.Code, w.Body)
+	}
+}
+
+func TestForgotPasswordUnknownUser(t *testing.T) {
+	s := newTestServer(t)
+
+	// the response does not reveal whether the user exists
+	if w := s.do(http.MethodPost, "/v1/password/forgot", nil, `{"username": "nobody"}`, nil); w.Code != http.StatusAccepted {
+		t.Errorf("asking for a password reset of an unknown user returned %v, want 202", w.Code)
+	}
+}
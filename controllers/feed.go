@@ -0,0 +1,406 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/quota"
+	"github.com/rss-creator/scraper"
+	"github.com/rss-creator/storage"
+	"github.com/rss-creator/syndication"
+	"github.com/rss-creator/utils"
+)
+
+const (
+	renderedItemLimit  = 50
+	negotiatedFeedFile = "feed"
+
+	defaultInterval = 60
+	minInterval     = 5
+)
+
+type FeedController interface {
+	PostFeed(w http.ResponseWriter, r *http.Request)
+	GetFeeds(w http.ResponseWriter, r *http.Request)
+	GetFeed(w http.ResponseWriter, r *http.Request)
+	PutFeed(w http.ResponseWriter, r *http.Request)
+	DeleteFeed(w http.ResponseWriter, r *http.Request)
+	PostFeedToken(w http.ResponseWriter, r *http.Request)
+	GetFeedDocument(w http.ResponseWriter, r *http.Request)
+}
+
+type feedController struct {
+	db    storage.DB
+	plans quota.Plans
+}
+
+// feedUpdate is the body of PutFeed. Private is a pointer so that leaving it
+// out of the body leaves the feed's visibility unchanged.
+type feedUpdate struct {
+	models.Feed
+	Private *bool `json:"private"`
+}
+
+func NewFeedController(db storage.DB, plans quota.Plans) FeedController {
+	return &feedController{db, plans}
+}
+
+func (f *feedController) PostFeed(w http.ResponseWriter, r *http.Request) {
+	owner, team, ok := f.feedOwner(w, r, true)
+	if !ok {
+		return
+	}
+
+	var feed models.Feed
+	err := json.NewDecoder(r.Body).Decode(&feed)
+	if err != nil {
+		log.Printf("could not unmarshal PostFeed request body\n%v", err)
+		utils.SendError(w, "Could not parse body as JSON", http.StatusBadRequest)
+		return
+	}
+
+	if feed.Title == "" {
+		utils.SendError(w, "Title required", http.StatusBadRequest)
+		return
+	}
+
+	if !validSourceURL(feed.SourceURL) {
+		utils.SendError(w, "Valid http or https sourceUrl required", http.StatusBadRequest)
+		return
+	}
+
+	if err := scraper.Validate(feed.Rules); err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if feed.Interval == 0 {
+		feed.Interval = defaultInterval
+	} else if feed.Interval < minInterval {
+		utils.SendError(w, fmt.Sprintf("Interval must be at least %v minutes", minInterval), http.StatusBadRequest)
+		return
+	}
+
+	// feeds created for a team count towards the plan of the member who
+	// created them, as they are the feed's owner
+	q, ok := getQuota(f.db, f.plans, w, owner)
+	if !ok {
+		return
+	}
+
+	// every feed gets a token so it can be made private later without
+	// changing its url
+	feed.Token, err = newTokenID()
+	if err != nil {
+		log.Printf("could not generate feed token\n%v", err)
+		utils.SendError(w, "Error generating feed token", http.StatusInternalServerError)
+		return
+	}
+
+	feed.Owner = owner
+	feed.Team = team
+	err = f.db.CreateFeed(&feed, q.Limits.Feeds)
+	if storage.IsLimitReached(err) {
+		utils.SendError(w, fmt.Sprintf("Feed limit of plan %v reached", q.Plan), http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("could not insert feed %v into database\n%v", feed, err)
+		utils.SendError(w, "Error inserting feed into database", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, feed, http.StatusCreated)
+}
+
+func (f *feedController) GetFeeds(w http.ResponseWriter, r *http.Request) {
+	owner, team, ok := f.feedOwner(w, r, false)
+	if !ok {
+		return
+	}
+
+	var feeds []*models.Feed
+	var err error
+	if team != "" {
+		feeds, err = f.db.GetTeamFeeds(team)
+	} else {
+		feeds, err = f.db.GetFeeds(owner)
+	}
+	if err != nil {
+		log.Printf("could not get feeds for %v from the database\n%v", owner, err)
+		utils.SendError(w, "Error getting feeds from database", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, feeds, http.StatusOK)
+}
+
+func (f *feedController) GetFeed(w http.ResponseWriter, r *http.Request) {
+	feed, ok := f.getOwnedFeed(w, r, false)
+	if !ok {
+		return
+	}
+
+	utils.SendSuccess(w, feed, http.StatusOK)
+}
+
+func (f *feedController) PutFeed(w http.ResponseWriter, r *http.Request) {
+	existing, ok := f.getOwnedFeed(w, r, true)
+	if !ok {
+		return
+	}
+
+	var update feedUpdate
+	err := json.NewDecoder(r.Body).Decode(&update)
+	if err != nil {
+		log.Printf("could not unmarshal PutFeed request body\n%v", err)
+		utils.SendError(w, "Could not parse body as JSON", http.StatusBadRequest)
+		return
+	}
+	feed := update.Feed
+
+	if feed.SourceURL != "" && !validSourceURL(feed.SourceURL) {
+		utils.SendError(w, "sourceUrl must be a valid http or https url", http.StatusBadRequest)
+		return
+	}
+
+	if feed.Interval != 0 && feed.Interval < minInterval {
+		utils.SendError(w, fmt.Sprintf("Interval must be at least %v minutes", minInterval), http.StatusBadRequest)
+		return
+	}
+
+	if feed.Rules != (models.ExtractionRules{}) {
+		if err := scraper.Validate(feed.Rules); err != nil {
+			utils.SendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// the next refresh follows from the interval, and is never set by clients
+	feed.NextRefresh = time.Time{}
+	if feed.Interval != 0 && feed.Interval != existing.Interval && !existing.LastRefreshed.IsZero() {
+		feed.NextRefresh = existing.LastRefreshed.Add(time.Duration(feed.Interval) * time.Minute)
+	}
+
+	err = f.db.UpdateFeed(existing.ID, &feed)
+	if err != nil {
+		log.Printf("could not update feed %v\n%v", existing.ID, err)
+		utils.SendError(w, "Error updating feed", http.StatusInternalServerError)
+		return
+	}
+
+	if update.Private != nil && *update.Private != existing.Private {
+		token := existing.Token
+		if token == "" {
+			// feeds created before private feeds existed have no token
+			if token, err = newTokenID(); err != nil {
+				log.Printf("could not generate feed token\n%v", err)
+				utils.SendError(w, "Error generating feed token", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		err = f.db.UpdateFeedAccess(existing.ID, *update.Private, token)
+		if err != nil {
+			log.Printf("could not update access to feed %v\n%v", existing.ID, err)
+			utils.SendError(w, "Error updating feed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+func (f *feedController) DeleteFeed(w http.ResponseWriter, r *http.Request) {
+	feed, ok := f.getOwnedFeed(w, r, true)
+	if !ok {
+		return
+	}
+
+	err := f.db.DeleteFeed(feed.ID)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Feed %v not found", feed.ID), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not delete feed %v\n%v", feed.ID, err)
+		utils.SendError(w, "Error deleting feed", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+// PostFeedToken replaces the feed's token, so urls shared with readers before
+// stop working. The feed with its new token is returned.
+func (f *feedController) PostFeedToken(w http.ResponseWriter, r *http.Request) {
+	feed, ok := f.getOwnedFeed(w, r, true)
+	if !ok {
+		return
+	}
+
+	token, err := newTokenID()
+	if err != nil {
+		log.Printf("could not generate feed token\n%v", err)
+		utils.SendError(w, "Error generating feed token", http.StatusInternalServerError)
+		return
+	}
+
+	err = f.db.UpdateFeedAccess(feed.ID, feed.Private, token)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Feed %v not found", feed.ID), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not update token of feed %v\n%v", feed.ID, err)
+		utils.SendError(w, "Error updating feed", http.StatusInternalServerError)
+		return
+	}
+
+	feed.Token = token
+	utils.SendSuccess(w, feed, http.StatusOK)
+}
+
+// GetFeedDocument serves a feed in the format named by the {file} route
+// variable, or negotiates one from the Accept header when {file} is "feed".
+func (f *feedController) GetFeedDocument(w http.ResponseWriter, r *http.Request) {
+	file := mux.Vars(r)["file"]
+
+	var format syndication.Format
+	var ok bool
+	if file == negotiatedFeedFile {
+		w.Header().Set("Vary", "Accept")
+		format, ok = syndication.Negotiate(r.Header.Get("Accept"))
+		if !ok {
+			utils.SendError(w, "No acceptable feed format", http.StatusNotAcceptable)
+			return
+		}
+	} else if format, ok = syndication.FormatForFile(file); !ok {
+		utils.SendError(w, fmt.Sprintf("Unknown feed format %v", file), http.StatusNotFound)
+		return
+	}
+
+	feed, ok := f.getFeed(w, r)
+	if !ok {
+		return
+	}
+
+	self := requestURL(r)
+	if feed.Private {
+		token := r.URL.Query().Get("token")
+		if feed.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(feed.Token)) != 1 {
+			// the same response as a missing feed, so ids cannot be probed
+			utils.SendError(w, fmt.Sprintf("Feed %v not found", feed.ID), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "private")
+		self += "?token=" + url.QueryEscape(token)
+	}
+
+	items, err := f.db.GetItems(feed.ID, renderedItemLimit)
+	if err != nil {
+		log.Printf("could not get items for feed %v from the database\n%v", feed.ID, err)
+		utils.SendError(w, "Error getting feed items from database", http.StatusInternalServerError)
+		return
+	}
+
+	doc, err := format.Render(syndication.NewDocument(feed, items, self))
+	if err != nil {
+		log.Printf("could not render feed %v as %v\n%v", feed.ID, format.File, err)
+		utils.SendError(w, "Error rendering feed", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendRaw(w, format.ContentType+"; charset=utf-8", doc, http.StatusOK)
+}
+
+// getFeed loads the feed named by the {id} route variable, writing an error
+// response and returning false if it does not exist.
+func (f *feedController) getFeed(w http.ResponseWriter, r *http.Request) (*models.Feed, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.SendError(w, "Feed id must be an integer", http.StatusBadRequest)
+		return nil, false
+	}
+
+	feed, err := f.db.GetFeed(id)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Feed %v not found", id), http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("could not get feed %v from the database\n%v", id, err)
+		utils.SendError(w, "Error getting feed from database", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return feed, true
+}
+
+// getOwnedFeed loads the feed named by the {id} route variable, writing an
+// error response and returning false if it does not exist or does not belong
+// to the owner given by feedOwner.
+func (f *feedController) getOwnedFeed(w http.ResponseWriter, r *http.Request, write bool) (*models.Feed, bool) {
+	owner, team, ok := f.feedOwner(w, r, write)
+	if !ok {
+		return nil, false
+	}
+
+	feed, ok := f.getFeed(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if feed.Team != team || (team == "" && feed.Owner != owner) {
+		utils.SendError(w, fmt.Sprintf("Feed %v not found", feed.ID), http.StatusNotFound)
+		return nil, false
+	}
+
+	return feed, true
+}
+
+// feedOwner returns the user and team that the request's feeds belong to. For
+// routes under a team that is the team named by the {team} route variable,
+// along with the caller, who must be a member of it and a maintainer to write.
+// Otherwise it is the user named by the {username} route variable alone.
+func (f *feedController) feedOwner(w http.ResponseWriter, r *http.Request, write bool) (string, string, bool) {
+	if mux.Vars(r)["team"] != "" {
+		role := models.TeamMemberRole
+		if write {
+			role = models.TeamMaintainerRole
+		}
+
+		member, ok := requireTeamRole(f.db, w, r, role)
+		if !ok {
+			return "", "", false
+		}
+		return member.Username, member.Team, true
+	}
+
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return "", "", false
+	}
+	return username, "", true
+}
+
+// requestURL reconstructs the absolute url of a request, which is always
+// served over TLS
+func requestURL(r *http.Request) string {
+	return fmt.Sprintf("https://%v%v", r.Host, r.URL.Path)
+}
+
+func validSourceURL(raw string) bool {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,238 @@
+package controllers_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+// createFeed creates testFeed for the user and returns it as sent back.
+func (s *testServer) createFeed(username string, accessToken string) models.Feed {
+	var feed models.Feed
+	w := s.do(http.MethodPost, "/v1/users/"+username+"/feeds", bearer(accessToken), testFeed, &feed)
+	if w.Code != http.StatusCreated {
+		s.t.Fatalf("creating a feed returned %v %v", w.Code, w.Body)
+	}
+	return feed
+}
+
+func TestFeedCRUD(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	feed := s.createFeed("alice", login.AccessToken)
+	if feed.ID == 0 || feed.Owner != "alice" || feed.Interval != 60 {
+		t.Errorf("created feed %+v, want an id, owner alice and the default interval", feed)
+	}
+	path := fmt.Sprintf("/v1/users/alice/feeds/%v", feed.ID)
+
+	var feeds []models.Feed
+	if w := s.do(http.MethodGet, "/v1/users/alice/feeds", bearer(login.AccessToken), "", &feeds); w.Code != http.StatusOK {
+		t.Fatalf("listing feeds returned %v %v", w.Code, w.Body)
+	}
+	if len(feeds) != 1 || feeds[0].ID != feed.ID {
+		t.Errorf("listed feeds %+v, want only feed %v", feeds, feed.ID)
+	}
+
+	body := `{"title": "Renamed", "description": "About", "interval": 30}`
+	if w := s.do(http.MethodPut, path, bearer(login.AccessToken), body, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("updating the feed returned %v %v", w.Code, w.Body)
+	}
+
+	var got models.Feed
+	if w := s.do(http.MethodGet, path, bearer(login.AccessToken), "", &got); w.Code != http.StatusOK {
+		t.Fatalf("getting the feed returned %v %v", w.Code, w.Body)
+	}
+	if got.Title != "Renamed" || got.Description != "About" || got.Interval != 30 || got.SourceURL != feed.SourceURL {
+		t.Errorf("got feed %+v after updating, want the new title, description and interval only", got)
+	}
+
+	if w := s.do(http.MethodDelete, path, bearer(login.AccessToken), "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("deleting the feed returned %v %v", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodGet, path, bearer(login.AccessToken), "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("getting a deleted feed returned %v, want 404", w.Code)
+	}
+}
+
+func TestFeedValidation(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	for name, body := range map[string]string{
+		"no title":       `{"sourceUrl": "http://localhost/", "rules": {"item": {"selector": "div"}, "title": {"selector": "h2"}}}`,
+		"bad url":        `{"title": "Feed", "sourceUrl": "ftp://localhost/", "rules": {"item": {"selector": "div"}, "title": {"selector": "h2"}}}`,
+		"no rules":       `{"title": "Feed", "sourceUrl": "http://localhost/"}`,
+		"short interval": `{"title": "Feed", "sourceUrl": "http://localhost/", "interval": 1, "rules": {"item": {"selector": "div"}, "title": {"selector": "h2"}}}`,
+	} {
+		if w := s.do(http.MethodPost, "/v1/users/alice/feeds", bearer(login.AccessToken), body, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("creating a feed with %v returned %v, want 400", name, w.Code)
+		}
+	}
+}
+
+func TestFeedOwnership(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	s.createUser("bob")
+	alice := s.login("alice", nil)
+	bob := s.login("bob", nil)
+
+	feed := s.createFeed("alice", alice.AccessToken)
+	path := fmt.Sprintf("/%v", feed.ID)
+
+	// bob cannot use alice's routes
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		if w := s.do(method, "/v1/users/alice/feeds"+path, bearer(bob.AccessToken), `{"title": "Mine"}`, nil); w.Code != http.StatusForbidden {
+			t.Errorf("%v of alice's feed by bob returned %v, want 403", method, w.Code)
+		}
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice/feeds", bearer(bob.AccessToken), "", nil); w.Code != http.StatusForbidden {
+		t.Errorf("listing alice's feeds by bob returned %v, want 403", w.Code)
+	}
+
+	// nor reach alice's feed through bob's routes, which hide that it exists
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		w := s.do(method, "/v1/users/bob/feeds"+path, bearer(bob.AccessToken), `{"title": "Mine"}`, nil)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%v of alice's feed under bob returned %v, want 404", method, w.Code)
+		}
+	}
+	var feeds []models.Feed
+	if w := s.do(http.MethodGet, "/v1/users/bob/feeds", bearer(bob.AccessToken), "", &feeds); w.Code != http.StatusOK || len(feeds) != 0 {
+		t.Errorf("listing bob's feeds returned %v with %v feeds, want none", w.Code, len(feeds))
+	}
+
+	got, err := s.db.GetFeed(feed.ID)
+	if err != nil {
+		t.Fatalf("could not get feed: %v", err)
+	}
+	if got.Title != feed.Title {
+		t.Errorf("alice's feed is titled %v, want it unchanged", got.Title)
+	}
+}
+
+func TestPutFeedInterval(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+	feed := s.createFeed("alice", login.AccessToken)
+	path := fmt.Sprintf("/v1/users/alice/feeds/%v", feed.ID)
+
+	refreshed := time.Now().Add(-time.Minute * 30).UTC().Truncate(time.Second)
+	if err := s.db.UpdateFeedRefresh(feed.ID, refreshed, refreshed.Add(time.Hour), ""); err != nil {
+		t.Fatalf("could not update feed refresh: %v", err)
+	}
+
+	// a shorter interval brings the next refresh forward from the last one
+	if w := s.do(http.MethodPut, path, bearer(login.AccessToken), `{"interval": 10}`, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("updating the interval returned %v %v", w.Code, w.Body)
+	}
+	updated, err := s.db.GetFeed(feed.ID)
+	if err != nil {
+		t.Fatalf("could not get feed: %v", err)
+	}
+	if want := refreshed.Add(time.Minute * 10); !updated.NextRefresh.Equal(want) {
+		t.Errorf("next refresh is %v, want %v", updated.NextRefresh, want)
+	}
+
+	// the next refresh cannot be set directly
+	body := `{"title": "Renamed", "nextRefresh": "2001-01-01T00:00:00Z"}`
+	if w := s.do(http.MethodPut, path, bearer(login.AccessToken), body, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("updating the title returned %v %v", w.Code, w.Body)
+	}
+	renamed, err := s.db.GetFeed(feed.ID)
+	if err != nil {
+		t.Fatalf("could not get feed: %v", err)
+	}
+	if !renamed.NextRefresh.Equal(updated.NextRefresh) {
+		t.Errorf("next refresh is %v after renaming, want %v", renamed.NextRefresh, updated.NextRefresh)
+	}
+}
+
+func TestGetFeedRSS(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+	feed := s.createFeed("alice", login.AccessToken)
+
+	item := &models.Item{FeedID: feed.ID, GUID: "post-1", Title: "Post 1", Link: "https://example.com/1", FirstSeen: time.Now()}
+	if _, err := s.db.CreateItem(item); err != nil {
+		t.Fatalf("could not create item: %v", err)
+	}
+
+	w := s.do(http.MethodGet, fmt.Sprintf("/v1/feeds/%v/rss.xml", feed.ID), nil, "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("getting the feed as RSS returned %v %v", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/rss+xml; charset=utf-8" {
+		t.Errorf("RSS is served as %v, want application/rss+xml", got)
+	}
+
+	var doc struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title string `xml:"title"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("could not parse RSS: %v\n%v", err, w.Body)
+	}
+	if doc.Channel.Title != feed.Title || len(doc.Channel.Items) != 1 || doc.Channel.Items[0].Title != "Post 1" {
+		t.Errorf("got channel %+v, want the feed with its item", doc.Channel)
+	}
+
+	if w := s.do(http.MethodGet, fmt.Sprintf("/v1/feeds/%v/rss.xml", feed.ID+1), nil, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("getting a missing feed returned %v, want 404", w.Code)
+	}
+}
+
+func TestGetFeedNegotiation(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+	feed := s.createFeed("alice", login.AccessToken)
+	path := fmt.Sprintf("/v1/feeds/%v/", feed.ID)
+
+	for _, test := range []struct {
+		file   string
+		accept string
+		want   string
+	}{
+		{"atom.xml", "", "application/atom+xml"},
+		{"feed.json", "application/atom+xml", "application/feed+json"},
+		{"feed", "", "application/rss+xml"},
+		{"feed", "application/atom+xml", "application/atom+xml"},
+		{"feed", "text/html, application/json;q=0.5", "application/feed+json"},
+	} {
+		w := s.do(http.MethodGet, path+test.file, map[string]string{"Accept": test.accept}, "", nil)
+		if w.Code != http.StatusOK {
+			t.Errorf("getting %v accepting %q returned %v %v", test.file, test.accept, w.Code, w.Body)
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != test.want+"; charset=utf-8" {
+			t.Errorf("%v accepting %q is served as %v, want %v", test.file, test.accept, got, test.want)
+		}
+	}
+
+	// even a refused negotiation tells caches that it varies with Accept
+	w := s.do(http.MethodGet, path+"feed", map[string]string{"Accept": "text/html"}, "", nil)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("getting the feed accepting only html returned %v, want 406", w.Code)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept" {
+		t.Errorf("negotiated response varies with %q, want Accept", got)
+	}
+
+	if w := s.do(http.MethodGet, path+"feed.html", nil, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("getting an unknown format returned %v, want 404", w.Code)
+	}
+}
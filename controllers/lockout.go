@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+)
+
+const (
+	// failures older than loginFailureWindow no longer count towards lockouts
+	loginFailureWindow = time.Hour * 24
+
+	// after the free failures, each further failure doubles the time until
+	// the next attempt is allowed, up to the maximum delay
+	usernameFreeFailures = 5
+	usernameMaxDelay     = time.Minute * 15
+	ipFreeFailures       = 20
+	ipMaxDelay           = time.Hour
+
+	passwordFailure = "password"
+	otpFailure      = "otp"
+)
+
+// invalidCredentials is sent for both unknown users and wrong passwords, so
+// that logins cannot be used to find which users exist.
+const invalidCredentials = "Invalid username or password"
+
+// dummyPasswordHash is compared against when a user does not exist, so that
+// the response takes as long as it would for a wrong password.
+var dummyPasswordHash, _ = hashAndSalt("not a real password")
+
+// loginAttempt is a login attempt reserved by reserveLoginAttempt, which
+// counts as failed until finish is called without fail having been.
+type loginAttempt struct {
+	db      storage.DB
+	failure *models.LoginFailure
+	failed  bool
+}
+
+// reserveLoginAttempt records an attempt to log in as the username from the
+// IP as failed for the given reason, before any factor is checked, so that
+// parallel attempts cannot all be let through by the same count of failures.
+// It returns how long to wait instead if another attempt is not allowed yet.
+func (a *authController) reserveLoginAttempt(username string, ip string, reason string) (*loginAttempt, time.Duration, error) {
+	now := time.Now()
+	failure := &models.LoginFailure{Username: username, IP: ip, Reason: reason, Attempted: now}
+	counts, err := a.db.ReserveLoginFailure(failure, now.Add(-loginFailureWindow))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	byUsername := backoff(counts.Username, usernameFreeFailures, usernameMaxDelay)
+	byIP := backoff(counts.IP, ipFreeFailures, ipMaxDelay)
+
+	wait := waitAfter(counts.UsernameLast, byUsername, now)
+	if ipWait := waitAfter(counts.IPLast, byIP, now); ipWait > wait {
+		wait = ipWait
+	}
+
+	if wait > 0 {
+		// attempts turned away do not count towards the lockout
+		return nil, wait, a.db.DeleteLoginFailure(failure.ID)
+	}
+	return &loginAttempt{db: a.db, failure: failure}, 0, nil
+}
+
+// fail keeps the attempt as a failure, with reason naming the wrong factor.
+func (l *loginAttempt) fail(reason string) error {
+	l.failed = true
+	if reason == l.failure.Reason {
+		return nil
+	}
+	return l.db.UpdateLoginFailureReason(l.failure.ID, reason)
+}
+
+// finish deletes the attempt unless it failed.
+func (l *loginAttempt) finish() {
+	if l.failed {
+		return
+	}
+
+	if err := l.db.DeleteLoginFailure(l.failure.ID); err != nil {
+		log.Printf("could not delete login attempt of user %v\n%v", l.failure.Username, err)
+	}
+}
+
+// backoff is the delay after the given number of failures, which is zero
+// until the free failures are used up and then doubles from one second.
+func backoff(failures int, free int, max time.Duration) time.Duration {
+	if failures < free {
+		return 0
+	}
+
+	seconds := math.Pow(2, float64(failures-free))
+	return time.Duration(math.Min(seconds, max.Seconds())) * time.Second
+}
+
+// waitAfter is how long from now until the delay after the last failure has
+// passed. Failures are stored to the second, so the last one may have been up
+// to a second after the time recorded, and the delay is counted from the end
+// of that second.
+func waitAfter(last time.Time, delay time.Duration, now time.Time) time.Duration {
+	if delay == 0 {
+		return 0
+	}
+	return last.Add(time.Second + delay).Sub(now)
+}
+
+// clientIP is the address the request came from. Forwarding headers are not
+// trusted, since any client can set them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfter formats a wait as whole seconds for the Retry-After header,
+// rounding up so clients never retry too early.
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
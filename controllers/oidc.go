@@ -0,0 +1,467 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gorilla/mux"
+	"golang.org/x/oauth2"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+	"github.com/rss-creator/utils"
+)
+
+const (
+	loginStateExpiryTime = time.Minute * 10
+	// secondFactorExpiryTime is how long a user with two-factor
+	// authentication has to enter a code after signing in at the provider
+	secondFactorExpiryTime = time.Minute * 5
+)
+
+// OIDCConfig configures login through an external OpenID Connect provider.
+// RedirectURL is the page of the web app the provider returns to, which
+// passes the code and state it receives on to the callback endpoint.
+type OIDCConfig struct {
+	Issuer       string   `mapstructure:"issuer"`
+	ClientID     string   `mapstructure:"clientId"`
+	ClientSecret string   `mapstructure:"clientSecret"`
+	RedirectURL  string   `mapstructure:"redirectUrl"`
+	Scopes       []string `mapstructure:"scopes"`
+}
+
+// OIDCProvider is an OpenID Connect provider whose discovery document has
+// been loaded.
+type OIDCProvider struct {
+	issuer   string
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	client   *http.Client
+}
+
+type authorizationURL struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+}
+
+type oidcCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// secondFactorChallenge is the response to an OpenID Connect sign in that
+// still needs the user's second factor.
+type secondFactorChallenge struct {
+	OTPToken string `json:"otpToken"`
+}
+
+type oidcSecondFactorRequest struct {
+	OTPToken string `json:"otpToken"`
+}
+
+type idTokenClaims struct {
+	Email string `json:"email"`
+}
+
+// NewOIDCProvider loads the provider's discovery document, using client for
+// every request made to the provider.
+func NewOIDCProvider(config OIDCConfig, client *http.Client) (*OIDCProvider, error) {
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("OpenID Connect requires a client id and redirect url")
+	}
+
+	ctx := oidc.ClientContext(context.Background(), client)
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+
+	return &OIDCProvider{
+		issuer: config.Issuer,
+		oauth: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  config.RedirectURL,
+			Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		client:   client,
+	}, nil
+}
+
+// GetOIDCLogin starts signing in through the OpenID Connect provider,
+// returning the url to send the user to.
+func (a *authController) GetOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	a.startOIDCLogin(w, "")
+}
+
+// PostIdentity starts linking an identity at the OpenID Connect provider to
+// the user, after which they can sign in with it.
+func (a *authController) PostIdentity(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	a.startOIDCLogin(w, username)
+}
+
+// PostOIDCCallback completes a login started by GetOIDCLogin or PostIdentity
+// with the code and state the provider returned. Sign ins respond with a new
+// refresh and access token pair, unless the user has enabled two-factor
+// authentication. They are then sent an otpToken with a 202 Accepted, which
+// PostOIDCSecondFactor exchanges for tokens along with a code. Links respond
+// with the linked identity, and must be completed with an access token of the
+// user who started them, so an authorization url cannot be passed to someone
+// else to link their identity to the wrong account.
+func (a *authController) PostOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if a.oidc == nil {
+		utils.SendError(w, "OpenID Connect login is not configured", http.StatusNotFound)
+		return
+	}
+
+	var req oidcCallbackRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Code == "" || req.State == "" {
+		utils.SendError(w, "Body with code and state required", http.StatusBadRequest)
+		return
+	}
+
+	state, err := a.db.ConsumeLoginState(hashToken(req.State))
+	if storage.IsNotFound(err) {
+		utils.SendError(w, "Invalid or expired state", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("could not consume login state\n%v", err)
+		utils.SendError(w, "Error completing login", http.StatusInternalServerError)
+		return
+	}
+
+	if state.Username != "" {
+		bearerToken := getBearerToken(r)
+		if bearerToken == "" {
+			utils.SendError(w, "Bearer token required to complete a link", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := a.validateAccessToken(bearerToken, AccessTokenType)
+		if err != nil {
+			sendTokenError(w, err)
+			return
+		}
+
+		if claims.Username != state.Username || !claims.HasScope(AccountAdminScope) {
+			utils.SendError(w, "Links must be completed by the user who started them", http.StatusForbidden)
+			return
+		}
+	}
+
+	ctx := oidc.ClientContext(r.Context(), a.oidc.client)
+	token, err := a.oidc.oauth.Exchange(ctx, req.Code, oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		log.Printf("could not exchange authorization code\n%v", err)
+		utils.SendError(w, "Could not exchange authorization code", http.StatusUnauthorized)
+		return
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		utils.SendError(w, "Provider did not return an id token", http.StatusBadGateway)
+		return
+	}
+
+	idToken, err := a.oidc.verifier.Verify(ctx, rawIDToken)
+	if err != nil || idToken.Nonce != state.Nonce {
+		log.Printf("could not verify id token\n%v", err)
+		utils.SendError(w, "Invalid id token", http.StatusUnauthorized)
+		return
+	}
+
+	var claims idTokenClaims
+	if err := idToken.Claims(&claims); err != nil {
+		log.Printf("could not parse id token claims\n%v", err)
+		utils.SendError(w, "Invalid id token", http.StatusUnauthorized)
+		return
+	}
+
+	if state.Username != "" {
+		a.linkIdentity(w, state.Username, idToken.Subject, claims)
+		return
+	}
+
+	identity, err := a.db.GetIdentity(a.oidc.issuer, idToken.Subject)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, "Identity is not linked to a user, sign in and link it first", http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("could not get identity %v from the database\n%v", idToken.Subject, err)
+		utils.SendError(w, "Error getting identity from database", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := a.db.GetUser(identity.Username)
+	if err != nil {
+		log.Printf("could not get user %v from the database\n%v", identity.Username, err)
+		utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
+		return
+	}
+
+	if user.Disabled {
+		sendTokenError(w, errAccountDisabled)
+		return
+	}
+
+	enrollment, err := a.db.GetTOTP(user.Username)
+	if err != nil && !storage.IsNotFound(err) {
+		log.Printf("could not get totp of user %v from the database\n%v", user.Username, err)
+		utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil && enrollment.Enabled {
+		otpToken, err := newTokenID()
+		if err == nil {
+			err = a.db.CreateUserToken(&models.UserToken{
+				Hash:     hashToken(otpToken),
+				Username: user.Username,
+				Purpose:  models.OIDCSecondFactorPurpose,
+				Expires:  time.Now().Add(secondFactorExpiryTime),
+			})
+		}
+		if err != nil {
+			log.Printf("could not store second factor token of user %v\n%v", user.Username, err)
+			utils.SendError(w, "Error completing login", http.StatusInternalServerError)
+			return
+		}
+
+		utils.SendSuccess(w, secondFactorChallenge{otpToken}, http.StatusAccepted)
+		return
+	}
+
+	a.sendOIDCTokens(w, user)
+}
+
+// PostOIDCSecondFactor finishes an OpenID Connect sign in of a user with
+// two-factor authentication, exchanging the otpToken from PostOIDCCallback
+// and a code in the Otp header for a refresh and access token pair. Wrong
+// codes count as failed logins, and use up the otpToken so that each guess
+// needs another sign in at the provider.
+func (a *authController) PostOIDCSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req oidcSecondFactorRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.OTPToken == "" {
+		utils.SendError(w, "Body with otpToken required", http.StatusBadRequest)
+		return
+	}
+
+	code := r.Header.Get("Otp")
+	if code == "" {
+		utils.SendError(w, "Otp header required", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := a.db.ConsumeUserToken(hashToken(req.OTPToken), models.OIDCSecondFactorPurpose)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, "Invalid or expired otpToken, sign in again", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("could not consume second factor token\n%v", err)
+		utils.SendError(w, "Error completing login", http.StatusInternalServerError)
+		return
+	}
+
+	attempt, wait, err := a.reserveLoginAttempt(token.Username, clientIP(r), otpFailure)
+	if err != nil {
+		log.Printf("could not check login failures of user %v\n%v", token.Username, err)
+		utils.SendError(w, "Error checking login attempts", http.StatusInternalServerError)
+		return
+	} else if wait > 0 {
+		w.Header().Set("Retry-After", retryAfter(wait))
+		utils.SendError(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	defer attempt.finish()
+
+	user, err := a.db.GetUser(token.Username)
+	if err != nil {
+		log.Printf("could not get user %v from the database\n%v", token.Username, err)
+		utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
+		return
+	}
+
+	if user.Disabled {
+		sendTokenError(w, errAccountDisabled)
+		return
+	}
+
+	enrollment, err := a.db.GetTOTP(user.Username)
+	if storage.IsNotFound(err) {
+		// two-factor authentication was disabled since the sign in started
+		a.sendOIDCTokens(w, user)
+		return
+	} else if err != nil {
+		log.Printf("could not get totp of user %v from the database\n%v", user.Username, err)
+		utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
+		return
+	}
+
+	ok, err := a.checkSecondFactor(enrollment, code)
+	if err != nil {
+		log.Printf("could not check second factor of user %v\n%v", user.Username, err)
+		utils.SendError(w, "Error checking code", http.StatusInternalServerError)
+		return
+	} else if !ok {
+		if err := attempt.fail(otpFailure); err != nil {
+			log.Printf("could not record login failure of user %v\n%v", user.Username, err)
+		}
+		utils.SendError(w, "Code incorrect, sign in again", http.StatusUnauthorized)
+		return
+	}
+
+	err = a.db.ClearLoginFailures(user.Username)
+	if err != nil {
+		log.Printf("could not clear login failures of user %v\n%v", user.Username, err)
+	}
+
+	a.sendOIDCTokens(w, user)
+}
+
+func (a *authController) GetIdentities(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	identities, err := a.db.GetIdentities(username)
+	if err != nil {
+		log.Printf("could not get identities of user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting identities from database", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, identities, http.StatusOK)
+}
+
+func (a *authController) DeleteIdentity(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	username := vars["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.SendError(w, "Identity id must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	err = a.db.DeleteIdentity(username, id)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Identity %v not found", id), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not delete identity %v\n%v", id, err)
+		utils.SendError(w, "Error deleting identity", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+// startOIDCLogin stores a new login state and responds with the provider's
+// authorization url. The PKCE verifier and nonce never leave the server.
+func (a *authController) startOIDCLogin(w http.ResponseWriter, username string) {
+	if a.oidc == nil {
+		utils.SendError(w, "OpenID Connect login is not configured", http.StatusNotFound)
+		return
+	}
+
+	state, err := newTokenID()
+	if err != nil {
+		log.Printf("could not generate login state\n%v", err)
+		utils.SendError(w, "Error starting login", http.StatusInternalServerError)
+		return
+	}
+
+	nonce, err := newTokenID()
+	if err != nil {
+		log.Printf("could not generate login nonce\n%v", err)
+		utils.SendError(w, "Error starting login", http.StatusInternalServerError)
+		return
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	err = a.db.CreateLoginState(&models.LoginState{
+		Hash:     hashToken(state),
+		Verifier: verifier,
+		Nonce:    nonce,
+		Username: username,
+		Expires:  time.Now().Add(loginStateExpiryTime),
+	})
+	if err != nil {
+		log.Printf("could not store login state\n%v", err)
+		utils.SendError(w, "Error starting login", http.StatusInternalServerError)
+		return
+	}
+
+	url := a.oidc.oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce))
+	utils.SendSuccess(w, authorizationURL{url}, http.StatusOK)
+}
+
+// sendOIDCTokens responds with a new token pair for a user signed in through
+// the provider, granting every scope.
+func (a *authController) sendOIDCTokens(w http.ResponseWriter, user *models.User) {
+	family, err := newTokenID()
+	if err != nil {
+		log.Printf("could not generate token family\n%v", err)
+		utils.SendError(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	t, err := a.issueTokens(user, family, strings.Join(allScopes, " "))
+	if err != nil {
+		log.Printf("could not generate tokens\n%v", err)
+		utils.SendError(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, t, http.StatusOK)
+}
+
+func (a *authController) linkIdentity(w http.ResponseWriter, username string, subject string, claims idTokenClaims) {
+	identity := models.Identity{
+		Username: username,
+		Issuer:   a.oidc.issuer,
+		Subject:  subject,
+		Email:    claims.Email,
+		Created:  time.Now().UTC().Truncate(time.Second),
+	}
+
+	err := a.db.CreateIdentity(&identity)
+	if storage.IsAlreadyExists(err) {
+		utils.SendError(w, "Identity is already linked to a user", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("could not link identity %v to user %v\n%v", subject, username, err)
+		utils.SendError(w, "Error linking identity", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, identity, http.StatusCreated)
+}
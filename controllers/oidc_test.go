@@ -0,0 +1,283 @@
+package controllers_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/rss-creator/controllers"
+	"github.com/rss-creator/keys"
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/quota"
+)
+
+const testClientID = "rss-creator"
+
+// testIdP is an OpenID Connect provider that authorizes whoever the test
+// says, and enforces PKCE when codes are exchanged.
+type testIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	keys   *keys.KeySet
+
+	mu     sync.Mutex
+	grants map[string]idpGrant
+}
+
+// idpGrant is what an authorization code was issued for.
+type idpGrant struct {
+	subject   string
+	nonce     string
+	challenge string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "idp.pem")
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("could not write key: %v", err)
+	}
+
+	keySet, err := keys.NewKeySet([]keys.Config{{ID: "idp", Algorithm: "RS256", Path: path}}, "idp")
+	if err != nil {
+		t.Fatalf("could not create key set: %v", err)
+	}
+
+	p := &testIdP{t: t, keys: keySet, grants: map[string]idpGrant{}}
+	p.server = httptest.NewServer(http.HandlerFunc(p.serveHTTP))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testIdP) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	case "/jwks":
+		json.NewEncoder(w).Encode(p.keys.JWKS())
+	case "/token":
+		p.exchange(w, r)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// exchange redeems an authorization code once, provided the code verifier
+// matches the challenge the code was issued for.
+func (p *testIdP) exchange(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	p.mu.Lock()
+	grant, ok := p.grants[r.Form.Get("code")]
+	delete(p.grants, r.Form.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := p.keys.Sign(jwt.MapClaims{
+		"iss":   p.server.URL,
+		"sub":   grant.subject,
+		"aud":   testClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": grant.nonce,
+		"email": grant.subject + "@idp.example.com",
+	})
+	if err != nil {
+		p.t.Errorf("could not sign id token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "idp access token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// authorize signs the subject in at the authorization url, returning the
+// code and state the provider sends back to the web app.
+func (p *testIdP) authorize(authorizationURL string, subject string) (string, string) {
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		p.t.Fatalf("could not parse authorization url %v: %v", authorizationURL, err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != testClientID || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		p.t.Fatalf("authorization url %v does not use PKCE with the client id", authorizationURL)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code := fmt.Sprintf("code-%v", len(p.grants)+1)
+	p.grants[code] = idpGrant{subject: subject, nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	return code, q.Get("state")
+}
+
+func newOIDCTestServer(t *testing.T) (*testServer, *testIdP) {
+	p := newTestIdP(t)
+	provider, err := controllers.NewOIDCProvider(controllers.OIDCConfig{
+		Issuer:      p.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost/oidc",
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("could not create provider: %v", err)
+	}
+	return newTestServerWithOIDC(t, quota.Plans{}, provider), p
+}
+
+// startOIDC starts a sign in, or a link when accessToken is not empty, and
+// returns the authorization url.
+func (s *testServer) startOIDC(username string, accessToken string) string {
+	var resp struct{ AuthorizationURL string }
+	var w *httptest.ResponseRecorder
+	if accessToken == "" {
+		w = s.do(http.MethodGet, "/v1/oidc/login", nil, "", &resp)
+	} else {
+		w = s.do(http.MethodPost, "/v1/users/"+username+"/identities", bearer(accessToken), "", &resp)
+	}
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("starting an OpenID Connect login returned %v %v", w.Code, w.Body)
+	}
+	return resp.AuthorizationURL
+}
+
+func (s *testServer) oidcCallback(code string, state string, header map[string]string, data interface{}) *httptest.ResponseRecorder {
+	return s.do(http.MethodPost, "/v1/oidc/callback", header, `{"code": "`+code+`", "state": "`+state+`"}`, data)
+}
+
+func TestOIDCLinkAndSignIn(t *testing.T) {
+	s, idp := newOIDCTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	code, state := idp.authorize(s.startOIDC("alice", login.AccessToken), "subject-1")
+	var identity models.Identity
+	if w := s.oidcCallback(code, state, bearer(login.AccessToken), &identity); w.Code != http.StatusCreated {
+		t.Fatalf("completing the link returned %v %v", w.Code, w.Body)
+	}
+	if identity.Username != "alice" || identity.Subject != "subject-1" || identity.Email != "subject-1@idp.example.com" {
+		t.Errorf("linked identity %+v, want subject-1 linked to alice", identity)
+	}
+
+	code, state = idp.authorize(s.startOIDC("", ""), "subject-1")
+	var signedIn tokens
+	if w := s.oidcCallback(code, state, nil, &signedIn); w.Code != http.StatusOK {
+		t.Fatalf("signing in returned %v %v", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice", bearer(signedIn.AccessToken), "", nil); w.Code != http.StatusOK {
+		t.Errorf("using the access token from signing in returned %v %v", w.Code, w.Body)
+	}
+}
+
+func TestOIDCLinkRequiresOwner(t *testing.T) {
+	s, idp := newOIDCTestServer(t)
+	s.createUser("alice")
+	s.createUser("bob")
+	alice := s.login("alice", nil)
+	bob := s.login("bob", nil)
+
+	// a link started by alice cannot be completed by anyone else, so alice's
+	// authorization url cannot link someone else's identity to the account
+	code, state := idp.authorize(s.startOIDC("alice", alice.AccessToken), "subject-bob")
+	if w := s.oidcCallback(code, state, nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("completing a link without a token returned %v, want 401", w.Code)
+	}
+
+	code, state = idp.authorize(s.startOIDC("alice", alice.AccessToken), "subject-bob")
+	if w := s.oidcCallback(code, state, bearer(bob.AccessToken), nil); w.Code != http.StatusForbidden {
+		t.Errorf("completing alice's link as bob returned %v, want 403", w.Code)
+	}
+
+	identities, err := s.db.GetIdentities("alice")
+	if err != nil {
+		t.Fatalf("could not get identities: %v", err)
+	}
+	if len(identities) != 0 {
+		t.Errorf("alice has identities %+v, want none", identities)
+	}
+}
+
+func TestOIDCSignInUnlinked(t *testing.T) {
+	s, idp := newOIDCTestServer(t)
+
+	code, state := idp.authorize(s.startOIDC("", ""), "subject-1")
+	if w := s.oidcCallback(code, state, nil, nil); w.Code != http.StatusForbidden {
+		t.Errorf("signing in with an unlinked identity returned %v, want 403", w.Code)
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	s, idp := newOIDCTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+	code, state := idp.authorize(s.startOIDC("alice", login.AccessToken), "subject-1")
+
+	if w := s.oidcCallback(code, "not a state", bearer(login.AccessToken), nil); w.Code != http.StatusBadRequest {
+		t.Errorf("completing a login with an unknown state returned %v, want 400", w.Code)
+	}
+	if w := s.oidcCallback(code, state, bearer(login.AccessToken), nil); w.Code != http.StatusCreated {
+		t.Fatalf("completing the link returned %v %v", w.Code, w.Body)
+	}
+
+	// each state completes one login
+	code, _ = idp.authorize(s.startOIDC("alice", login.AccessToken), "subject-2")
+	if w := s.oidcCallback(code, state, bearer(login.AccessToken), nil); w.Code != http.StatusBadRequest {
+		t.Errorf("completing a login with a used state returned %v, want 400", w.Code)
+	}
+}
+
+func TestOIDCCallbackPKCE(t *testing.T) {
+	s, idp := newOIDCTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	// a code issued for one login is sent with the state of another, whose
+	// verifier does not match the code's challenge
+	intercepted, _ := idp.authorize(s.startOIDC("", ""), "subject-1")
+	_, state := idp.authorize(s.startOIDC("alice", login.AccessToken), "subject-2")
+	if w := s.oidcCallback(intercepted, state, bearer(login.AccessToken), nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("completing a login with another login's code returned %v, want 401", w.Code)
+	}
+
+	identities, err := s.db.GetIdentities("alice")
+	if err != nil {
+		t.Fatalf("could not get identities: %v", err)
+	}
+	if len(identities) != 0 {
+		t.Errorf("alice has identities %+v, want none", identities)
+	}
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rss-creator/models"
+)
+
+// Policy decides whether the holder of a validated token may make a request.
+type Policy func(claims *TokenClaims, r *http.Request) bool
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+// Authenticated allows any valid token.
+func Authenticated(claims *TokenClaims, r *http.Request) bool {
+	return true
+}
+
+// Owner allows tokens issued to the user named by the {username} route
+// variable.
+func Owner(claims *TokenClaims, r *http.Request) bool {
+	username := mux.Vars(r)["username"]
+	return username != "" && claims.Username == username
+}
+
+// Admin allows tokens of admin users.
+func Admin(claims *TokenClaims, r *http.Request) bool {
+	return claims.Role == models.AdminRole
+}
+
+// AnyOf allows a request when at least one of the policies does.
+func AnyOf(policies ...Policy) Policy {
+	return func(claims *TokenClaims, r *http.Request) bool {
+		for _, p := range policies {
+			if p(claims, r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Principal returns the claims of the token that authenticated a request
+// passed through Wrapper, or nil if there was none.
+func Principal(r *http.Request) *TokenClaims {
+	claims, _ := r.Context().Value(principalKey).(*TokenClaims)
+	return claims
+}
+
+func withPrincipal(r *http.Request, claims *TokenClaims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey, claims))
+}
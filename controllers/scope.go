@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scopes limit what a token or API key can be used for, so a dashboard can be
+// handed a token that can read feeds but not delete the account.
+const (
+	FeedsReadScope    = "feeds:read"
+	FeedsWriteScope   = "feeds:write"
+	ScraperUseScope   = "scraper:use"
+	AccountAdminScope = "account:admin"
+
+	// AnyScope is granted by every token, for routes such as revoking the
+	// token that is presented or reading the caller's own profile and usage
+	AnyScope = ""
+)
+
+var allScopes = []string{FeedsReadScope, FeedsWriteScope, ScraperUseScope, AccountAdminScope}
+
+// HasScope reports whether the token grants the scope. Tokens issued before
+// scopes existed carry none, and grant every scope.
+func (c *TokenClaims) HasScope(scope string) bool {
+	if c.Scope == "" {
+		return true
+	}
+	return contains(strings.Fields(c.Scope), scope)
+}
+
+// parseScope reads a space separated list of scopes, as used by the scope
+// claim and query parameter. An empty list means every scope.
+func parseScope(scope string) ([]string, error) {
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		return allScopes, nil
+	}
+
+	for _, s := range scopes {
+		if !contains(allScopes, s) {
+			return nil, fmt.Errorf("unknown scope '%v'", s)
+		}
+	}
+	return scopes, nil
+}
+
+// grantedScopes lists the scopes a token grants.
+func grantedScopes(claims *TokenClaims) []string {
+	if claims.Scope == "" {
+		return allScopes
+	}
+	return strings.Fields(claims.Scope)
+}
+
+func contains(arr []string, val string) bool {
+	for _, v := range arr {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
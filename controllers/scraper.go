@@ -1,23 +1,40 @@
 package controllers
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
-    "io/ioutil"
+	"net/url"
+	"time"
 
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/quota"
+	"github.com/rss-creator/scraper"
+	"github.com/rss-creator/storage"
 	"github.com/rss-creator/utils"
 )
 
 type ScraperController interface {
 	GetWebsite(w http.ResponseWriter, r *http.Request)
+	PostItems(w http.ResponseWriter, r *http.Request)
 }
 
 type scraperController struct {
-    Client *http.Client
+	db     storage.DB
+	Client *http.Client
+	plans  quota.Plans
 }
 
-func NewScraperController(client *http.Client) ScraperController {
-	return &scraperController{client}
+type itemsRequest struct {
+	URL   string                 `json:"url"`
+	Rules models.ExtractionRules `json:"rules"`
+}
+
+func NewScraperController(db storage.DB, client *http.Client, plans quota.Plans) ScraperController {
+	return &scraperController{db, client, plans}
 }
 
 func (s *scraperController) GetWebsite(w http.ResponseWriter, r *http.Request) {
@@ -27,20 +44,107 @@ func (s *scraperController) GetWebsite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-    resp, err := s.Client.Get(url)
-    if err != nil {
-        log.Printf("could not get response from url %v\n%v", url, err)
-		utils.SendError(w, "Could not get response from url", http.StatusNotFound)
+	body, ok := s.fetch(w, r, url)
+	if !ok {
 		return
-    }
-    defer resp.Body.Close()
+	}
 
-    body, err := ioutil.ReadAll(resp.Body)
-    if err != nil {
-        log.Printf("could not read response body from url %v\n%v", url, err)
-		utils.SendError(w, "Could not read response from url", http.StatusBadRequest)
+	utils.SendSuccess(w, string(body), http.StatusOK)
+}
+
+// PostItems fetches a page and runs the given extraction rules against it,
+// so that rules can be previewed before they are saved to a feed.
+func (s *scraperController) PostItems(w http.ResponseWriter, r *http.Request) {
+	var req itemsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Printf("could not unmarshal PostItems request body\n%v", err)
+		utils.SendError(w, "Could not parse body as JSON", http.StatusBadRequest)
 		return
-    }
+	}
 
-	utils.SendSuccess(w, string(body), http.StatusOK)
+	base, err := url.Parse(req.URL)
+	if req.URL == "" || err != nil {
+		utils.SendError(w, "Valid url required", http.StatusBadRequest)
+		return
+	}
+
+	body, ok := s.fetch(w, r, req.URL)
+	if !ok {
+		return
+	}
+
+	items, err := scraper.Extract(body, base, req.Rules)
+	if err != nil {
+		utils.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	utils.SendSuccess(w, items, http.StatusOK)
+}
+
+// fetch downloads a page on behalf of the caller, once they are within their
+// plan's daily scrape and byte limits. The scrape and the most bytes it may
+// fetch are reserved before the page is requested, so concurrent requests
+// cannot take the caller past their limits, and whatever was not fetched is
+// given back afterwards.
+func (s *scraperController) fetch(w http.ResponseWriter, r *http.Request, url string) ([]byte, bool) {
+	username := Principal(r).Username
+	q, ok := getQuota(s.db, s.plans, w, username)
+	if !ok {
+		return nil, false
+	}
+
+	// near the byte limit only what is left can be fetched, and pages are cut
+	// short as they are at scraper.MaxBodySize
+	reserved := int64(scraper.MaxBodySize)
+	if left := q.Limits.Bytes - q.Usage.Bytes; q.Limits.Bytes > 0 && left < reserved {
+		reserved = left
+	}
+
+	if reserved <= 0 {
+		sendScraperLimit(w, q)
+		return nil, false
+	}
+
+	now := time.Now()
+	ok, err := s.db.ReserveScrape(username, now, reserved, q.Limits.Scrapes, q.Limits.Bytes)
+	if err != nil {
+		log.Printf("could not reserve scrape of user %v\n%v", username, err)
+		utils.SendError(w, "Error recording scrape", http.StatusInternalServerError)
+		return nil, false
+	} else if !ok {
+		sendScraperLimit(w, q)
+		return nil, false
+	}
+
+	var body []byte
+	defer func() {
+		err := s.db.RefundScrapeBytes(username, now, reserved-int64(len(body)))
+		if err != nil {
+			log.Printf("could not refund scrape of user %v\n%v", username, err)
+		}
+	}()
+
+	resp, err := s.Client.Get(url)
+	if err != nil {
+		log.Printf("could not get response from url %v\n%v", url, err)
+		utils.SendError(w, "Could not get response from url", http.StatusNotFound)
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	body, err = ioutil.ReadAll(io.LimitReader(resp.Body, reserved))
+	if err != nil {
+		log.Printf("could not read response body from url %v\n%v", url, err)
+		utils.SendError(w, "Could not read response from url", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return body, true
+}
+
+func sendScraperLimit(w http.ResponseWriter, q *userQuota) {
+	w.Header().Set("Retry-After", retryAfter(time.Until(q.Resets)))
+	utils.SendError(w, fmt.Sprintf("Daily scraper limit of plan %v reached", q.Plan), http.StatusTooManyRequests)
 }
@@ -0,0 +1,179 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rss-creator/controllers"
+	"github.com/rss-creator/keys"
+	"github.com/rss-creator/mail"
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/quota"
+	"github.com/rss-creator/server"
+	"github.com/rss-creator/storage"
+)
+
+const testPassword = "correct horse"
+
+// testServer serves the API as main does, backed by the memory database.
+// Mail is appended to the file at mailLog.
+type testServer struct {
+	t       *testing.T
+	db      storage.DB
+	handler http.Handler
+	mailLog string
+}
+
+type tokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return newTestServerWithPlans(t, quota.Plans{})
+}
+
+// newTestServerWithPlans is newTestServer holding users to plans.
+func newTestServerWithPlans(t *testing.T, plans quota.Plans) *testServer {
+	return newTestServerWithOIDC(t, plans, nil)
+}
+
+// newTestServerWithOIDC is newTestServerWithPlans signing users in through
+// provider, unless it is nil.
+func newTestServerWithOIDC(t *testing.T, plans quota.Plans, provider *controllers.OIDCProvider) *testServer {
+	db, err := storage.GetDB(storage.Memory, "")
+	if err != nil {
+		t.Fatalf("could not create database: %v", err)
+	}
+
+	keySet, err := keys.NewKeySet([]keys.Config{{ID: "default", Algorithm: "HS512", Secret: "test secret"}}, "default")
+	if err != nil {
+		t.Fatalf("could not create key set: %v", err)
+	}
+
+	mailLog := filepath.Join(t.TempDir(), "mail.log")
+	mailer, err := mail.New(mail.Config{From: "rss-creator <noreply@localhost>", Path: mailLog})
+	if err != nil {
+		t.Fatalf("could not create mailer: %v", err)
+	}
+
+	r := mux.NewRouter()
+	server.Route(r.PathPrefix("/v1").Subrouter(),
+		controllers.NewUserController(db, mailer, "http://localhost"),
+		controllers.NewAuthController(db, keySet, provider),
+		controllers.NewFeedController(db, plans),
+		controllers.NewScraperController(db, http.DefaultClient, plans),
+		controllers.NewAdminController(db, plans),
+		controllers.NewTeamController(db, mailer, "http://localhost"),
+		controllers.NewUsageController(db, plans))
+
+	return &testServer{t, db, r, mailLog}
+}
+
+// do sends a request with the given headers, and decodes the data of a
+// successful response into data when it is not nil.
+func (s *testServer) do(method string, path string, header map[string]string, body string, data interface{}) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+
+	if data != nil && w.Code < http.StatusMultipleChoices {
+		resp := struct{ Data interface{} }{data}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			s.t.Fatalf("could not decode response to %v %v: %v", method, path, err)
+		}
+	}
+	return w
+}
+
+// errorMessage returns the message of an error response.
+func (s *testServer) errorMessage(w *httptest.ResponseRecorder) string {
+	var resp struct{ Error struct{ Message string } }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		s.t.Fatalf("could not decode error response %v: %v", w.Body, err)
+	}
+	return resp.Error.Message
+}
+
+func (s *testServer) createUser(username string) {
+	body := `{"username": "` + username + `", "password": "` + testPassword + `", "email": "` + username + `@example.com"}`
+	if w := s.do(http.MethodPost, "/v1/users", nil, body, nil); w.Code != http.StatusNoContent {
+		s.t.Fatalf("could not create user %v: %v %v", username, w.Code, w.Body)
+	}
+}
+
+// createAdmin creates a user with the admin role and signs them in.
+func (s *testServer) createAdmin(username string) tokens {
+	s.createUser(username)
+	if err := s.db.UpdateUserAccess(username, models.AdminRole, false); err != nil {
+		s.t.Fatalf("could not make %v an admin: %v", username, err)
+	}
+	return s.login(username, nil)
+}
+
+// login signs the user in with their password, along with any other headers
+// such as Otp, and fails the test unless it succeeds.
+func (s *testServer) login(username string, header map[string]string) tokens {
+	var t tokens
+	w := s.do(http.MethodGet, "/v1/users/"+username+"/authorize", withPassword(header), "", &t)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("could not sign in as %v: %v %v", username, w.Code, w.Body)
+	}
+	return t
+}
+
+// mailedToken returns the token in the last link to the given page that was
+// mailed, waiting for mail sent in the background to arrive, and fails the
+// test if there is none.
+func (s *testServer) mailedToken(page string) string {
+	prefix := "http://localhost" + page + "?token="
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		mail, err := ioutil.ReadFile(s.mailLog)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			s.t.Fatalf("could not read mail: %v", err)
+		}
+
+		i := strings.LastIndex(string(mail), prefix)
+		if i < 0 {
+			continue
+		}
+		link := strings.Fields(string(mail[i+len(prefix):]))[0]
+
+		token, err := url.QueryUnescape(link)
+		if err != nil {
+			s.t.Fatalf("could not unescape token %q: %v", link, err)
+		}
+		return token
+	}
+
+	s.t.Fatalf("no link to %v was mailed", page)
+	return ""
+}
+
+func withPassword(header map[string]string) map[string]string {
+	h := map[string]string{"Password": testPassword}
+	for k, v := range header {
+		h[k] = v
+	}
+	return h
+}
+
+func bearer(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
@@ -0,0 +1,559 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rss-creator/mail"
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+	"github.com/rss-creator/utils"
+)
+
+const (
+	teamTitleMaxLength       = 256
+	teamInvitationExpiryTime = time.Hour * 24 * 7
+)
+
+// teamNamePattern keeps team names safe to use in urls
+var teamNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// teamRoleRanks orders team roles, each granting everything the roles below it
+// do
+var teamRoleRanks = map[string]int{
+	models.TeamMemberRole:     1,
+	models.TeamMaintainerRole: 2,
+	models.TeamOwnerRole:      3,
+}
+
+type TeamController interface {
+	PostTeam(w http.ResponseWriter, r *http.Request)
+	GetTeam(w http.ResponseWriter, r *http.Request)
+	DeleteTeam(w http.ResponseWriter, r *http.Request)
+	GetUserTeams(w http.ResponseWriter, r *http.Request)
+	GetTeamMembers(w http.ResponseWriter, r *http.Request)
+	PutTeamMember(w http.ResponseWriter, r *http.Request)
+	DeleteTeamMember(w http.ResponseWriter, r *http.Request)
+	PostTeamInvitation(w http.ResponseWriter, r *http.Request)
+	GetTeamInvitations(w http.ResponseWriter, r *http.Request)
+	DeleteTeamInvitation(w http.ResponseWriter, r *http.Request)
+	GetUserInvitations(w http.ResponseWriter, r *http.Request)
+	PostUserInvitation(w http.ResponseWriter, r *http.Request)
+	DeleteUserInvitation(w http.ResponseWriter, r *http.Request)
+}
+
+type teamController struct {
+	db     storage.DB
+	mailer mail.Mailer
+	// appURL is the web app that links in emails point to
+	appURL string
+}
+
+type teamMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// teamInvitationRequest names either the username or the email address of the
+// invitee. Role defaults to member.
+type teamInvitationRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+func NewTeamController(db storage.DB, mailer mail.Mailer, appURL string) TeamController {
+	return &teamController{db, mailer, appURL}
+}
+
+// PostTeam creates a team with the caller as its owner.
+func (t *teamController) PostTeam(w http.ResponseWriter, r *http.Request) {
+	var team models.Team
+	err := json.NewDecoder(r.Body).Decode(&team)
+	if err != nil {
+		log.Printf("could not unmarshal PostTeam request body\n%v", err)
+		utils.SendError(w, "Could not parse body as JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !teamNamePattern.MatchString(team.Name) {
+		utils.SendError(w, "Name of at most 64 letters, digits, '-' or '_' required", http.StatusBadRequest)
+		return
+	}
+
+	if len(team.Title) > teamTitleMaxLength {
+		utils.SendError(w, fmt.Sprintf("Title must be at most %v characters", teamTitleMaxLength), http.StatusBadRequest)
+		return
+	}
+
+	team.Created = time.Now().UTC().Truncate(time.Second)
+	err = t.db.CreateTeam(&team, Principal(r).Username)
+	if storage.IsAlreadyExists(err) {
+		utils.SendError(w, fmt.Sprintf("Team %v already exists", team.Name), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("could not insert team %v into database\n%v", team.Name, err)
+		utils.SendError(w, "Error inserting team into database", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, team, http.StatusCreated)
+}
+
+func (t *teamController) GetTeam(w http.ResponseWriter, r *http.Request) {
+	member, ok := requireTeamRole(t.db, w, r, models.TeamMemberRole)
+	if !ok {
+		return
+	}
+
+	team, err := t.db.GetTeam(member.Team)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Team %v not found", member.Team), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not get team %v from the database\n%v", member.Team, err)
+		utils.SendError(w, "Error getting team from database", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, team, http.StatusOK)
+}
+
+// DeleteTeam deletes the team along with all of its feeds.
+func (t *teamController) DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	member, ok := requireTeamRole(t.db, w, r, models.TeamOwnerRole)
+	if !ok {
+		return
+	}
+
+	err := t.db.DeleteTeam(member.Team)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Team %v not found", member.Team), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not delete team %v\n%v", member.Team, err)
+		utils.SendError(w, "Error deleting team", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+// GetUserTeams lists the user's membership of each of their teams.
+func (t *teamController) GetUserTeams(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	teams, err := t.db.GetUserTeams(username)
+	if err != nil {
+		log.Printf("could not get teams of user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting teams from database", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, teams, http.StatusOK)
+}
+
+func (t *teamController) GetTeamMembers(w http.ResponseWriter, r *http.Request) {
+	member, ok := requireTeamRole(t.db, w, r, models.TeamMemberRole)
+	if !ok {
+		return
+	}
+
+	members, err := t.db.GetTeamMembers(member.Team)
+	if err != nil {
+		log.Printf("could not get members of team %v from the database\n%v", member.Team, err)
+		utils.SendError(w, "Error getting team members from database", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, members, http.StatusOK)
+}
+
+// PutTeamMember changes a member's role. Teams always keep at least one owner.
+func (t *teamController) PutTeamMember(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireTeamRole(t.db, w, r, models.TeamOwnerRole)
+	if !ok {
+		return
+	}
+
+	username := mux.Vars(r)["username"]
+	var req teamMemberRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Printf("could not unmarshal PutTeamMember request body\n%v", err)
+		utils.SendError(w, "Could not parse body as JSON", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := teamRoleRanks[req.Role]; !ok {
+		utils.SendError(w, fmt.Sprintf("Role must be '%v', '%v' or '%v'",
+			models.TeamMemberRole, models.TeamMaintainerRole, models.TeamOwnerRole), http.StatusBadRequest)
+		return
+	}
+
+	members, err := t.db.GetTeamMembers(caller.Team)
+	if err != nil {
+		log.Printf("could not get members of team %v from the database\n%v", caller.Team, err)
+		utils.SendError(w, "Error getting team members from database", http.StatusInternalServerError)
+		return
+	}
+
+	var target *models.TeamMember
+	owners := 0
+	for _, m := range members {
+		if m.Username == username {
+			target = m
+		}
+		if m.Role == models.TeamOwnerRole {
+			owners++
+		}
+	}
+
+	if target == nil {
+		utils.SendError(w, fmt.Sprintf("User %v is not a member of team %v", username, caller.Team), http.StatusNotFound)
+		return
+	}
+
+	if target.Role == models.TeamOwnerRole && req.Role != models.TeamOwnerRole && owners == 1 {
+		utils.SendError(w, "Teams need at least one owner", http.StatusBadRequest)
+		return
+	}
+
+	err = t.db.UpdateTeamMember(caller.Team, username, req.Role)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("User %v is not a member of team %v", username, caller.Team), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not update member %v of team %v\n%v", username, caller.Team, err)
+		utils.SendError(w, "Error updating team member", http.StatusInternalServerError)
+		return
+	}
+
+	target.Role = req.Role
+	utils.SendSuccess(w, target, http.StatusOK)
+}
+
+// DeleteTeamMember removes a member from the team, which owners can do to
+// anyone and members can do to themselves to leave. The feeds the member owns
+// stay with the team, and the last member leaving deletes the team.
+func (t *teamController) DeleteTeamMember(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	role := models.TeamOwnerRole
+	if username == Principal(r).Username {
+		role = models.TeamMemberRole
+	}
+
+	caller, ok := requireTeamRole(t.db, w, r, role)
+	if !ok {
+		return
+	}
+
+	err := t.db.DeleteTeamMember(caller.Team, username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("User %v is not a member of team %v", username, caller.Team), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not delete member %v of team %v\n%v", username, caller.Team, err)
+		utils.SendError(w, "Error deleting team member", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+// PostTeamInvitation invites a user, by username or email address, to join
+// the team. Invitees are emailed when we have an address for them, and accept
+// through PostUserInvitation.
+func (t *teamController) PostTeamInvitation(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireTeamRole(t.db, w, r, models.TeamOwnerRole)
+	if !ok {
+		return
+	}
+
+	var req teamInvitationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Printf("could not unmarshal PostTeamInvitation request body\n%v", err)
+		utils.SendError(w, "Could not parse body as JSON", http.StatusBadRequest)
+		return
+	}
+
+	if (req.Username == "") == (req.Email == "") {
+		utils.SendError(w, "Exactly one of username or email required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email != "" && (!strings.Contains(req.Email, "@") || strings.ContainsAny(req.Email, " \r\n")) {
+		utils.SendError(w, "Email must be a valid email address", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = models.TeamMemberRole
+	} else if _, ok := teamRoleRanks[req.Role]; !ok {
+		utils.SendError(w, fmt.Sprintf("Role must be '%v', '%v' or '%v'",
+			models.TeamMemberRole, models.TeamMaintainerRole, models.TeamOwnerRole), http.StatusBadRequest)
+		return
+	}
+
+	to := strings.ToLower(req.Email)
+	if req.Username != "" {
+		invitee, err := t.db.GetUser(req.Username)
+		if storage.IsNotFound(err) {
+			utils.SendError(w, fmt.Sprintf("User %v not found", req.Username), http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("could not get user %v from the database\n%v", req.Username, err)
+			utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = t.db.GetTeamMember(caller.Team, req.Username)
+		if err == nil {
+			utils.SendError(w, fmt.Sprintf("User %v is already a member of team %v", req.Username, caller.Team), http.StatusConflict)
+			return
+		} else if !storage.IsNotFound(err) {
+			log.Printf("could not get member %v of team %v from the database\n%v", req.Username, caller.Team, err)
+			utils.SendError(w, "Error getting team member from database", http.StatusInternalServerError)
+			return
+		}
+
+		if invitee.EmailVerified {
+			to = invitee.Email
+		}
+	}
+
+	id, err := newTokenID()
+	if err != nil {
+		log.Printf("could not generate team invitation id\n%v", err)
+		utils.SendError(w, "Error generating invitation", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	invitation := models.TeamInvitation{
+		ID:        id,
+		Team:      caller.Team,
+		Username:  req.Username,
+		Email:     strings.ToLower(req.Email),
+		Role:      req.Role,
+		InvitedBy: caller.Username,
+		Created:   now,
+		Expires:   now.Add(teamInvitationExpiryTime),
+	}
+
+	err = t.db.CreateTeamInvitation(&invitation)
+	if err != nil {
+		log.Printf("could not insert invitation to team %v into database\n%v", caller.Team, err)
+		utils.SendError(w, "Error inserting invitation into database", http.StatusInternalServerError)
+		return
+	}
+
+	if to != "" {
+		sendMail(t.mailer, mail.Message{
+			To:      to,
+			Subject: fmt.Sprintf("You have been invited to join %v", caller.Team),
+			Body: fmt.Sprintf("Hi,\n\n%v has invited you to join the team %v as a %v. Sign in within 7 days "+
+				"to accept the invitation.\n\n%v\n\nIf you do not have an account yet, create one with this email "+
+				"address and verify it first.\n", caller.Username, caller.Team, req.Role, t.appURL+"/invitations"),
+		})
+	}
+
+	utils.SendSuccess(w, invitation, http.StatusCreated)
+}
+
+func (t *teamController) GetTeamInvitations(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireTeamRole(t.db, w, r, models.TeamOwnerRole)
+	if !ok {
+		return
+	}
+
+	invitations, err := t.db.GetTeamInvitations(caller.Team)
+	if err != nil {
+		log.Printf("could not get invitations to team %v from the database\n%v", caller.Team, err)
+		utils.SendError(w, "Error getting invitations from database", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, invitations, http.StatusOK)
+}
+
+func (t *teamController) DeleteTeamInvitation(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireTeamRole(t.db, w, r, models.TeamOwnerRole)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	err := t.db.DeleteTeamInvitation(caller.Team, id)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Invitation %v not found", id), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not delete team invitation %v\n%v", id, err)
+		utils.SendError(w, "Error deleting invitation", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+// GetUserInvitations lists the invitations addressed to the user, including
+// those sent to their email address once it is verified.
+func (t *teamController) GetUserInvitations(w http.ResponseWriter, r *http.Request) {
+	user, ok := t.getUser(w, r)
+	if !ok {
+		return
+	}
+
+	email := ""
+	if user.EmailVerified {
+		email = strings.ToLower(user.Email)
+	}
+
+	invitations, err := t.db.GetUserInvitations(user.Username, email)
+	if err != nil {
+		log.Printf("could not get invitations of user %v from the database\n%v", user.Username, err)
+		utils.SendError(w, "Error getting invitations from database", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, invitations, http.StatusOK)
+}
+
+// PostUserInvitation accepts an invitation, adding the user to the team.
+func (t *teamController) PostUserInvitation(w http.ResponseWriter, r *http.Request) {
+	user, invitation, ok := t.getUserInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	err := t.db.AcceptTeamInvitation(invitation.ID, user.Username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Invitation %v not found", invitation.ID), http.StatusNotFound)
+		return
+	} else if storage.IsAlreadyExists(err) {
+		utils.SendError(w, fmt.Sprintf("Already a member of team %v", invitation.Team), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("could not accept team invitation %v\n%v", invitation.ID, err)
+		utils.SendError(w, "Error accepting invitation", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, models.TeamMember{
+		Team:     invitation.Team,
+		Username: user.Username,
+		Role:     invitation.Role,
+		Joined:   time.Now().UTC().Truncate(time.Second),
+	}, http.StatusOK)
+}
+
+// DeleteUserInvitation declines an invitation.
+func (t *teamController) DeleteUserInvitation(w http.ResponseWriter, r *http.Request) {
+	_, invitation, ok := t.getUserInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	err := t.db.DeleteTeamInvitation(invitation.Team, invitation.ID)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Invitation %v not found", invitation.ID), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not delete team invitation %v\n%v", invitation.ID, err)
+		utils.SendError(w, "Error deleting invitation", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+func (t *teamController) getUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := t.db.GetUser(username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("User %v not found", username), http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("could not get user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// getUserInvitation loads the invitation named by the {id} route variable,
+// writing an error response and returning false if it does not exist or is not
+// addressed to the {username} route variable or their verified email address.
+func (t *teamController) getUserInvitation(w http.ResponseWriter, r *http.Request) (*models.User, *models.TeamInvitation, bool) {
+	user, ok := t.getUser(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	id := mux.Vars(r)["id"]
+	invitation, err := t.db.GetTeamInvitation(id)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Invitation %v not found", id), http.StatusNotFound)
+		return nil, nil, false
+	} else if err != nil {
+		log.Printf("could not get team invitation %v from the database\n%v", id, err)
+		utils.SendError(w, "Error getting invitation from database", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	addressed := invitation.Username == user.Username ||
+		(invitation.Email != "" && user.EmailVerified && strings.EqualFold(invitation.Email, user.Email))
+	if !addressed {
+		utils.SendError(w, fmt.Sprintf("Invitation %v not found", id), http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	return user, invitation, true
+}
+
+// requireTeamRole loads the caller's membership of the team named by the
+// {team} route variable, writing an error response and returning false unless
+// they hold at least the given role. Callers outside the team get the same
+// response as for a missing team, so team names cannot be probed.
+func requireTeamRole(db storage.DB, w http.ResponseWriter, r *http.Request, role string) (*models.TeamMember, bool) {
+	team := mux.Vars(r)["team"]
+	if team == "" {
+		utils.SendError(w, "Team required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	member, err := db.GetTeamMember(team, Principal(r).Username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("Team %v not found", team), http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("could not get member %v of team %v from the database\n%v", Principal(r).Username, team, err)
+		utils.SendError(w, "Error getting team member from database", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if teamRoleRanks[member.Role] < teamRoleRanks[role] {
+		utils.SendError(w, fmt.Sprintf("Requires the %v role in team %v", role, team), http.StatusForbidden)
+		return nil, false
+	}
+
+	return member, true
+}
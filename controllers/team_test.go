@@ -0,0 +1,183 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rss-creator/models"
+)
+
+// createTeam creates a team owned by the user with the given access token.
+func (s *testServer) createTeam(accessToken string, name string) {
+	w := s.do(http.MethodPost, "/v1/teams", bearer(accessToken), `{"name": "`+name+`", "title": "Team"}`, nil)
+	if w.Code != http.StatusCreated {
+		s.t.Fatalf("could not create team %v: %v %v", name, w.Code, w.Body)
+	}
+}
+
+func TestTeamRouteScopes(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+	s.createTeam(login.AccessToken, "writers")
+
+	var key models.APIKey
+	w := s.do(http.MethodPost, "/v1/users/alice/keys", bearer(login.AccessToken), `{"name": "reader", "scopes": ["feeds:read"]}`, &key)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("creating a key returned %v %v", w.Code, w.Body)
+	}
+	apiKey := map[string]string{"Authorization": "ApiKey " + key.Key}
+
+	// reading a team only takes the read scope, but managing it takes
+	// account:admin
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{http.MethodGet, "/v1/teams/writers", "", http.StatusOK},
+		{http.MethodGet, "/v1/teams/writers/members", "", http.StatusOK},
+		{http.MethodGet, "/v1/teams/writers/invitations", "", http.StatusOK},
+		{http.MethodGet, "/v1/users/alice/teams", "", http.StatusOK},
+		{http.MethodGet, "/v1/users/alice/invitations", "", http.StatusOK},
+		{http.MethodPost, "/v1/teams", `{"name": "readers"}`, http.StatusForbidden},
+		{http.MethodPut, "/v1/teams/writers/members/alice", `{"role": "member"}`, http.StatusForbidden},
+		{http.MethodDelete, "/v1/teams/writers/members/alice", "", http.StatusForbidden},
+		{http.MethodPost, "/v1/teams/writers/invitations", `{"username": "bob"}`, http.StatusForbidden},
+		{http.MethodDelete, "/v1/teams/writers", "", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		if w := s.do(test.method, test.path, apiKey, test.body, nil); w.Code != test.want {
+			t.Errorf("%v %v with a feeds:read key returned %v %v, want %v", test.method, test.path, w.Code, w.Body, test.want)
+		}
+	}
+}
+
+// joinTeam invites the user to the team with the role and accepts the
+// invitation on their behalf.
+func (s *testServer) joinTeam(ownerToken string, team string, username string, role string, accessToken string) {
+	var invitation models.TeamInvitation
+	body := `{"username": "` + username + `", "role": "` + role + `"}`
+	if w := s.do(http.MethodPost, "/v1/teams/"+team+"/invitations", bearer(ownerToken), body, &invitation); w.Code != http.StatusCreated {
+		s.t.Fatalf("could not invite %v to team %v: %v %v", username, team, w.Code, w.Body)
+	}
+	if w := s.do(http.MethodPost, "/v1/users/"+username+"/invitations/"+invitation.ID, bearer(accessToken), "", nil); w.Code != http.StatusOK {
+		s.t.Fatalf("could not accept invitation of %v to team %v: %v %v", username, team, w.Code, w.Body)
+	}
+}
+
+func TestTeamRoles(t *testing.T) {
+	s := newTestServer(t)
+	logins := map[string]tokens{}
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		s.createUser(username)
+		logins[username] = s.login(username, nil)
+	}
+	s.createTeam(logins["alice"].AccessToken, "writers")
+	s.joinTeam(logins["alice"].AccessToken, "writers", "bob", models.TeamMaintainerRole, logins["bob"].AccessToken)
+	s.joinTeam(logins["alice"].AccessToken, "writers", "carol", models.TeamMemberRole, logins["carol"].AccessToken)
+
+	tests := []struct {
+		username string
+		method   string
+		path     string
+		body     string
+		want     int
+	}{
+		// outsiders cannot tell the team exists
+		{"dave", http.MethodGet, "/v1/teams/writers", "", http.StatusNotFound},
+		{"dave", http.MethodGet, "/v1/teams/writers/feeds", "", http.StatusNotFound},
+
+		// members read
+		{"carol", http.MethodGet, "/v1/teams/writers", "", http.StatusOK},
+		{"carol", http.MethodGet, "/v1/teams/writers/members", "", http.StatusOK},
+		{"carol", http.MethodGet, "/v1/teams/writers/feeds", "", http.StatusOK},
+		{"carol", http.MethodPost, "/v1/teams/writers/feeds", testFeed, http.StatusForbidden},
+
+		// maintainers write feeds
+		{"bob", http.MethodPost, "/v1/teams/writers/feeds", testFeed, http.StatusCreated},
+		{"bob", http.MethodPut, "/v1/teams/writers/members/carol", `{"role": "maintainer"}`, http.StatusForbidden},
+		{"bob", http.MethodDelete, "/v1/teams/writers/members/carol", "", http.StatusForbidden},
+		{"bob", http.MethodPost, "/v1/teams/writers/invitations", `{"username": "dave", "role": "member"}`, http.StatusForbidden},
+		{"bob", http.MethodDelete, "/v1/teams/writers", "", http.StatusForbidden},
+
+		// owners manage members
+		{"alice", http.MethodPut, "/v1/teams/writers/members/carol", `{"role": "maintainer"}`, http.StatusOK},
+		{"alice", http.MethodPut, "/v1/teams/writers/members/carol", `{"role": "admin"}`, http.StatusBadRequest},
+		{"alice", http.MethodPut, "/v1/teams/writers/members/dave", `{"role": "member"}`, http.StatusNotFound},
+		{"alice", http.MethodPut, "/v1/teams/writers/members/alice", `{"role": "member"}`, http.StatusBadRequest},
+
+		// anyone can leave, but only owners remove others
+		{"carol", http.MethodDelete, "/v1/teams/writers/members/bob", "", http.StatusForbidden},
+		{"carol", http.MethodDelete, "/v1/teams/writers/members/carol", "", http.StatusNoContent},
+		{"alice", http.MethodDelete, "/v1/teams/writers/members/bob", "", http.StatusNoContent},
+	}
+	for _, test := range tests {
+		w := s.do(test.method, test.path, bearer(logins[test.username].AccessToken), test.body, nil)
+		if w.Code != test.want {
+			t.Errorf("%v %v by %v returned %v %v, want %v", test.method, test.path, test.username, w.Code, w.Body, test.want)
+		}
+	}
+
+	members, err := s.db.GetTeamMembers("writers")
+	if err != nil {
+		t.Fatalf("could not get team members: %v", err)
+	}
+	if len(members) != 1 || members[0].Username != "alice" || members[0].Role != models.TeamOwnerRole {
+		t.Errorf("team has members %+v, want alice alone as owner", members)
+	}
+}
+
+func TestLeaveTeamSuccessor(t *testing.T) {
+	s := newTestServer(t)
+	logins := map[string]tokens{}
+	for _, username := range []string{"alice", "aaron", "bob"} {
+		s.createUser(username)
+		logins[username] = s.login(username, nil)
+	}
+	s.createTeam(logins["alice"].AccessToken, "writers")
+	s.joinTeam(logins["alice"].AccessToken, "writers", "aaron", models.TeamMemberRole, logins["aaron"].AccessToken)
+	s.joinTeam(logins["alice"].AccessToken, "writers", "bob", models.TeamMaintainerRole, logins["bob"].AccessToken)
+
+	var feed models.Feed
+	if w := s.do(http.MethodPost, "/v1/teams/writers/feeds", bearer(logins["alice"].AccessToken), testFeed, &feed); w.Code != http.StatusCreated {
+		t.Fatalf("creating a team feed returned %v %v", w.Code, w.Body)
+	}
+
+	leave := func(username string) {
+		path := "/v1/teams/writers/members/" + username
+		if w := s.do(http.MethodDelete, path, bearer(logins[username].AccessToken), "", nil); w.Code != http.StatusNoContent {
+			t.Fatalf("%v leaving the team returned %v %v", username, w.Code, w.Body)
+		}
+	}
+	successor := func(want string) {
+		member, err := s.db.GetTeamMember("writers", want)
+		if err != nil || member.Role != models.TeamOwnerRole {
+			t.Errorf("%v is %+v with error %v, want them to own the team", want, member, err)
+		}
+		got, err := s.db.GetFeed(feed.ID)
+		if err != nil {
+			t.Fatalf("could not get feed: %v", err)
+		}
+		if got.Owner != want || got.Team != "writers" {
+			t.Errorf("team feed is owned by %v in team %q, want %v in writers", got.Owner, got.Team, want)
+		}
+	}
+
+	// the last owner leaving hands the team and their feeds to the most
+	// senior member, maintainers before members whatever their names
+	leave("alice")
+	successor("bob")
+	leave("bob")
+	successor("aaron")
+
+	// and the last member leaving deletes the team with its feeds
+	leave("aaron")
+	if w := s.do(http.MethodGet, "/v1/teams/writers", bearer(logins["aaron"].AccessToken), "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("getting the team after everyone left returned %v, want 404", w.Code)
+	}
+	if _, err := s.db.GetFeed(feed.ID); err == nil {
+		t.Errorf("team feed still exists after everyone left")
+	}
+}
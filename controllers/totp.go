@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+	"github.com/rss-creator/utils"
+)
+
+const (
+	totpIssuer = "rss-creator"
+	totpPeriod = 30
+	// totpSkew is the number of time steps either side of the current one
+	// whose codes are accepted, to allow for clock drift
+	totpSkew = 1
+
+	qrCodeSize        = 256
+	recoveryCodeCount = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type totpEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// provisioning uri encoded in QRCode
+	URI    string `json:"uri"`
+	QRCode string `json:"qrCode"`
+}
+
+type totpVerifyRequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// PostTOTP starts enrolling the user in two-factor authentication, replacing
+// any enrollment that has not been verified yet. Two-factor authentication is
+// only enforced once PostTOTPVerify succeeds.
+func (a *authController) PostTOTP(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := a.db.GetTOTP(username)
+	if err == nil && existing.Enabled {
+		utils.SendError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	} else if err != nil && !storage.IsNotFound(err) {
+		log.Printf("could not get totp of user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting two-factor authentication from database", http.StatusInternalServerError)
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: username,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		log.Printf("could not generate totp secret\n%v", err)
+		utils.SendError(w, "Error generating two-factor secret", http.StatusInternalServerError)
+		return
+	}
+
+	qrCode, err := qrCodeDataURI(key)
+	if err != nil {
+		log.Printf("could not render totp qr code\n%v", err)
+		utils.SendError(w, "Error generating two-factor secret", http.StatusInternalServerError)
+		return
+	}
+
+	err = a.db.SetTOTP(&models.TOTP{Username: username, Secret: key.Secret()})
+	if err != nil {
+		log.Printf("could not store totp secret of user %v\n%v", username, err)
+		utils.SendError(w, "Error storing two-factor secret", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, totpEnrollment{key.Secret(), key.URL(), qrCode}, http.StatusOK)
+}
+
+// PostTOTPVerify enables two-factor authentication once the user proves they
+// can generate codes, and returns their single-use recovery codes. This is the
+// only time the recovery codes are shown.
+func (a *authController) PostTOTPVerify(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	var req totpVerifyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		utils.SendError(w, "Body with code required", http.StatusBadRequest)
+		return
+	}
+
+	t, err := a.db.GetTOTP(username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, "Two-factor authentication enrollment not started", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not get totp of user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting two-factor authentication from database", http.StatusInternalServerError)
+		return
+	}
+
+	if t.Enabled {
+		utils.SendError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	ok, err := a.checkTOTPCode(t, req.Code)
+	if err != nil {
+		log.Printf("could not check totp code of user %v\n%v", username, err)
+		utils.SendError(w, "Error checking code", http.StatusInternalServerError)
+		return
+	} else if !ok {
+		utils.SendError(w, "Code incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			log.Printf("could not generate recovery code\n%v", err)
+			utils.SendError(w, "Error generating recovery codes", http.StatusInternalServerError)
+			return
+		}
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	err = a.db.EnableTOTP(username, hashes)
+	if err != nil {
+		log.Printf("could not enable totp of user %v\n%v", username, err)
+		utils.SendError(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, recoveryCodes{codes}, http.StatusOK)
+}
+
+// DeleteTOTP disables two-factor authentication. A current code or recovery
+// code is required in the Otp header, so a stolen access token alone cannot
+// remove the second factor. Wrong codes count as failed logins, so guessing
+// codes here is throttled along with logins.
+func (a *authController) DeleteTOTP(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	t, err := a.db.GetTOTP(username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, "Two-factor authentication is not enabled", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not get totp of user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting two-factor authentication from database", http.StatusInternalServerError)
+		return
+	}
+
+	if t.Enabled {
+		code := r.Header.Get("Otp")
+		if code == "" {
+			utils.SendError(w, "Valid code required in Otp header", http.StatusUnauthorized)
+			return
+		}
+
+		attempt, wait, err := a.reserveLoginAttempt(username, clientIP(r), otpFailure)
+		if err != nil {
+			log.Printf("could not check login failures of user %v\n%v", username, err)
+			utils.SendError(w, "Error checking login attempts", http.StatusInternalServerError)
+			return
+		} else if wait > 0 {
+			w.Header().Set("Retry-After", retryAfter(wait))
+			utils.SendError(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+		defer attempt.finish()
+
+		ok, err := a.checkSecondFactor(t, code)
+		if err != nil {
+			log.Printf("could not check second factor of user %v\n%v", username, err)
+			utils.SendError(w, "Error checking code", http.StatusInternalServerError)
+			return
+		} else if !ok {
+			if err := attempt.fail(otpFailure); err != nil {
+				log.Printf("could not record login failure of user %v\n%v", username, err)
+			}
+			utils.SendError(w, "Valid code required in Otp header", http.StatusUnauthorized)
+			return
+		}
+
+		err = a.db.ClearLoginFailures(username)
+		if err != nil {
+			log.Printf("could not clear login failures of user %v\n%v", username, err)
+		}
+	}
+
+	err = a.db.DeleteTOTP(username)
+	if err != nil && !storage.IsNotFound(err) {
+		log.Printf("could not delete totp of user %v\n%v", username, err)
+		utils.SendError(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccess(w, nil, http.StatusNoContent)
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code, which is used up.
+func (a *authController) checkSecondFactor(t *models.TOTP, code string) (bool, error) {
+	if code == "" {
+		return false, nil
+	}
+
+	if len(code) == otp.DigitsSix.Length() {
+		return a.checkTOTPCode(t, code)
+	}
+
+	return a.db.UseRecoveryCode(t.Username, hashRecoveryCode(code))
+}
+
+// checkTOTPCode checks the code against the steps around the current time, and
+// records the matching step so the same code cannot be used twice.
+func (a *authController) checkTOTPCode(t *models.TOTP, code string) (bool, error) {
+	now := time.Now()
+	opts := totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		at := now.Add(time.Duration(offset*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(t.Secret, at, opts)
+		if err != nil {
+			return false, err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return a.db.UseTOTPStep(t.Username, at.Unix()/totpPeriod)
+		}
+	}
+
+	return false, nil
+}
+
+func qrCodeDataURI(key *otp.Key) (string, error) {
+	img, err := key.Image(qrCodeSize, qrCodeSize)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// newRecoveryCode generates a code such as "abcd-efgh-ijkl-mnop".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+	return fmt.Sprintf("%v-%v-%v-%v", code[0:4], code[4:8], code[8:12], code[12:16]), nil
+}
+
+// hashRecoveryCode hashes a recovery code for storage, ignoring the case and
+// separators it was typed with.
+func hashRecoveryCode(code string) string {
+	return hashToken(strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code)))
+}
@@ -0,0 +1,101 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{Period: 30, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1})
+	if err != nil {
+		t.Fatalf("could not generate code: %v", err)
+	}
+	return code
+}
+
+// enableTOTP enrolls the user in two-factor authentication with a code for
+// the current time step, and returns their secret, that code and their
+// recovery codes.
+func enableTOTP(t *testing.T, s *testServer, username string, accessToken string) (string, string, []string) {
+	var enrollment struct{ Secret string }
+	w := s.do(http.MethodPost, "/v1/users/"+username+"/totp", bearer(accessToken), "", &enrollment)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enrolling returned %v %v", w.Code, w.Body)
+	}
+
+	var recovery struct{ RecoveryCodes []string }
+	code := totpCode(t, enrollment.Secret, time.Now())
+	body := `{"code": "` + code + `"}`
+	w = s.do(http.MethodPost, "/v1/users/"+username+"/totp/verify", bearer(accessToken), body, &recovery)
+	if w.Code != http.StatusOK {
+		t.Fatalf("verifying enrollment returned %v %v", w.Code, w.Body)
+	}
+	return enrollment.Secret, code, recovery.RecoveryCodes
+}
+
+func TestTOTPReplay(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	secret, verified, recoveryCodes := enableTOTP(t, s, "alice", s.login("alice", nil).AccessToken)
+
+	authorize := func(code string) int {
+		return s.do(http.MethodGet, "/v1/users/alice/authorize", withPassword(map[string]string{"Otp": code}), "", nil).Code
+	}
+
+	if code := authorize(""); code != http.StatusUnauthorized {
+		t.Errorf("login without a code returned %v, want 401", code)
+	}
+
+	// the code that verified the enrollment has been used up
+	if code := authorize(verified); code != http.StatusUnauthorized {
+		t.Errorf("login with the code used to verify enrollment returned %v, want 401", code)
+	}
+
+	// the next step's code is accepted to allow for clock drift, but only once
+	next := totpCode(t, secret, time.Now().Add(30*time.Second))
+	if code := authorize(next); code != http.StatusOK {
+		t.Errorf("login with a fresh code returned %v, want 200", code)
+	}
+	if code := authorize(next); code != http.StatusUnauthorized {
+		t.Errorf("login replaying a code returned %v, want 401", code)
+	}
+
+	if code := authorize(recoveryCodes[0]); code != http.StatusOK {
+		t.Errorf("login with a recovery code returned %v, want 200", code)
+	}
+	if code := authorize(recoveryCodes[0]); code != http.StatusUnauthorized {
+		t.Errorf("login replaying a recovery code returned %v, want 401", code)
+	}
+}
+
+func TestDisableTOTPThrottled(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+	login := s.login("alice", nil)
+	secret, _, _ := enableTOTP(t, s, "alice", login.AccessToken)
+
+	header := func(code string) map[string]string {
+		h := bearer(login.AccessToken)
+		h["Otp"] = code
+		return h
+	}
+
+	for i := 0; i < 5; i++ {
+		if w := s.do(http.MethodDelete, "/v1/users/alice/totp", header("000000"), "", nil); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %v returned %v %v, want 401", i+1, w.Code, w.Body)
+		}
+	}
+
+	// wrong codes count as failed logins, so guessing is throttled
+	w := s.do(http.MethodDelete, "/v1/users/alice/totp", header(totpCode(t, secret, time.Now().Add(30*time.Second))), "", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("disabling after 5 wrong codes returned %v %v, want 429", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice/authorize", withPassword(nil), "", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("login after 5 wrong codes returned %v %v, want 429", w.Code, w.Body)
+	}
+}
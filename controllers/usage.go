@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/quota"
+	"github.com/rss-creator/storage"
+	"github.com/rss-creator/utils"
+)
+
+type UsageController interface {
+	GetUsage(w http.ResponseWriter, r *http.Request)
+}
+
+type usageController struct {
+	db    storage.DB
+	plans quota.Plans
+}
+
+// userQuota is a user's usage along with the limits of their plan. Scrape
+// counts start over at Resets.
+type userQuota struct {
+	Plan   string        `json:"plan"`
+	Limits quota.Plan    `json:"limits"`
+	Usage  *models.Usage `json:"usage"`
+	Resets time.Time     `json:"resets"`
+}
+
+func NewUsageController(db storage.DB, plans quota.Plans) UsageController {
+	return &usageController{db, plans}
+}
+
+func (u *usageController) GetUsage(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == "" {
+		utils.SendError(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	q, ok := getQuota(u.db, u.plans, w, username)
+	if !ok {
+		return
+	}
+
+	utils.SendSuccess(w, q, http.StatusOK)
+}
+
+// getQuota loads the user's plan and current usage, writing an error response
+// and returning false if either cannot be loaded.
+func getQuota(db storage.DB, plans quota.Plans, w http.ResponseWriter, username string) (*userQuota, bool) {
+	user, err := db.GetUser(username)
+	if storage.IsNotFound(err) {
+		utils.SendError(w, fmt.Sprintf("User %v not found", username), http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("could not get user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting user from database", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	usage, err := db.GetUsage(username, time.Now())
+	if err != nil {
+		log.Printf("could not get usage of user %v from the database\n%v", username, err)
+		utils.SendError(w, "Error getting usage from database", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return &userQuota{
+		Plan:   user.Plan,
+		Limits: plans.Limits(user.Plan),
+		Usage:  usage,
+		Resets: usage.Day.Add(24 * time.Hour),
+	}, true
+}
@@ -0,0 +1,53 @@
+package controllers_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/quota"
+)
+
+const testFeed = `{"title": "Feed", "sourceUrl": "http://localhost/", "rules": {"item": {"selector": "div"}, "title": {"selector": "h2"}}}`
+
+func TestFeedLimit(t *testing.T) {
+	s := newTestServerWithPlans(t, quota.Plans{models.DefaultPlan: {Feeds: 3}})
+	s.createUser("alice")
+	login := s.login("alice", nil)
+
+	// every request races to create a feed, but only the limit may succeed
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- s.do(http.MethodPost, "/v1/users/alice/feeds", bearer(login.AccessToken), testFeed, nil).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusForbidden:
+		default:
+			t.Errorf("creating a feed returned %v, want 201 or 403", code)
+		}
+	}
+	if created != 3 {
+		t.Errorf("created %v feeds, want the limit of 3", created)
+	}
+
+	var usage struct{ Usage models.Usage }
+	if w := s.do(http.MethodGet, "/v1/users/alice/usage", bearer(login.AccessToken), "", &usage); w.Code != http.StatusOK {
+		t.Fatalf("getting usage returned %v %v", w.Code, w.Body)
+	}
+	if usage.Usage.Feeds != 3 {
+		t.Errorf("usage counts %v feeds, want 3", usage.Usage.Feeds)
+	}
+}
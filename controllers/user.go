@@ -9,6 +9,7 @@ import (
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/rss-creator/mail"
 	"github.com/rss-creator/models"
 	"github.com/rss-creator/storage"
 	"github.com/rss-creator/utils"
@@ -24,14 +25,21 @@ type UserController interface {
 	GetUserExists(w http.ResponseWriter, r *http.Request)
 	PutUser(w http.ResponseWriter, r *http.Request)
 	DeleteUser(w http.ResponseWriter, r *http.Request)
+	PostEmailVerification(w http.ResponseWriter, r *http.Request)
+	PostVerifyEmail(w http.ResponseWriter, r *http.Request)
+	PostForgotPassword(w http.ResponseWriter, r *http.Request)
+	PostResetPassword(w http.ResponseWriter, r *http.Request)
 }
 
 type userController struct {
-	db storage.DB
+	db     storage.DB
+	mailer mail.Mailer
+	// appURL is the web app that links in emails point to
+	appURL string
 }
 
-func NewUserController(db storage.DB) UserController {
-	return &userController{db}
+func NewUserController(db storage.DB, mailer mail.Mailer, appURL string) UserController {
+	return &userController{db, mailer, appURL}
 }
 
 func (u *userController) PostUser(w http.ResponseWriter, r *http.Request) {
@@ -55,6 +63,7 @@ func (u *userController) PostUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user.EmailVerified = false
 	err = u.db.CreateUser(&user)
 	if err != nil {
 		log.Printf("could not insert user %v into database\n%v", user, err)
@@ -62,6 +71,12 @@ func (u *userController) PostUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.Email != "" {
+		if err := u.sendVerification(&user); err != nil {
+			log.Printf("could not send verification email to user %v\n%v", user.Username, err)
+		}
+	}
+
 	utils.SendSuccess(w, nil, http.StatusNoContent)
 }
 
@@ -141,6 +156,13 @@ func (u *userController) PutUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.Email != "" {
+		user.Username = username
+		if err := u.sendVerification(&user); err != nil {
+			log.Printf("could not send verification email to user %v\n%v", username, err)
+		}
+	}
+
 	utils.SendSuccess(w, nil, http.StatusNoContent)
 }
 
@@ -0,0 +1,73 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rss-creator/models"
+)
+
+func TestUserLifecycle(t *testing.T) {
+	s := newTestServer(t)
+
+	exists := func() bool {
+		var resp map[string]bool
+		if w := s.do(http.MethodGet, "/v1/users/exists?username=alice", nil, "", &resp); w.Code != http.StatusOK {
+			t.Fatalf("checking whether alice exists returned %v %v", w.Code, w.Body)
+		}
+		return resp["exists"]
+	}
+
+	if exists() {
+		t.Fatalf("alice exists before being created")
+	}
+	s.createUser("alice")
+	if !exists() {
+		t.Fatalf("alice does not exist after being created")
+	}
+
+	login := s.login("alice", nil)
+	var user models.User
+	if w := s.do(http.MethodGet, "/v1/users/alice", bearer(login.AccessToken), "", &user); w.Code != http.StatusOK {
+		t.Fatalf("getting alice returned %v %v", w.Code, w.Body)
+	}
+	if user.Username != "alice" || user.Email != "alice@example.com" || user.Password != "" {
+		t.Errorf("got user %+v, want alice without her password", user)
+	}
+
+	if w := s.do(http.MethodDelete, "/v1/users/alice", bearer(login.AccessToken), "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("deleting alice returned %v %v", w.Code, w.Body)
+	}
+	if exists() {
+		t.Errorf("alice exists after being deleted")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice")
+
+	if w := s.do(http.MethodGet, "/v1/users/alice/authorize", nil, "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("login without a password returned %v %v, want 400", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice/authorize", map[string]string{"Password": "wrong password"}, "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password returned %v %v, want 401", w.Code, w.Body)
+	}
+
+	login := s.login("alice", nil)
+	if login.AccessToken == "" || login.RefreshToken == "" {
+		t.Fatalf("login returned tokens %+v, want an access and a refresh token", login)
+	}
+
+	var refreshed tokens
+	if w := s.do(http.MethodGet, "/v1/users/alice/token", bearer(login.RefreshToken), "", &refreshed); w.Code != http.StatusOK {
+		t.Fatalf("exchanging the refresh token returned %v %v", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodGet, "/v1/users/alice", bearer(refreshed.AccessToken), "", nil); w.Code != http.StatusOK {
+		t.Errorf("refreshed access token returned %v %v", w.Code, w.Body)
+	}
+
+	if w := s.do(http.MethodGet, "/v1/users/alice", nil, "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("getting a user without a token returned %v %v, want 401", w.Code, w.Body)
+	}
+}
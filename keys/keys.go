@@ -0,0 +1,163 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// DefaultKeyID names the key built from the legacy server.jwtSecret setting.
+// Tokens issued before key ids existed have no kid header and are verified
+// with it.
+const DefaultKeyID = "default"
+
+// Config describes one signing key. HMAC algorithms take a Secret, while
+// RS256, RS384, RS512 and EdDSA take the Path of a PEM encoded key. A PEM
+// public key can verify tokens but not sign them, which is how retired keys
+// are kept around until the tokens they signed have expired.
+type Config struct {
+	ID        string `mapstructure:"id"`
+	Algorithm string `mapstructure:"algorithm"`
+	Secret    string `mapstructure:"secret"`
+	Path      string `mapstructure:"path"`
+}
+
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// signing is nil for verification only keys
+	signing   interface{}
+	verifying interface{}
+}
+
+// KeySet holds every key tokens may be verified with, and the active key new
+// tokens are signed with.
+type KeySet struct {
+	keys   map[string]*Key
+	active *Key
+}
+
+func NewKeySet(configs []Config, activeID string) (*KeySet, error) {
+	set := &KeySet{keys: map[string]*Key{}}
+	for _, c := range configs {
+		if _, ok := set.keys[c.ID]; ok || c.ID == "" {
+			return nil, fmt.Errorf("key ids must be unique and non empty, got %q", c.ID)
+		}
+
+		k, err := loadKey(c)
+		if err != nil {
+			return nil, fmt.Errorf("could not load key %v\n%v", c.ID, err)
+		}
+		set.keys[c.ID] = k
+	}
+
+	active, ok := set.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %v is not configured", activeID)
+	}
+	if active.signing == nil {
+		return nil, fmt.Errorf("active key %v has no private key", activeID)
+	}
+	set.active = active
+
+	return set, nil
+}
+
+// Sign signs the claims with the active key, naming it in the kid header.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.signing)
+}
+
+// KeyFunc finds the key a token was signed with for jwt.Parse. The token must
+// use the algorithm configured for that key, so a public key can never be
+// used as an HMAC secret.
+func (s *KeySet) KeyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = DefaultKeyID
+	}
+
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %v", kid)
+	}
+
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("key %v does not use %v", kid, token.Method.Alg())
+	}
+
+	return k.verifying, nil
+}
+
+func loadKey(c Config) (*Key, error) {
+	method := jwt.GetSigningMethod(c.Algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported algorithm %v", c.Algorithm)
+	}
+	k := &Key{ID: c.ID, Method: method}
+
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		if c.Secret == "" {
+			return nil, fmt.Errorf("%v requires a secret", c.Algorithm)
+		}
+		k.signing = []byte(c.Secret)
+		k.verifying = k.signing
+		return k, nil
+	}
+
+	contents, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("%v is not PEM encoded", c.Path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %v", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if signer, ok := parsed.(crypto.Signer); ok {
+		k.signing = parsed
+		parsed = signer.Public()
+	}
+	k.verifying = parsed
+
+	switch method.(type) {
+	case *jwt.SigningMethodRSA:
+		_, ok := k.verifying.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%v requires an RSA key", c.Algorithm)
+		}
+	case *signingMethodEdDSA:
+		_, ok := k.verifying.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%v requires an Ed25519 key", c.Algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %v", c.Algorithm)
+	}
+
+	return k, nil
+}
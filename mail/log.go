@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// logMailer writes messages instead of sending them, for local development.
+type logMailer struct {
+	mu   sync.Mutex
+	from string
+	path string
+}
+
+func newLogMailer(config Config) (*logMailer, error) {
+	return &logMailer{from: config.From, path: config.Path}, nil
+}
+
+func (m *logMailer) Send(msg Message) error {
+	body, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	if m.path == "" {
+		log.Printf("mail to %v\n%s", msg.To, body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(body, "\r\n\r\n"...))
+	return err
+}
@@ -0,0 +1,70 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+const (
+	SMTP = "smtp"
+	Log  = "log"
+)
+
+// Config selects and configures a Mailer. Host, Port, Username and Password
+// are used by SMTP, while Path names the file the Log mailer appends to, or
+// is empty to write messages to the server log.
+type Config struct {
+	Type     string `mapstructure:"type"`
+	From     string `mapstructure:"from"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	Path     string `mapstructure:"path"`
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+func New(config Config) (Mailer, error) {
+	if config.From == "" {
+		return nil, errors.New("a from address is required")
+	}
+
+	switch config.Type {
+	case SMTP:
+		return newSMTPMailer(config)
+	case Log, "":
+		return newLogMailer(config)
+	}
+	return nil, fmt.Errorf("unsupported mailer type %v", config.Type)
+}
+
+// format renders the message as a plain text email.
+func format(from string, msg Message) ([]byte, error) {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return nil, errors.New("recipient and subject must be a single line")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %v\r\n", from)
+	fmt.Fprintf(&b, "To: %v\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes(), nil
+}
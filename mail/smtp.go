@@ -0,0 +1,60 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/smtp"
+)
+
+// smtpMailer delivers messages through an SMTP relay, authenticating when a
+// username is configured.
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+	// sender is the bare address of from, for the SMTP envelope
+	sender string
+}
+
+func newSMTPMailer(config Config) (*smtpMailer, error) {
+	if config.Host == "" {
+		return nil, errors.New("smtp mailer requires a host")
+	}
+
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address %v\n%v", config.From, err)
+	}
+
+	port := config.Port
+	if port == 0 {
+		port = 587
+	}
+
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	return &smtpMailer{
+		addr:   fmt.Sprintf("%v:%v", config.Host, port),
+		auth:   auth,
+		from:   config.From,
+		sender: from.Address,
+	}, nil
+}
+
+func (m *smtpMailer) Send(msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %v\n%v", msg.To, err)
+	}
+
+	body, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, m.sender, []string{to.Address}, body)
+}
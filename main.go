@@ -4,11 +4,17 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
 
 	"github.com/rss-creator/controllers"
+	"github.com/rss-creator/keys"
+	"github.com/rss-creator/mail"
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/quota"
+	"github.com/rss-creator/scheduler"
 	"github.com/rss-creator/server"
 	"github.com/rss-creator/storage"
 )
@@ -25,18 +31,99 @@ func main() {
 	cert := viper.GetString("server.cert")
 	key := viper.GetString("server.key")
 	jwtSecret := viper.GetString("server.jwtSecret")
+	activeKey := viper.GetString("server.activeKey")
 	allowedOrigins := viper.GetStringSlice("server.allowedOrigins")
 
+	appURL := viper.GetString("mail.appUrl")
+
+	schedulerWorkers := viper.GetInt("scheduler.workers")
+	schedulerPoll := viper.GetDuration("scheduler.poll")
+	fetchTimeout := viper.GetDuration("scheduler.timeout")
+
+	var keyConfigs []keys.Config
+	err := viper.UnmarshalKey("server.keys", &keyConfigs)
+	if err != nil {
+		log.Fatalf("error reading signing keys\n%v", err)
+	}
+	if jwtSecret != "" {
+		keyConfigs = append(keyConfigs, keys.Config{
+			ID:        keys.DefaultKeyID,
+			Algorithm: "HS512",
+			Secret:    jwtSecret,
+		})
+	}
+	if activeKey == "" {
+		activeKey = keys.DefaultKeyID
+	}
+
+	keySet, err := keys.NewKeySet(keyConfigs, activeKey)
+	if err != nil {
+		log.Fatalf("error loading signing keys\n%v", err)
+	}
+
+	var mailConfig mail.Config
+	err = viper.UnmarshalKey("mail", &mailConfig)
+	if err != nil {
+		log.Fatalf("error reading mail config\n%v", err)
+	}
+
+	mailer, err := mail.New(mailConfig)
+	if err != nil {
+		log.Fatalf("error creating mailer\n%v", err)
+	}
+
+	var plans quota.Plans
+	err = viper.UnmarshalKey("plans", &plans)
+	if err != nil {
+		log.Fatalf("error reading plans\n%v", err)
+	}
+
+	var oidcProvider *controllers.OIDCProvider
+	var oidcConfig controllers.OIDCConfig
+	err = viper.UnmarshalKey("oidc", &oidcConfig)
+	if err != nil {
+		log.Fatalf("error reading OpenID Connect config\n%v", err)
+	}
+	if oidcConfig.Issuer != "" {
+		oidcProvider, err = controllers.NewOIDCProvider(oidcConfig, &http.Client{Timeout: fetchTimeout})
+		if err != nil {
+			log.Fatalf("error loading OpenID Connect provider %v\n%v", oidcConfig.Issuer, err)
+		}
+	}
+
 	db, err := storage.GetDB(databaseType, databasePath)
 	if err != nil {
-		log.Fatal("error connecting to database\n%v", err)
+		log.Fatalf("error connecting to database\n%v", err)
+	}
+
+	// GetDB applies any pending migrations, so the migrate subcommand only
+	// needs to connect
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return
 	}
 
+	// the admin subcommand promotes an existing user, since only admins can
+	// change roles through the API
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		if len(os.Args) != 3 {
+			log.Fatalf("usage: %v admin <username>", os.Args[0])
+		}
+		promoteUser(db, os.Args[2])
+		return
+	}
+
+	s := scheduler.New(db, &http.Client{Timeout: fetchTimeout}, schedulerWorkers, schedulerPoll, plans)
+	s.Start()
+
 	r := mux.NewRouter()
-	uc := controllers.NewUserController(db)
-	ac := controllers.NewAuthController(db, jwtSecret)
-	sc := controllers.NewScraperController(&http.Client{})
-	server.Route(r.PathPrefix("/v1").Subrouter(), uc, ac, sc)
+	uc := controllers.NewUserController(db, mailer, appURL)
+	ac := controllers.NewAuthController(db, keySet, oidcProvider)
+	fc := controllers.NewFeedController(db, plans)
+	sc := controllers.NewScraperController(db, &http.Client{}, plans)
+	adc := controllers.NewAdminController(db, plans)
+	tc := controllers.NewTeamController(db, mailer, appURL)
+	usc := controllers.NewUsageController(db, plans)
+	server.Route(r.PathPrefix("/v1").Subrouter(), uc, ac, fc, sc, adc, tc, usc)
 
 	log.Printf("Listening on port %v", port)
 	log.Fatal(http.ListenAndServeTLS(":"+port, cert, key, corsMiddleware(r, allowedOrigins)))
@@ -52,6 +139,24 @@ func getConfig() {
 	}
 }
 
+func promoteUser(db storage.DB, username string) {
+	_, err := db.GetUser(username)
+	if err != nil {
+		log.Fatalf("error getting user %v\n%v", username, err)
+	}
+
+	err = db.UpdateUserAccess(username, models.AdminRole, false)
+	if err == nil {
+		// tokens carry the role they were issued with
+		err = db.RevokeAllTokens(username)
+	}
+	if err != nil {
+		log.Fatalf("error promoting user %v\n%v", username, err)
+	}
+
+	log.Printf("User %v is now an admin", username)
+}
+
 func contains(arr []string, val string) bool {
 	for _, v := range arr {
 		if v == val {
@@ -69,7 +174,7 @@ func corsMiddleware(h http.Handler, allowedOrigins []string) http.Handler {
 			return
 		}
 		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Password")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Password, Otp")
 		if r.Method == "OPTIONS" {
 			return
 		}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// APIKey is a long lived credential for scripts and feed readers that cannot
+// use the refresh token flow. Only a hash of the secret is stored, so Key is
+// set solely in the response to the key's creation. Scopes lists what the key
+// can be used for, and is never empty.
+type APIKey struct {
+	ID      string    `json:"id"`
+	Owner   string    `json:"owner"`
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Hash    string    `json:"-"`
+	Key     string    `json:"key,omitempty"`
+	Created time.Time `json:"created"`
+	// Expires is the zero time for keys that never expire
+	Expires  time.Time `json:"expires"`
+	LastUsed time.Time `json:"lastUsed"`
+}
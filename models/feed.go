@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Rule locates a single value in a scraped page. Mode picks how Selector is
+// interpreted: "css" (the default), "xpath", "regex" or "jsonpath". When Attr
+// is set the value is read from that attribute of the matched element, or that
+// member of the matched JSON object, instead of its text.
+type Rule struct {
+	Mode     string `json:"mode,omitempty"`
+	Selector string `json:"selector"`
+	Attr     string `json:"attr,omitempty"`
+}
+
+// ExtractionRules describe how to turn a page into feed items. Item selects
+// each entry on the page, and the remaining rules are evaluated relative to it.
+type ExtractionRules struct {
+	Item    Rule `json:"item"`
+	Title   Rule `json:"title"`
+	Link    Rule `json:"link"`
+	Date    Rule `json:"date"`
+	Summary Rule `json:"summary"`
+	Image   Rule `json:"image"`
+}
+
+// Feed is owned by a user, or by a team when Team is set. Owner of a team feed
+// is the member who created it, or the member it was handed to when they left.
+type Feed struct {
+	ID          int64           `json:"id"`
+	Owner       string          `json:"owner"`
+	Team        string          `json:"team,omitempty"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	SourceURL   string          `json:"sourceUrl"`
+	Rules       ExtractionRules `json:"rules"`
+	// Interval is the number of minutes between refreshes of the feed
+	Interval      int       `json:"interval"`
+	LastRefreshed time.Time `json:"lastRefreshed"`
+	NextRefresh   time.Time `json:"nextRefresh"`
+	LastError     string    `json:"lastError,omitempty"`
+	// Private feeds are only served to requests carrying Token, which readers
+	// that cannot send headers pass in the feed url
+	Private bool   `json:"private"`
+	Token   string `json:"token,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Identity links an account at an external OpenID Connect provider to a user.
+type Identity struct {
+	ID       int64     `json:"id"`
+	Username string    `json:"username"`
+	Issuer   string    `json:"issuer"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+// LoginState tracks an OpenID Connect login between redirecting to the
+// provider and its callback. Username is set when the login links a new
+// identity to that user instead of signing in.
+type LoginState struct {
+	Hash     string
+	Verifier string
+	Nonce    string
+	Username string
+	Expires  time.Time
+}
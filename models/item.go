@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type Item struct {
+	ID     int64 `json:"id"`
+	FeedID int64 `json:"feedId"`
+	// GUID identifies the item across refreshes of its feed, see scraper.GUID
+	GUID      string    `json:"guid"`
+	Title     string    `json:"title"`
+	Link      string    `json:"link"`
+	Summary   string    `json:"summary"`
+	Image     string    `json:"image,omitempty"`
+	Published time.Time `json:"published"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// LoginFailure records a failed login. Username is recorded even when no such
+// user exists, and Reason is the factor that was wrong, "password" or "otp".
+type LoginFailure struct {
+	ID        int64
+	Username  string
+	IP        string
+	Reason    string
+	Attempted time.Time
+}
+
+// LoginFailureCounts summarises the recent failures for a username and for an
+// IP address, along with the time of the latest failure of each.
+type LoginFailureCounts struct {
+	Username     int
+	UsernameLast time.Time
+	IP           int
+	IPLast       time.Time
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	TeamMemberRole     = "member"
+	TeamMaintainerRole = "maintainer"
+	TeamOwnerRole      = "owner"
+)
+
+// Team owns feeds that every member can read and that maintainers and owners
+// can edit. Owners also manage the team's members and invitations.
+type Team struct {
+	Name    string    `json:"name"`
+	Title   string    `json:"title"`
+	Created time.Time `json:"created"`
+}
+
+type TeamMember struct {
+	Team     string    `json:"team"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	Joined   time.Time `json:"joined"`
+}
+
+// TeamInvitation offers a role in a team either to a user, or to whoever has
+// verified that they own an email address.
+type TeamInvitation struct {
+	ID        string    `json:"id"`
+	Team      string    `json:"team"`
+	Username  string    `json:"username,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invitedBy"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
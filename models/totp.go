@@ -0,0 +1,11 @@
+package models
+
+// TOTP is a user's time based one-time password enrollment. It is not enabled
+// until the user has proven they can generate codes from Secret.
+type TOTP struct {
+	Username string
+	Secret   string
+	Enabled  bool
+	// LastStep is the time step of the last accepted code
+	LastStep int64
+}
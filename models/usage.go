@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Usage is what a user has stored, along with what they have fetched through
+// the scraper during the UTC day starting at Day.
+type Usage struct {
+	Feeds   int64     `json:"feeds"`
+	Items   int64     `json:"items"`
+	Scrapes int64     `json:"scrapes"`
+	Bytes   int64     `json:"bytes"`
+	Day     time.Time `json:"day"`
+}
@@ -1,8 +1,43 @@
 package models
 
+import "time"
+
+const (
+	UserRole  = "user"
+	AdminRole = "admin"
+
+	// DefaultPlan is the plan users are on until an admin moves them to
+	// another
+	DefaultPlan = "default"
+)
+
 type User struct {
-	Username          string `json:"username"`
-	Password          string `json:"password,omitempty"`
-	Email             string `json:"email"`
-	InvalidatedTokens bool   `json:"-"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email"`
+	// EmailVerified is reset whenever Email changes
+	EmailVerified bool `json:"emailVerified"`
+	// Role and Disabled can only be changed by an admin
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled"`
+	// Plan names the limits the user is held to, and can also only be
+	// changed by an admin
+	Plan string `json:"plan"`
+	// Created is the zero time for users created before it was recorded
+	Created time.Time `json:"created"`
+	// TokenGeneration is incremented to revoke every token issued so far
+	TokenGeneration int `json:"-"`
+}
+
+// UserQuery selects a page of users. Filters left as the zero value match
+// every user, while users without a Created time match neither created filter.
+// Sort names a field to order by, prefixed with '-' to reverse it.
+type UserQuery struct {
+	UsernamePrefix string    `query:"username"`
+	EmailDomain    string    `query:"emailDomain"`
+	CreatedAfter   time.Time `query:"createdAfter"`
+	CreatedBefore  time.Time `query:"createdBefore"`
+	Sort           string    `query:"sort"`
+	Offset         int       `query:"offset"`
+	Count          int       `query:"count"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+const (
+	VerifyEmailPurpose   = "verify-email"
+	ResetPasswordPurpose = "reset-password"
+	// OIDCSecondFactorPurpose tokens stand for an OpenID Connect sign in
+	// that is waiting for the user's second factor
+	OIDCSecondFactorPurpose = "oidc-second-factor"
+)
+
+// UserToken is a single use token handed to a user, such as an email
+// verification or password reset link. Only its hash is stored.
+type UserToken struct {
+	Hash     string
+	Username string
+	Purpose  string
+	// Email is the address a verification token was sent to
+	Email   string
+	Expires time.Time
+}
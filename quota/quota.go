@@ -0,0 +1,40 @@
+package quota
+
+import "github.com/rss-creator/models"
+
+// Plan limits what a user can store and fetch, where 0 means unlimited. Once
+// a user has more than Items items, those first seen longest ago are evicted
+// to make room for new ones. Scrapes and Bytes count requests made through the
+// scraper per UTC day.
+type Plan struct {
+	Feeds   int64 `json:"feeds" mapstructure:"feeds"`
+	Items   int64 `json:"items" mapstructure:"items"`
+	Scrapes int64 `json:"scrapes" mapstructure:"scrapes"`
+	Bytes   int64 `json:"bytes" mapstructure:"bytes"`
+}
+
+// Plans maps plan names to their limits.
+type Plans map[string]Plan
+
+// Limits returns the limits of the named plan. Users on a plan that is no
+// longer configured are held to the default plan, and nobody is limited at
+// all when the default plan is not configured either.
+func (p Plans) Limits(name string) Plan {
+	if plan, ok := p[name]; ok {
+		return plan
+	}
+	return p[models.DefaultPlan]
+}
+
+// Exists reports whether users can be moved to the named plan. The default
+// plan always exists, even when it is not configured.
+func (p Plans) Exists(name string) bool {
+	_, ok := p[name]
+	return ok || name == models.DefaultPlan
+}
+
+// Reached reports whether used has reached limit, which is never the case for
+// an unlimited limit of 0.
+func Reached(limit int64, used int64) bool {
+	return limit > 0 && used >= limit
+}
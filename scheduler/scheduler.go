@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/quota"
+	"github.com/rss-creator/scraper"
+	"github.com/rss-creator/storage"
+)
+
+const (
+	// batchSize caps how many due feeds are loaded per poll, feeds beyond it
+	// are picked up on the next poll
+	batchSize = 500
+)
+
+// Scheduler periodically refreshes every stored feed once its interval has
+// elapsed. Feeds are refreshed by a fixed number of workers, so the number of
+// concurrent outgoing requests is bounded no matter how many feeds are due.
+type Scheduler struct {
+	db      storage.DB
+	client  *http.Client
+	workers int
+	poll    time.Duration
+	plans   quota.Plans
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func New(db storage.DB, client *http.Client, workers int, poll time.Duration, plans quota.Plans) *Scheduler {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Scheduler{
+		db:      db,
+		client:  client,
+		workers: workers,
+		poll:    poll,
+		plans:   plans,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start begins polling for due feeds in the background.
+func (s *Scheduler) Start() {
+	go s.run()
+}
+
+// Stop waits for any refreshes in progress to finish and stops polling.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+
+	for {
+		s.refreshDue()
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshDue refreshes every due feed, returning once all of them are done so
+// that a slow feed is never picked up twice.
+func (s *Scheduler) refreshDue() {
+	feeds, err := s.db.GetDueFeeds(time.Now(), batchSize)
+	if err != nil {
+		log.Printf("could not get due feeds\n%v", err)
+		return
+	}
+
+	jobs := make(chan *models.Feed)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers && i < len(feeds); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				s.Refresh(f)
+			}
+		}()
+	}
+
+	for _, f := range feeds {
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Refresh scrapes a feed's source, stores any items whose GUID has not been
+// seen before and schedules its next refresh. Once the feed's owner has more
+// items than their plan allows, the items first seen longest ago are evicted
+// to make room, and are not stored again by later refreshes.
+func (s *Scheduler) Refresh(feed *models.Feed) {
+	now := time.Now()
+	next := now.Add(time.Duration(feed.Interval) * time.Minute)
+
+	refreshErr := ""
+	added, err := s.scrape(feed, now)
+	if err != nil {
+		log.Printf("could not refresh feed %v\n%v", feed.ID, err)
+		refreshErr = err.Error()
+	} else if added > 0 {
+		log.Printf("added %v items to feed %v", added, feed.ID)
+	}
+
+	err = s.db.UpdateFeedRefresh(feed.ID, now, next, refreshErr)
+	if err != nil && !storage.IsNotFound(err) {
+		log.Printf("could not record refresh of feed %v\n%v", feed.ID, err)
+	}
+}
+
+func (s *Scheduler) scrape(feed *models.Feed, now time.Time) (int, error) {
+	base, err := url.Parse(feed.SourceURL)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := scraper.Fetch(s.client, feed.SourceURL)
+	if err != nil {
+		return 0, err
+	}
+
+	items, err := scraper.Extract(body, base, feed.Rules)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, item := range items {
+		item.FeedID = feed.ID
+		item.FirstSeen = now
+		if item.Published.IsZero() {
+			item.Published = now
+		}
+
+		created, err := s.db.CreateItem(item)
+		if err != nil {
+			return added, err
+		}
+		if created {
+			added++
+		}
+	}
+
+	if added > 0 {
+		err = s.evictItems(feed.Owner)
+	}
+	return added, err
+}
+
+// evictItems deletes the user's items first seen longest ago beyond the item
+// limit of their plan.
+func (s *Scheduler) evictItems(username string) error {
+	user, err := s.db.GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	limit := s.plans.Limits(user.Plan).Items
+	if limit == 0 {
+		return nil
+	}
+
+	evicted, err := s.db.PruneItems(username, limit)
+	if err == nil && evicted > 0 {
+		log.Printf("evicted %v items of user %v over the limit of %v", evicted, username, limit)
+	}
+	return err
+}
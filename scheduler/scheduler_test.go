@@ -0,0 +1,248 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/quota"
+	"github.com/rss-creator/storage"
+)
+
+var postRules = models.ExtractionRules{
+	Item:  models.Rule{Selector: "div.post"},
+	Title: models.Rule{Selector: "h2"},
+	Link:  models.Rule{Selector: "a", Attr: "href"},
+	Date:  models.Rule{Selector: "time", Attr: "datetime"},
+}
+
+// page lists the given posts, each of which is published on the day of the
+// year it names.
+func page(posts ...int) string {
+	var b strings.Builder
+	b.WriteString("<html><body>")
+	for _, p := range posts {
+		fmt.Fprintf(&b, `<div class="post"><h2>Post %v</h2><a href="/posts/%v"></a><time datetime="2001-01-%02dT00:00:00Z"></time></div>`, p, p, p)
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
+
+// source serves the page listing the given posts.
+func source(t *testing.T, posts ...int) *httptest.Server {
+	return serve(t, func() string { return page(posts...) })
+}
+
+// serve serves whatever body returns at the time of each request.
+func serve(t *testing.T, body func() string) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body()))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// forEachDB runs test against each kind of database that needs no server.
+func forEachDB(t *testing.T, test func(t *testing.T, db storage.DB)) {
+	for _, kind := range []string{storage.Memory, storage.SQLite} {
+		t.Run(kind, func(t *testing.T) {
+			db, err := storage.GetDB(kind, filepath.Join(t.TempDir(), "rss.db"))
+			if err != nil {
+				t.Fatalf("could not create database: %v", err)
+			}
+			test(t, db)
+		})
+	}
+}
+
+func createFeed(t *testing.T, db storage.DB, url string) *models.Feed {
+	if err := db.CreateUser(&models.User{Username: "alice", Password: "hash", Email: "alice@example.com"}); err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+
+	feed := &models.Feed{Owner: "alice", Title: "Posts", SourceURL: url, Rules: postRules, Interval: 60}
+	if err := db.CreateFeed(feed, 0); err != nil {
+		t.Fatalf("could not create feed: %v", err)
+	}
+	return feed
+}
+
+func items(t *testing.T, db storage.DB, feed *models.Feed) []*models.Item {
+	items, err := db.GetItems(feed.ID, 100)
+	if err != nil {
+		t.Fatalf("could not get items: %v", err)
+	}
+	return items
+}
+
+func TestRefreshEvictsOverLimit(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		plans := quota.Plans{models.DefaultPlan: {Items: 2}}
+		s := New(db, http.DefaultClient, 1, 0, plans)
+
+		feed := createFeed(t, db, source(t, 1, 2, 3).URL)
+		if added, err := s.scrape(feed, time.Now()); err != nil || added != 3 {
+			t.Fatalf("first refresh added %v items with error %v, want 3", added, err)
+		}
+
+		first := items(t, db, feed)
+		if len(first) != 2 {
+			t.Fatalf("got %v items after the first refresh, want 2", len(first))
+		}
+
+		// the evicted item is still listed by the source, but is not stored
+		// again, nor does it displace the items kept
+		if added, err := s.scrape(feed, time.Now()); err != nil || added != 0 {
+			t.Fatalf("second refresh added %v items with error %v, want none", added, err)
+		}
+		second := items(t, db, feed)
+		if len(second) != len(first) {
+			t.Fatalf("got %v items after the second refresh, want %v", len(second), len(first))
+		}
+		for i := range first {
+			if second[i].ID != first[i].ID || !second[i].FirstSeen.Equal(first[i].FirstSeen) {
+				t.Errorf("item %v is %+v after the second refresh, want %+v", i, second[i], first[i])
+			}
+		}
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		s := New(db, http.DefaultClient, 1, 0, quota.Plans{})
+
+		var mu sync.Mutex
+		posts := []int{1, 2}
+		src := serve(t, func() string {
+			mu.Lock()
+			defer mu.Unlock()
+			return page(posts...)
+		})
+
+		feed := createFeed(t, db, src.URL)
+		before := time.Now().Add(-time.Second)
+		s.Refresh(feed)
+
+		first := items(t, db, feed)
+		if len(first) != 2 || first[0].Title != "Post 2" || first[1].Title != "Post 1" {
+			t.Fatalf("got items %+v after the first refresh, want posts 2 and 1", first)
+		}
+		if want := src.URL + "/posts/2"; first[0].Link != want || first[0].GUID == "" {
+			t.Errorf("first item links %v with GUID %q, want %v and a GUID", first[0].Link, first[0].GUID, want)
+		}
+
+		refreshed, err := db.GetFeed(feed.ID)
+		if err != nil {
+			t.Fatalf("could not get feed: %v", err)
+		}
+		if refreshed.LastRefreshed.Before(before) || refreshed.LastError != "" {
+			t.Errorf("feed was last refreshed %v with error %q, want now without error", refreshed.LastRefreshed, refreshed.LastError)
+		}
+		if want := refreshed.LastRefreshed.Add(time.Hour); !refreshed.NextRefresh.Equal(want) {
+			t.Errorf("feed is next refreshed %v, want an interval after the last refresh at %v", refreshed.NextRefresh, want)
+		}
+
+		// posts still listed are not stored again
+		mu.Lock()
+		posts = []int{1, 2, 3}
+		mu.Unlock()
+		s.Refresh(feed)
+
+		second := items(t, db, feed)
+		if len(second) != 3 || second[0].Title != "Post 3" {
+			t.Fatalf("got items %+v after the second refresh, want post 3 added", second)
+		}
+		for i := range first {
+			if second[i+1].ID != first[i].ID || !second[i+1].FirstSeen.Equal(first[i].FirstSeen) {
+				t.Errorf("item %+v changed to %+v by the second refresh", first[i], second[i+1])
+			}
+		}
+	})
+}
+
+func TestRefreshError(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		s := New(db, http.DefaultClient, 1, 0, quota.Plans{})
+		src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(src.Close)
+
+		feed := createFeed(t, db, src.URL)
+		s.Refresh(feed)
+
+		// a failing feed keeps its schedule rather than being retried at once
+		refreshed, err := db.GetFeed(feed.ID)
+		if err != nil {
+			t.Fatalf("could not get feed: %v", err)
+		}
+		if refreshed.LastError == "" || !refreshed.NextRefresh.After(time.Now()) {
+			t.Errorf("failed feed has error %q and is next refreshed %v, want an error and a later refresh", refreshed.LastError, refreshed.NextRefresh)
+		}
+		if got := items(t, db, feed); len(got) != 0 {
+			t.Errorf("got %v items from a failing source, want none", len(got))
+		}
+	})
+}
+
+func TestRefreshDue(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		s := New(db, http.DefaultClient, 4, 0, quota.Plans{})
+		due := createFeed(t, db, source(t, 1).URL)
+
+		notDue := &models.Feed{Owner: "alice", Title: "Later", SourceURL: source(t, 2).URL, Rules: postRules, Interval: 60}
+		if err := db.CreateFeed(notDue, 0); err != nil {
+			t.Fatalf("could not create feed: %v", err)
+		}
+		next := time.Now().Add(time.Hour)
+		if err := db.UpdateFeedRefresh(notDue.ID, time.Now(), next, ""); err != nil {
+			t.Fatalf("could not update feed refresh: %v", err)
+		}
+
+		s.refreshDue()
+
+		if got := items(t, db, due); len(got) != 1 {
+			t.Errorf("got %v items in the due feed, want 1", len(got))
+		}
+		if got := items(t, db, notDue); len(got) != 0 {
+			t.Errorf("got %v items in the feed not due, want none", len(got))
+		}
+	})
+}
+
+func TestStartStop(t *testing.T) {
+	db, err := storage.GetDB(storage.Memory, "")
+	if err != nil {
+		t.Fatalf("could not create database: %v", err)
+	}
+	feed := createFeed(t, db, source(t, 1).URL)
+
+	s := New(db, http.DefaultClient, 1, time.Hour, quota.Plans{})
+	s.Start()
+
+	// the first poll happens as soon as the scheduler starts
+	deadline := time.Now().Add(5 * time.Second)
+	for len(items(t, db, feed)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("feed was not refreshed after starting the scheduler")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("scheduler did not stop")
+	}
+}
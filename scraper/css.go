@@ -0,0 +1,32 @@
+package scraper
+
+import (
+	"github.com/andybalholm/cascadia"
+)
+
+type cssSelector struct {
+	sel cascadia.Selector
+}
+
+func compileCSS(expr string) (selector, error) {
+	sel, err := cascadia.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &cssSelector{sel}, nil
+}
+
+// selectAll matches descendants of the fragment, not the fragment itself, in
+// the same way as querySelectorAll.
+func (c *cssSelector) selectAll(f *fragment) ([]*fragment, error) {
+	n, err := f.html()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []*fragment{}
+	for _, m := range cascadia.QueryAll(n, c.sel) {
+		matches = append(matches, &fragment{node: m})
+	}
+	return matches, nil
+}
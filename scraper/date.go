@@ -0,0 +1,46 @@
+package scraper
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"02 Jan 2006",
+	"01/02/2006",
+}
+
+// ParseDate tries the date formats commonly found on web pages and in JSON
+// APIs, returning the zero time if none match. Bare integers are read as Unix
+// timestamps in seconds, or milliseconds when too large to be seconds.
+func ParseDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if ts > 1e11 {
+			return time.Unix(0, ts*int64(time.Millisecond)).UTC()
+		}
+		return time.Unix(ts, 0).UTC()
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
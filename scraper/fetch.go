@@ -0,0 +1,29 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	// MaxBodySize caps how much of a page is read, so a misbehaving site
+	// cannot exhaust memory
+	MaxBodySize = 10 << 20
+)
+
+// Fetch downloads a page, failing on non 2xx responses.
+func Fetch(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%v responded with status %v", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, MaxBodySize))
+}
@@ -0,0 +1,163 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// fragment is a piece of a scraped page that rules are evaluated against.
+// Fragments produced by regular expressions only have source text, fragments
+// produced by HTML selectors only have a node, and fragments produced by
+// JSONPath only have decoded data. Each form is derived from the others on
+// demand so that rules of different modes can be mixed.
+type fragment struct {
+	source  string
+	node    *html.Node
+	data    interface{}
+	hasData bool
+}
+
+func (f *fragment) json() (interface{}, error) {
+	if !f.hasData {
+		src, err := f.markup()
+		if err != nil {
+			return nil, err
+		}
+
+		d := json.NewDecoder(strings.NewReader(src))
+		d.UseNumber()
+		if err := d.Decode(&f.data); err != nil {
+			return nil, err
+		}
+		f.hasData = true
+	}
+	return f.data, nil
+}
+
+func (f *fragment) html() (*html.Node, error) {
+	if f.node == nil {
+		src, err := f.markup()
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := html.Parse(strings.NewReader(src))
+		if err != nil {
+			return nil, err
+		}
+		f.node = n
+	}
+	return f.node, nil
+}
+
+func (f *fragment) markup() (string, error) {
+	if f.source != "" {
+		return f.source, nil
+	}
+
+	if f.node != nil {
+		var b bytes.Buffer
+		if err := html.Render(&b, f.node); err != nil {
+			return "", err
+		}
+		f.source = b.String()
+	} else if f.hasData {
+		f.source = jsonText(f.data)
+	}
+	return f.source, nil
+}
+
+// text returns the fragment's visible text with runs of whitespace collapsed.
+// Source text is returned as is apart from decoding entities, and JSON values
+// as their string value or encoding.
+func (f *fragment) text() string {
+	if f.hasData {
+		return strings.TrimSpace(jsonText(f.data))
+	}
+
+	if f.node == nil {
+		return strings.Join(strings.Fields(html.UnescapeString(f.source)), " ")
+	}
+
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			b.WriteString(" ")
+			return
+		case html.CommentNode:
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(f.node)
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// attr returns an attribute of the fragment's first element, which for source
+// text is the first element that is not part of the implied document wrapper.
+// For JSON objects it returns the named member.
+func (f *fragment) attr(name string) (string, error) {
+	if obj, ok := f.data.(map[string]interface{}); ok {
+		if v, ok := obj[name]; ok {
+			return strings.TrimSpace(jsonText(v)), nil
+		}
+		return "", nil
+	}
+
+	n, err := f.html()
+	if err != nil {
+		return "", err
+	}
+
+	el := firstElement(n)
+	if el == nil {
+		return "", nil
+	}
+
+	for _, a := range el.Attr {
+		if a.Key == name {
+			return strings.TrimSpace(a.Val), nil
+		}
+	}
+	return "", nil
+}
+
+func firstElement(n *html.Node) *html.Node {
+	if n.Type == html.ElementNode && n.Data != "html" && n.Data != "head" && n.Data != "body" {
+		return n
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if el := firstElement(c); el != nil {
+			return el
+		}
+	}
+	return nil
+}
+
+// jsonText returns strings unquoted and any other value in its JSON encoding.
+func jsonText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
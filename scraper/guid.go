@@ -0,0 +1,21 @@
+package scraper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/rss-creator/models"
+)
+
+// GUID derives a stable identifier for an extracted item. Items with a link
+// are identified by it, so edits to their text do not make feed readers show
+// them again. Items without a link are identified by a hash of their content.
+func GUID(item *models.Item) string {
+	if item.Link != "" {
+		return item.Link
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{item.Title, item.Summary, item.Image}, "\x00")))
+	return "urn:sha256:" + hex.EncodeToString(sum[:])
+}
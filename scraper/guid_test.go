@@ -0,0 +1,75 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+func TestGUIDOfLinkedItems(t *testing.T) {
+	item := &models.Item{Title: "Title", Link: "https://example.com/1", Summary: "Summary"}
+	edited := &models.Item{Title: "Edited title", Link: "https://example.com/1", Summary: "Edited", Published: time.Now()}
+
+	if got := GUID(item); got != "https://example.com/1" {
+		t.Errorf("GUID(%+v) = %q, want its link", item, got)
+	}
+	if GUID(item) != GUID(edited) {
+		t.Errorf("editing the text of a linked item changed its GUID from %q to %q", GUID(item), GUID(edited))
+	}
+}
+
+func TestGUIDOfUnlinkedItems(t *testing.T) {
+	item := &models.Item{Title: "Title", Summary: "Summary", Image: "https://example.com/1.png"}
+	guid := GUID(item)
+
+	if !strings.HasPrefix(guid, "urn:sha256:") {
+		t.Errorf("GUID(%+v) = %q, want a urn:sha256: hash", item, guid)
+	}
+	if again := GUID(&models.Item{Title: "Title", Summary: "Summary", Image: "https://example.com/1.png", Published: time.Now()}); again != guid {
+		t.Errorf("GUID of the same content changed from %q to %q", guid, again)
+	}
+
+	// content moving between fields is a different item
+	different := []*models.Item{
+		{Title: "Edited", Summary: "Summary", Image: "https://example.com/1.png"},
+		{Title: "Title", Summary: "Edited", Image: "https://example.com/1.png"},
+		{Title: "Title", Summary: "Summary"},
+		{Title: "TitleSummary", Image: "https://example.com/1.png"},
+		{Title: "Title", Summary: "Summaryhttps://example.com/1.png"},
+	}
+	for _, d := range different {
+		if GUID(d) == guid {
+			t.Errorf("GUID(%+v) = GUID(%+v)", d, item)
+		}
+	}
+}
+
+func TestGUIDStableAcrossExtractions(t *testing.T) {
+	rules := models.ExtractionRules{
+		Item:    models.Rule{Selector: "div.post"},
+		Title:   models.Rule{Selector: "h2"},
+		Link:    models.Rule{Selector: "h2 a", Attr: "href"},
+		Summary: models.Rule{Selector: ".summary"},
+	}
+	edited := strings.Replace(scraperPage, "One &amp; only", "One &amp; only, edited", 1)
+
+	first, err := Extract([]byte(scraperPage), scraperBase, rules)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	second, err := Extract([]byte(edited), scraperBase, rules)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	if len(first) != len(second) {
+		t.Fatalf("extracted %v items, then %v", len(first), len(second))
+	}
+	for i := range first {
+		if first[i].GUID != second[i].GUID {
+			t.Errorf("GUID of item %v changed from %q to %q", i, first[i].GUID, second[i].GUID)
+		}
+	}
+}
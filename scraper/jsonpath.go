@@ -0,0 +1,312 @@
+package scraper
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonSelector implements the commonly used subset of JSONPath: member access
+// with dot or bracket notation, array indices (including negative indices),
+// slices, unions, wildcards and recursive descent. Filter and script
+// expressions are not supported. Expressions are evaluated relative to the
+// fragment, and the leading $ or @ may be omitted.
+type jsonSelector struct {
+	steps []jsonStep
+}
+
+type jsonStep struct {
+	recursive bool
+	wildcard  bool
+	names     []string
+	indices   []int
+	slice     *jsonSlice
+}
+
+type jsonSlice struct {
+	start, end       int
+	hasStart, hasEnd bool
+}
+
+func compileJSONPath(expr string) (selector, error) {
+	p := strings.TrimSpace(expr)
+	if strings.HasPrefix(p, "$") || strings.HasPrefix(p, "@") {
+		p = p[1:]
+	} else if p != "" && p[0] != '.' && p[0] != '[' {
+		p = "." + p
+	}
+
+	steps := []jsonStep{}
+	for p != "" {
+		var step jsonStep
+		switch {
+		case strings.HasPrefix(p, ".."):
+			step.recursive = true
+			p = p[2:]
+			if strings.HasPrefix(p, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(p, "."):
+			p = strings.TrimPrefix(p, ".")
+			end := strings.IndexAny(p, ".[")
+			if end == -1 {
+				end = len(p)
+			}
+			name := p[:end]
+			p = p[end:]
+			if name == "" {
+				return nil, fmt.Errorf("empty member name in %q", expr)
+			}
+			if name == "*" {
+				step.wildcard = true
+			} else {
+				step.names = []string{name}
+			}
+			steps = append(steps, step)
+			continue
+		case !strings.HasPrefix(p, "["):
+			return nil, fmt.Errorf("unexpected %q in %q", p, expr)
+		}
+
+		end := closingBracket(p)
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated bracket in %q", expr)
+		}
+		err := step.parseBracket(strings.TrimSpace(p[1:end]))
+		if err != nil {
+			return nil, fmt.Errorf("%v in %q", err, expr)
+		}
+		p = p[end+1:]
+		steps = append(steps, step)
+	}
+
+	return &jsonSelector{steps}, nil
+}
+
+// closingBracket returns the index of the bracket closing the one p starts
+// with, skipping over quoted member names.
+func closingBracket(p string) int {
+	var quote byte
+	for i := 1; i < len(p); i++ {
+		switch {
+		case quote != 0 && p[i] == '\\':
+			i++
+		case quote != 0 && p[i] == quote:
+			quote = 0
+		case quote == 0 && (p[i] == '\'' || p[i] == '"'):
+			quote = p[i]
+		case quote == 0 && p[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *jsonStep) parseBracket(body string) error {
+	switch {
+	case body == "*":
+		s.wildcard = true
+		return nil
+	case strings.HasPrefix(body, "?") || strings.HasPrefix(body, "("):
+		return fmt.Errorf("filter and script expressions are not supported")
+	case strings.Contains(body, ":") && !strings.ContainsAny(body, `'"`):
+		return s.parseSlice(body)
+	}
+
+	for _, part := range splitUnion(body) {
+		part = strings.TrimSpace(part)
+		if len(part) >= 2 && (part[0] == '\'' || part[0] == '"') && part[len(part)-1] == part[0] {
+			s.names = append(s.names, unescape(part[1:len(part)-1]))
+			continue
+		}
+
+		i, err := strconv.Atoi(part)
+		if err != nil {
+			return fmt.Errorf("invalid subscript %q", part)
+		}
+		s.indices = append(s.indices, i)
+	}
+	return nil
+}
+
+// unescape reads a quoted member name, in which a backslash makes the
+// character after it literal.
+func unescape(quoted string) string {
+	var b strings.Builder
+	for i := 0; i < len(quoted); i++ {
+		if quoted[i] == '\\' && i+1 < len(quoted) {
+			i++
+		}
+		b.WriteByte(quoted[i])
+	}
+	return b.String()
+}
+
+func (s *jsonStep) parseSlice(body string) error {
+	parts := strings.Split(body, ":")
+	if len(parts) > 2 {
+		return fmt.Errorf("slice steps are not supported")
+	}
+
+	slice := &jsonSlice{}
+	var err error
+	if v := strings.TrimSpace(parts[0]); v != "" {
+		if slice.start, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("invalid slice start %q", v)
+		}
+		slice.hasStart = true
+	}
+	if v := strings.TrimSpace(parts[1]); v != "" {
+		if slice.end, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("invalid slice end %q", v)
+		}
+		slice.hasEnd = true
+	}
+
+	s.slice = slice
+	return nil
+}
+
+func splitUnion(body string) []string {
+	parts := []string{}
+	var quote byte
+	start := 0
+	for i := 0; i < len(body); i++ {
+		switch {
+		case quote != 0 && body[i] == '\\':
+			i++
+		case quote != 0 && body[i] == quote:
+			quote = 0
+		case quote == 0 && (body[i] == '\'' || body[i] == '"'):
+			quote = body[i]
+		case quote == 0 && body[i] == ',':
+			parts = append(parts, body[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, body[start:])
+}
+
+func (j *jsonSelector) selectAll(f *fragment) ([]*fragment, error) {
+	root, err := f.json()
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{root}
+	for _, step := range j.steps {
+		values = step.apply(values)
+	}
+
+	matches := []*fragment{}
+	for _, v := range values {
+		matches = append(matches, &fragment{data: v, hasData: true})
+	}
+	return matches, nil
+}
+
+func (s jsonStep) apply(values []interface{}) []interface{} {
+	out := []interface{}{}
+	for _, v := range values {
+		candidates := []interface{}{v}
+		if s.recursive {
+			candidates = descendants(v, candidates)
+		}
+		for _, c := range candidates {
+			out = append(out, s.children(c)...)
+		}
+	}
+	return out
+}
+
+func (s jsonStep) children(v interface{}) []interface{} {
+	out := []interface{}{}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			for _, k := range sortedKeys(t) {
+				out = append(out, t[k])
+			}
+		}
+		for _, name := range s.names {
+			if c, ok := t[name]; ok {
+				out = append(out, c)
+			}
+		}
+	case []interface{}:
+		if s.wildcard {
+			out = append(out, t...)
+		}
+		for _, i := range s.indices {
+			if i < 0 {
+				i += len(t)
+			}
+			if i >= 0 && i < len(t) {
+				out = append(out, t[i])
+			}
+		}
+		if s.slice != nil {
+			start, end := s.slice.bounds(len(t))
+			for i := start; i < end; i++ {
+				out = append(out, t[i])
+			}
+		}
+	}
+	return out
+}
+
+func (s *jsonSlice) bounds(length int) (int, int) {
+	clamp := func(i int) int {
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > length {
+			return length
+		}
+		return i
+	}
+
+	start, end := 0, length
+	if s.hasStart {
+		start = clamp(s.start)
+	}
+	if s.hasEnd {
+		end = clamp(s.end)
+	}
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
+// descendants appends every value nested within v, visiting object members
+// in key order.
+func descendants(v interface{}, out []interface{}) []interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(t) {
+			out = append(out, t[k])
+			out = descendants(t[k], out)
+		}
+	case []interface{}:
+		for _, c := range t {
+			out = append(out, c)
+			out = descendants(c, out)
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,131 @@
+package scraper
+
+import (
+	"reflect"
+	"testing"
+)
+
+const jsonPathDoc = `{
+	"store": {
+		"name": "shop",
+		"book": [
+			{"title": "A", "price": 8},
+			{"title": "B", "price": 12},
+			{"title": "C", "price": 9}
+		]
+	},
+	"it's": "single",
+	"say \"hi\"": "double",
+	"back\\slash": "backslash",
+	"a.b": "dotted",
+	"x]y": "bracket",
+	"p,q": "comma"
+}`
+
+func selectJSON(t *testing.T, expr string, doc string) []string {
+	sel, err := compileJSONPath(expr)
+	if err != nil {
+		t.Errorf("compileJSONPath(%q) failed: %v", expr, err)
+		return nil
+	}
+
+	matches, err := sel.selectAll(&fragment{source: doc})
+	if err != nil {
+		t.Errorf("selecting %q failed: %v", expr, err)
+		return nil
+	}
+
+	values := []string{}
+	for _, m := range matches {
+		values = append(values, m.text())
+	}
+	return values
+}
+
+func TestJSONPath(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"$.store.name", []string{"shop"}},
+		{"store.name", []string{"shop"}},
+		{"$['store']['name']", []string{"shop"}},
+		{`$["store"].name`, []string{"shop"}},
+		{"$.missing", []string{}},
+
+		// quoted names
+		{`$["it's"]`, []string{"single"}},
+		{`$['it\'s']`, []string{"single"}},
+		{`$["say \"hi\""]`, []string{"double"}},
+		{`$['back\\slash']`, []string{"backslash"}},
+		{`$['a.b']`, []string{"dotted"}},
+		{`$['x]y']`, []string{"bracket"}},
+		{`$['p,q', 'a.b']`, []string{"comma", "dotted"}},
+
+		// indices and slices
+		{"$.store.book[0].title", []string{"A"}},
+		{"$.store.book[-1].title", []string{"C"}},
+		{"$.store.book[-3].title", []string{"A"}},
+		{"$.store.book[3].title", []string{}},
+		{"$.store.book[-4].title", []string{}},
+		{"$.store.book[0, -1].title", []string{"A", "C"}},
+		{"$.store.book[1:].title", []string{"B", "C"}},
+		{"$.store.book[:2].title", []string{"A", "B"}},
+		{"$.store.book[-2:].title", []string{"B", "C"}},
+		{"$.store.book[:-1].title", []string{"A", "B"}},
+		{"$.store.book[-10:10].title", []string{"A", "B", "C"}},
+		{"$.store.book[2:1].title", []string{}},
+		{"$.store.book[5:].title", []string{}},
+		{"$.store.book[:]", []string{`{"price":8,"title":"A"}`, `{"price":12,"title":"B"}`, `{"price":9,"title":"C"}`}},
+
+		// wildcards and recursive descent
+		{"$.store.book[*].price", []string{"8", "12", "9"}},
+		{"$.store.book.*.title", []string{"A", "B", "C"}},
+		{"$..title", []string{"A", "B", "C"}},
+		{"$..book[-1].price", []string{"9"}},
+		{"$..['name']", []string{"shop"}},
+	}
+
+	for _, test := range tests {
+		got := selectJSON(t, test.expr, jsonPathDoc)
+		if got != nil && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q selected %q, want %q", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestJSONPathRecursiveWildcard(t *testing.T) {
+	got := selectJSON(t, "$..[*]", `{"b": {"c": 3}, "a": [1, 2]}`)
+	want := []string{"[1,2]", `{"c":3}`, "1", "2", "3"}
+	if got != nil && !reflect.DeepEqual(got, want) {
+		t.Errorf("$..[*] selected %q, want %q", got, want)
+	}
+}
+
+func TestJSONPathMalformed(t *testing.T) {
+	tests := []string{
+		"$.",
+		"$..",
+		"$.store.",
+		"$store",
+		"$.store[",
+		"$.store[0",
+		"$['store]",
+		"$['store'",
+		"$[]",
+		"$[name]",
+		"$[1.5]",
+		"$[0,]",
+		"$[1:2:3]",
+		"$[a:1]",
+		"$[1:b]",
+		"$[?(@.price < 10)]",
+		"$[(@.length-1)]",
+	}
+
+	for _, expr := range tests {
+		if _, err := compileJSONPath(expr); err == nil {
+			t.Errorf("compileJSONPath(%q) succeeded, want an error", expr)
+		}
+	}
+}
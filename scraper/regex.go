@@ -0,0 +1,49 @@
+package scraper
+
+import (
+	"regexp"
+)
+
+type regexSelector struct {
+	re *regexp.Regexp
+	// group is the submatch used as the value of each match, 0 for the
+	// whole match
+	group int
+}
+
+// compileRegex uses the first named group of the expression as the value of
+// each match, falling back to the first group and then the whole match.
+func compileRegex(expr string) (selector, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	group := 0
+	if re.NumSubexp() > 0 {
+		group = 1
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			group = i
+			break
+		}
+	}
+
+	return &regexSelector{re, group}, nil
+}
+
+// selectAll matches against the fragment's markup, so expressions can see
+// tags and attributes as well as text.
+func (x *regexSelector) selectAll(f *fragment) ([]*fragment, error) {
+	src, err := f.markup()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []*fragment{}
+	for _, m := range x.re.FindAllStringSubmatch(src, -1) {
+		matches = append(matches, &fragment{source: m[x.group]})
+	}
+	return matches, nil
+}
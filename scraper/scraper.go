@@ -0,0 +1,199 @@
+package scraper
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/rss-creator/models"
+)
+
+const (
+	ModeCSS      = "css"
+	ModeXPath    = "xpath"
+	ModeRegex    = "regex"
+	ModeJSONPath = "jsonpath"
+)
+
+// RuleError reports which extraction rule could not be compiled or evaluated.
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (err *RuleError) Error() string {
+	return fmt.Sprintf("%v rule: %v", err.Rule, err.Err)
+}
+
+func IsRuleError(err error) bool {
+	if _, ok := err.(*RuleError); ok {
+		return true
+	}
+	return false
+}
+
+// selector finds every match of a compiled rule within a fragment.
+type selector interface {
+	selectAll(f *fragment) ([]*fragment, error)
+}
+
+type compiledRule struct {
+	name string
+	rule models.Rule
+	// sel is nil for rules without a selector, which apply to the item itself
+	sel selector
+}
+
+type ruleSet struct {
+	item   *compiledRule
+	fields []*compiledRule
+}
+
+// Validate reports the first rule that cannot be compiled, without fetching
+// or parsing anything.
+func Validate(rules models.ExtractionRules) error {
+	_, err := compileRules(rules)
+	return err
+}
+
+// Extract returns an item for each match of the item rule within body. The
+// remaining rules are evaluated relative to each match, and relative links are
+// resolved against base.
+func Extract(body []byte, base *url.URL, rules models.ExtractionRules) ([]*models.Item, error) {
+	set, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := set.item.sel.selectAll(&fragment{source: string(body)})
+	if err != nil {
+		return nil, &RuleError{set.item.name, err}
+	}
+
+	items := []*models.Item{}
+	for _, m := range matches {
+		values := map[string]string{}
+		for _, rule := range set.fields {
+			values[rule.name], err = rule.value(m)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		item := &models.Item{
+			Title:     values["title"],
+			Link:      resolve(base, values["link"]),
+			Summary:   values["summary"],
+			Image:     resolve(base, values["image"]),
+			Published: ParseDate(values["date"]),
+		}
+
+		if item.Title == "" && item.Link == "" {
+			continue
+		}
+		item.GUID = GUID(item)
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func compileRules(rules models.ExtractionRules) (*ruleSet, error) {
+	if rules.Item.Selector == "" {
+		return nil, &RuleError{"item", fmt.Errorf("selector required")}
+	}
+
+	item, err := compileRule("item", rules.Item)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &ruleSet{item: item}
+	fields := []struct {
+		name string
+		rule models.Rule
+	}{
+		{"title", rules.Title},
+		{"link", rules.Link},
+		{"date", rules.Date},
+		{"summary", rules.Summary},
+		{"image", rules.Image},
+	}
+	for _, f := range fields {
+		c, err := compileRule(f.name, f.rule)
+		if err != nil {
+			return nil, err
+		}
+		set.fields = append(set.fields, c)
+	}
+
+	return set, nil
+}
+
+func compileRule(name string, rule models.Rule) (*compiledRule, error) {
+	c := &compiledRule{name: name, rule: rule}
+	if rule.Selector == "" {
+		return c, nil
+	}
+
+	var err error
+	switch rule.Mode {
+	case "", ModeCSS:
+		c.sel, err = compileCSS(rule.Selector)
+	case ModeXPath:
+		c.sel, err = compileXPath(rule.Selector)
+	case ModeRegex:
+		c.sel, err = compileRegex(rule.Selector)
+	case ModeJSONPath:
+		c.sel, err = compileJSONPath(rule.Selector)
+	default:
+		err = fmt.Errorf("unknown mode %q", rule.Mode)
+	}
+
+	if err != nil {
+		return nil, &RuleError{name, err}
+	}
+	return c, nil
+}
+
+// value reads the rule's value from the first match within an item. A rule
+// with neither a selector nor an attribute is unset, and a rule that matches
+// nothing yields an empty value.
+func (c *compiledRule) value(item *fragment) (string, error) {
+	if c.rule.Selector == "" && c.rule.Attr == "" {
+		return "", nil
+	}
+
+	f := item
+	if c.sel != nil {
+		matches, err := c.sel.selectAll(item)
+		if err != nil {
+			return "", &RuleError{c.name, err}
+		}
+		if len(matches) == 0 {
+			return "", nil
+		}
+		f = matches[0]
+	}
+
+	if c.rule.Attr == "" {
+		return f.text(), nil
+	}
+
+	v, err := f.attr(c.rule.Attr)
+	if err != nil {
+		return "", &RuleError{c.name, err}
+	}
+	return v, nil
+}
+
+func resolve(base *url.URL, ref string) string {
+	if ref == "" || base == nil {
+		return ref
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
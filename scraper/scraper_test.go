@@ -0,0 +1,167 @@
+package scraper
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+const scraperPage = `<html><body>
+<div class="post">
+	<h2><a href="/posts/1">First   post</a></h2>
+	<time datetime="2024-01-02T03:04:05Z">2 January 2024</time>
+	<p class="summary">One &amp; only</p>
+	<img src="images/1.png">
+</div>
+<div class="post">
+	<h2><a href="https://other.example/2">Second post</a></h2>
+	<p class="summary">Two</p>
+</div>
+<div class="post">
+	<p class="summary">Neither a title nor a link</p>
+</div>
+</body></html>`
+
+var scraperBase, _ = url.Parse("https://example.com/blog/")
+
+// extracted keeps the fields of items that rules set, so expected items can
+// leave out their GUIDs.
+type extracted struct {
+	Title, Link, Summary, Image string
+	Published                   time.Time
+}
+
+func extract(t *testing.T, body string, rules models.ExtractionRules) []extracted {
+	items, err := Extract([]byte(body), scraperBase, rules)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	got := []extracted{}
+	for _, item := range items {
+		if item.GUID != GUID(item) {
+			t.Errorf("item %q has GUID %q, want %q", item.Title, item.GUID, GUID(item))
+		}
+		got = append(got, extracted{item.Title, item.Link, item.Summary, item.Image, item.Published})
+	}
+	return got
+}
+
+func TestExtractCSS(t *testing.T) {
+	got := extract(t, scraperPage, models.ExtractionRules{
+		Item:    models.Rule{Selector: "div.post"},
+		Title:   models.Rule{Selector: "h2"},
+		Link:    models.Rule{Selector: "h2 a", Attr: "href"},
+		Date:    models.Rule{Mode: ModeCSS, Selector: "time", Attr: "datetime"},
+		Summary: models.Rule{Selector: ".summary"},
+		Image:   models.Rule{Selector: "img", Attr: "src"},
+	})
+
+	want := []extracted{
+		{
+			Title:     "First post",
+			Link:      "https://example.com/posts/1",
+			Summary:   "One & only",
+			Image:     "https://example.com/blog/images/1.png",
+			Published: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{
+			Title:   "Second post",
+			Link:    "https://other.example/2",
+			Summary: "Two",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extracted %+v, want %+v", got, want)
+	}
+}
+
+func TestExtractInvalidRules(t *testing.T) {
+	tests := []struct {
+		rules models.ExtractionRules
+		rule  string
+	}{
+		{models.ExtractionRules{}, "item"},
+		{models.ExtractionRules{Item: models.Rule{Selector: "div["}}, "item"},
+		{models.ExtractionRules{Item: models.Rule{Selector: "div"}, Title: models.Rule{Selector: "h2", Mode: "sql"}}, "title"},
+		{models.ExtractionRules{Item: models.Rule{Selector: "div"}, Link: models.Rule{Selector: "a:nth-child(x)"}}, "link"},
+		{models.ExtractionRules{Item: models.Rule{Mode: ModeXPath, Selector: "//div["}}, "item"},
+		{models.ExtractionRules{Item: models.Rule{Selector: "div"}, Summary: models.Rule{Mode: ModeRegex, Selector: "(unclosed"}}, "summary"},
+	}
+
+	for _, test := range tests {
+		_, err := Extract([]byte(scraperPage), scraperBase, test.rules)
+		if ruleErr, ok := err.(*RuleError); !ok || ruleErr.Rule != test.rule {
+			t.Errorf("Extract with %+v returned %v, want an error for the %v rule", test.rules, err, test.rule)
+		}
+		if err := Validate(test.rules); !IsRuleError(err) {
+			t.Errorf("Validate(%+v) returned %v, want a rule error", test.rules, err)
+		}
+	}
+}
+
+func TestExtractXPath(t *testing.T) {
+	got := extract(t, scraperPage, models.ExtractionRules{
+		Item:    models.Rule{Mode: ModeXPath, Selector: `//div[@class="post"]`},
+		Title:   models.Rule{Mode: ModeXPath, Selector: "./h2/a"},
+		Link:    models.Rule{Mode: ModeXPath, Selector: "./h2/a/@href"},
+		Date:    models.Rule{Mode: ModeXPath, Selector: "./time/text()"},
+		Summary: models.Rule{Mode: ModeXPath, Selector: `.//p[@class="summary"]`},
+		Image:   models.Rule{Mode: ModeXPath, Selector: "./img", Attr: "src"},
+	})
+
+	want := []extracted{
+		{
+			Title:     "First post",
+			Link:      "https://example.com/posts/1",
+			Summary:   "One & only",
+			Image:     "https://example.com/blog/images/1.png",
+			Published: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Title:   "Second post",
+			Link:    "https://other.example/2",
+			Summary: "Two",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extracted %+v, want %+v", got, want)
+	}
+}
+
+func TestExtractRegex(t *testing.T) {
+	got := extract(t, scraperPage, models.ExtractionRules{
+		Item: models.Rule{Mode: ModeRegex, Selector: `(?s)<div class="post">.*?</div>`},
+		// the named group is used over the unnamed one before it
+		Title:   models.Rule{Mode: ModeRegex, Selector: `<a (href)="[^"]*">(?P<title>[^<]*)</a>`},
+		Link:    models.Rule{Mode: ModeRegex, Selector: `href="([^"]*)"`},
+		Summary: models.Rule{Mode: ModeRegex, Selector: `<p class="summary">([^<]*)</p>`},
+	})
+
+	want := []extracted{
+		{Title: "First post", Link: "https://example.com/posts/1", Summary: "One & only"},
+		{Title: "Second post", Link: "https://other.example/2", Summary: "Two"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extracted %+v, want %+v", got, want)
+	}
+}
+
+func TestExtractMixedModes(t *testing.T) {
+	got := extract(t, scraperPage, models.ExtractionRules{
+		Item:  models.Rule{Mode: ModeXPath, Selector: `//div[@class="post"][h2]`},
+		Title: models.Rule{Mode: ModeCSS, Selector: "h2 a"},
+		Link:  models.Rule{Mode: ModeRegex, Selector: `href="([^"]*)"`},
+	})
+
+	want := []extracted{
+		{Title: "First post", Link: "https://example.com/posts/1"},
+		{Title: "Second post", Link: "https://other.example/2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extracted %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,34 @@
+package scraper
+
+import (
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+)
+
+type xpathSelector struct {
+	expr *xpath.Expr
+}
+
+func compileXPath(expr string) (selector, error) {
+	e, err := xpath.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &xpathSelector{e}, nil
+}
+
+// selectAll evaluates the expression with the fragment as the context node,
+// so relative expressions such as ./a/@href are scoped to the current item.
+// Selected attributes and text nodes yield their value as text.
+func (x *xpathSelector) selectAll(f *fragment) ([]*fragment, error) {
+	n, err := f.html()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []*fragment{}
+	for _, m := range htmlquery.QuerySelectorAll(n, x.expr) {
+		matches = append(matches, &fragment{node: m})
+	}
+	return matches, nil
+}
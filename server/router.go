@@ -12,30 +12,145 @@ func Route(
 	r *mux.Router,
 	user controllers.UserController,
 	auth controllers.AuthController,
-	scraper controllers.ScraperController) {
+	feed controllers.FeedController,
+	scraper controllers.ScraperController,
+	admin controllers.AdminController,
+	team controllers.TeamController,
+	usage controllers.UsageController) {
 
 	r.HandleFunc("/health",
 		GetHealth,
 	).Methods(http.MethodGet)
 
+	r.HandleFunc("/.well-known/jwks.json",
+		auth.GetJWKS).Methods(http.MethodGet)
+
 	r.HandleFunc("/users",
 		user.PostUser).Methods(http.MethodPost)
 	r.HandleFunc("/users/exists",
 		user.GetUserExists).Methods(http.MethodGet)
 	r.HandleFunc("/users/{username}",
-		auth.Wrapper(controllers.AccessTokenType, user.GetUser)).Methods(http.MethodGet)
+		auth.Wrapper(controllers.AccessTokenType, controllers.AnyScope, controllers.Owner, user.GetUser)).Methods(http.MethodGet)
 	r.HandleFunc("/users/{username}",
-		auth.Wrapper(controllers.AccessTokenType, user.PutUser)).Methods(http.MethodPut)
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, user.PutUser)).Methods(http.MethodPut)
 	r.HandleFunc("/users/{username}",
-		auth.Wrapper(controllers.AccessTokenType, user.DeleteUser)).Methods(http.MethodDelete)
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, user.DeleteUser)).Methods(http.MethodDelete)
+
+	r.HandleFunc("/users/{username}/email/verification",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, user.PostEmailVerification)).Methods(http.MethodPost)
+	r.HandleFunc("/email/verify",
+		user.PostVerifyEmail).Methods(http.MethodPost)
+	r.HandleFunc("/password/forgot",
+		user.PostForgotPassword).Methods(http.MethodPost)
+	r.HandleFunc("/password/reset",
+		user.PostResetPassword).Methods(http.MethodPost)
 
 	r.HandleFunc("/users/{username}/authorize",
 		auth.GetRefreshToken).Methods(http.MethodGet)
 	r.HandleFunc("/users/{username}/token",
-		auth.Wrapper(controllers.RefreshTokenType, auth.GetAuthToken)).Methods(http.MethodGet)
+		auth.GetAuthToken).Methods(http.MethodGet)
+	r.HandleFunc("/users/{username}/tokens/revoke",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AnyScope, controllers.Owner, auth.PostRevokeToken)).Methods(http.MethodPost)
+	r.HandleFunc("/users/{username}/tokens",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, auth.DeleteTokens)).Methods(http.MethodDelete)
+
+	r.HandleFunc("/users/{username}/totp",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, auth.PostTOTP)).Methods(http.MethodPost)
+	r.HandleFunc("/users/{username}/totp/verify",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, auth.PostTOTPVerify)).Methods(http.MethodPost)
+	r.HandleFunc("/users/{username}/totp",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, auth.DeleteTOTP)).Methods(http.MethodDelete)
+
+	r.HandleFunc("/oidc/login",
+		auth.GetOIDCLogin).Methods(http.MethodGet)
+	r.HandleFunc("/oidc/callback",
+		auth.PostOIDCCallback).Methods(http.MethodPost)
+	r.HandleFunc("/oidc/otp",
+		auth.PostOIDCSecondFactor).Methods(http.MethodPost)
+	r.HandleFunc("/users/{username}/identities",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, auth.PostIdentity)).Methods(http.MethodPost)
+	r.HandleFunc("/users/{username}/identities",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, auth.GetIdentities)).Methods(http.MethodGet)
+	r.HandleFunc("/users/{username}/identities/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, auth.DeleteIdentity)).Methods(http.MethodDelete)
+
+	r.HandleFunc("/users/{username}/keys",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, auth.PostAPIKey)).Methods(http.MethodPost)
+	r.HandleFunc("/users/{username}/keys",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, auth.GetAPIKeys)).Methods(http.MethodGet)
+	r.HandleFunc("/users/{username}/keys/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, auth.DeleteAPIKey)).Methods(http.MethodDelete)
+
+	r.HandleFunc("/users/{username}/usage",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AnyScope, controllers.Owner, usage.GetUsage)).Methods(http.MethodGet)
+
+	r.HandleFunc("/users/{username}/feeds",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsWriteScope, controllers.Owner, feed.PostFeed)).Methods(http.MethodPost)
+	r.HandleFunc("/users/{username}/feeds",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsReadScope, controllers.Owner, feed.GetFeeds)).Methods(http.MethodGet)
+	r.HandleFunc("/users/{username}/feeds/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsReadScope, controllers.Owner, feed.GetFeed)).Methods(http.MethodGet)
+	r.HandleFunc("/users/{username}/feeds/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsWriteScope, controllers.Owner, feed.PutFeed)).Methods(http.MethodPut)
+	r.HandleFunc("/users/{username}/feeds/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsWriteScope, controllers.Owner, feed.DeleteFeed)).Methods(http.MethodDelete)
+	r.HandleFunc("/users/{username}/feeds/{id}/token",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsWriteScope, controllers.Owner, feed.PostFeedToken)).Methods(http.MethodPost)
+
+	r.HandleFunc("/teams",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Authenticated, team.PostTeam)).Methods(http.MethodPost)
+	r.HandleFunc("/teams/{team}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsReadScope, controllers.Authenticated, team.GetTeam)).Methods(http.MethodGet)
+	r.HandleFunc("/teams/{team}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Authenticated, team.DeleteTeam)).Methods(http.MethodDelete)
+	r.HandleFunc("/teams/{team}/members",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsReadScope, controllers.Authenticated, team.GetTeamMembers)).Methods(http.MethodGet)
+	r.HandleFunc("/teams/{team}/members/{username}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Authenticated, team.PutTeamMember)).Methods(http.MethodPut)
+	r.HandleFunc("/teams/{team}/members/{username}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Authenticated, team.DeleteTeamMember)).Methods(http.MethodDelete)
+	r.HandleFunc("/teams/{team}/invitations",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Authenticated, team.PostTeamInvitation)).Methods(http.MethodPost)
+	r.HandleFunc("/teams/{team}/invitations",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsReadScope, controllers.Authenticated, team.GetTeamInvitations)).Methods(http.MethodGet)
+	r.HandleFunc("/teams/{team}/invitations/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Authenticated, team.DeleteTeamInvitation)).Methods(http.MethodDelete)
+	r.HandleFunc("/users/{username}/teams",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsReadScope, controllers.Owner, team.GetUserTeams)).Methods(http.MethodGet)
+	r.HandleFunc("/users/{username}/invitations",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsReadScope, controllers.Owner, team.GetUserInvitations)).Methods(http.MethodGet)
+	r.HandleFunc("/users/{username}/invitations/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, team.PostUserInvitation)).Methods(http.MethodPost)
+	r.HandleFunc("/users/{username}/invitations/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Owner, team.DeleteUserInvitation)).Methods(http.MethodDelete)
+
+	r.HandleFunc("/teams/{team}/feeds",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsWriteScope, controllers.Authenticated, feed.PostFeed)).Methods(http.MethodPost)
+	r.HandleFunc("/teams/{team}/feeds",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsReadScope, controllers.Authenticated, feed.GetFeeds)).Methods(http.MethodGet)
+	r.HandleFunc("/teams/{team}/feeds/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsReadScope, controllers.Authenticated, feed.GetFeed)).Methods(http.MethodGet)
+	r.HandleFunc("/teams/{team}/feeds/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsWriteScope, controllers.Authenticated, feed.PutFeed)).Methods(http.MethodPut)
+	r.HandleFunc("/teams/{team}/feeds/{id}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsWriteScope, controllers.Authenticated, feed.DeleteFeed)).Methods(http.MethodDelete)
+	r.HandleFunc("/teams/{team}/feeds/{id}/token",
+		auth.Wrapper(controllers.AccessTokenType, controllers.FeedsWriteScope, controllers.Authenticated, feed.PostFeedToken)).Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/users",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Admin, admin.GetUsers)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/users/{username}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Admin, admin.PutUser)).Methods(http.MethodPut)
+	r.HandleFunc("/admin/users/{username}",
+		auth.Wrapper(controllers.AccessTokenType, controllers.AccountAdminScope, controllers.Admin, admin.DeleteUser)).Methods(http.MethodDelete)
+
+	r.HandleFunc("/feeds/{id}/{file}",
+		feed.GetFeedDocument).Methods(http.MethodGet)
 
 	r.HandleFunc("/scraper/website",
-		scraper.GetWebsite).Methods(http.MethodGet)
+		auth.Wrapper(controllers.AccessTokenType, controllers.ScraperUseScope, controllers.Authenticated, scraper.GetWebsite)).Methods(http.MethodGet)
+	r.HandleFunc("/scraper/items",
+		auth.Wrapper(controllers.AccessTokenType, controllers.ScraperUseScope, controllers.Authenticated, scraper.PostItems)).Methods(http.MethodPost)
 }
 
 func GetHealth(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+type apiKey interface {
+	CreateAPIKey(key *models.APIKey) error
+	GetAPIKey(id string) (*models.APIKey, error)
+	GetAPIKeys(owner string) ([]*models.APIKey, error)
+	DeleteAPIKey(owner string, id string) error
+	UpdateAPIKeyLastUsed(id string, used time.Time) error
+}
+
+const apiKeyColumns = `APIKeys.id, APIKeys.owner, APIKeys.name, APIKeys.hash, APIKeys.scopes,
+		APIKeys.created, APIKeys.expires, APIKeys.lastused`
+
+func (d *sqlDb) CreateAPIKey(key *models.APIKey) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		log.Printf("error marshalling scopes for api key %v\n%v", key.ID, err)
+		return err
+	}
+
+	expires := ""
+	if !key.Expires.IsZero() {
+		expires = key.Expires.UTC().Format(TimeFormat)
+	}
+
+	_, err = d.exec(`
+        INSERT INTO APIKeys (id, owner, name, hash, scopes, created, expires) VALUES (?, ?, ?, ?, ?, ?, ?)
+    `, key.ID, key.Owner, key.Name, key.Hash, string(scopes), key.Created.UTC().Format(TimeFormat), expires)
+	if err != nil {
+		log.Printf("error inserting api key %v into the database\n %v", key.ID, err)
+	}
+	return err
+}
+
+func (d *sqlDb) GetAPIKey(id string) (*models.APIKey, error) {
+	rows, err := d.query(`
+        SELECT `+apiKeyColumns+` FROM APIKeys
+		WHERE APIKeys.id = ?
+    `, id)
+	if err != nil {
+		log.Printf("error reading api key %v from database\n%v", id, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanAPIKey(rows)
+	}
+
+	return nil, &NotFound{fmt.Sprintf("api key %v", id)}
+}
+
+func (d *sqlDb) GetAPIKeys(owner string) ([]*models.APIKey, error) {
+	rows, err := d.query(`
+        SELECT `+apiKeyColumns+` FROM APIKeys
+		WHERE APIKeys.owner = ? ORDER BY APIKeys.created, APIKeys.id
+    `, owner)
+	if err != nil {
+		log.Printf("error reading api keys for %v from database\n%v", owner, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey deletes the key only if it belongs to owner, so one user cannot
+// revoke another's keys by guessing ids.
+func (d *sqlDb) DeleteAPIKey(owner string, id string) error {
+	resp, err := d.exec(`DELETE FROM APIKeys WHERE id = ? AND owner = ?`, id, owner)
+	if err != nil {
+		log.Printf("error deleting api key %v from the database\n %v", id, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("api key %v", id)}
+	}
+
+	return nil
+}
+
+func (d *sqlDb) UpdateAPIKeyLastUsed(id string, used time.Time) error {
+	_, err := d.exec(`
+        UPDATE APIKeys SET lastused = ? WHERE id = ?
+    `, used.UTC().Format(TimeFormat), id)
+	if err != nil {
+		log.Printf("error updating last use of api key %v\n %v", id, err)
+	}
+	return err
+}
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	k := &models.APIKey{}
+	var scopes, created, expires, lastUsed string
+	err := row.Scan(&k.ID, &k.Owner, &k.Name, &k.Hash, &scopes, &created, &expires, &lastUsed)
+	if err != nil {
+		log.Printf("error parsing database rows\n%v", err)
+		return nil, err
+	}
+
+	k.Created, err = parseTime(created)
+	if err == nil {
+		k.Expires, err = parseTime(expires)
+	}
+	if err == nil {
+		k.LastUsed, err = parseTime(lastUsed)
+	}
+	if err != nil {
+		log.Printf("error parsing times of api key %v\n%v", k.ID, err)
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(scopes), &k.Scopes)
+	if err != nil {
+		log.Printf("error parsing scopes for api key %v\n%v", k.ID, err)
+		return nil, err
+	}
+
+	return k, nil
+}
@@ -4,26 +4,97 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 const (
+	SQLite   = "sqlite3"
+	Postgres = "postgres"
+	Memory   = "memory"
+
 	TimeFormat               = "2006-01-02 15:04:05"
 	InsufficientFundsMessage = "Insufficient Funds"
 )
 
 type DB interface {
 	user
+	feed
+	item
+	token
+	apiKey
+	totp
+	userToken
+	identity
+	loginFailure
+	team
+	usage
 }
 
+// GetDB connects to the database and migrates its schema to the latest
+// version before returning it. kind is either SQLite, with path naming the
+// database file, Postgres, with path being a connection string, or Memory,
+// which ignores path and starts empty.
 func GetDB(kind, path string) (DB, error) {
+	if kind == Memory {
+		return newMemoryDb(), nil
+	}
+
+	if kind != SQLite && kind != Postgres {
+		return nil, fmt.Errorf("unsupported database type %v", kind)
+	}
+
+	if kind == SQLite {
+		path = sqliteDSN(path)
+	}
+
 	database, err := sql.Open(kind, path)
 	if err != nil {
 		log.Printf("error opening database connection\n%v", err)
 		return nil, err
 	}
-	return &sqlDb{database}, nil
+
+	if err := database.Ping(); err != nil {
+		log.Printf("error connecting to database\n%v", err)
+		database.Close()
+		return nil, err
+	}
+
+	version, err := migrate(database, kind)
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+	log.Printf("database schema is at version %v", version)
+
+	return &sqlDb{database, kind}, nil
+}
+
+// sqliteDSN turns on foreign key enforcement, which SQLite leaves off by
+// default. The migrations cascade deleting a user or feed to what it owns
+// through foreign keys, which do nothing while it is off.
+func sqliteDSN(path string) string {
+	if strings.Contains(path, "_foreign_keys=") || strings.Contains(path, "_fk=") {
+		return path
+	}
+
+	if strings.Contains(path, "?") {
+		return path + "&_foreign_keys=1"
+	}
+	return path + "?_foreign_keys=1"
+}
+
+// parseTime reads a time stored in TimeFormat, treating an empty column as
+// the zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(TimeFormat, value)
 }
 
 type NotFound struct {
@@ -41,6 +112,36 @@ func IsNotFound(err error) bool {
 	return false
 }
 
+type AlreadyExists struct {
+	resource string
+}
+
+func (err *AlreadyExists) Error() string {
+	return fmt.Sprintf("%v already exists", err.resource)
+}
+
+func IsAlreadyExists(err error) bool {
+	if _, ok := err.(*AlreadyExists); ok {
+		return true
+	}
+	return false
+}
+
+type LimitReached struct {
+	resource string
+}
+
+func (err *LimitReached) Error() string {
+	return fmt.Sprintf("%v limit reached", err.resource)
+}
+
+func IsLimitReached(err error) bool {
+	if _, ok := err.(*LimitReached); ok {
+		return true
+	}
+	return false
+}
+
 type BadQuery struct {
 	reason string
 }
@@ -69,6 +170,77 @@ func IsInsufficientFunds(err error) bool {
 	return false
 }
 
+// sqlDb implements DB for both SQLite and Postgres. Queries are written with
+// ? placeholders and rewritten for Postgres as they are run.
 type sqlDb struct {
-	db *sql.DB
+	db   *sql.DB
+	kind string
+}
+
+func (d *sqlDb) exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.db.Exec(rebind(d.kind, query), args...)
+}
+
+func (d *sqlDb) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.db.Query(rebind(d.kind, query), args...)
+}
+
+// execQuerier is implemented by both *sql.DB and *sql.Tx.
+type execQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// insert runs an INSERT into a table with an id column and returns the id of
+// the new row, or sql.ErrNoRows if a conflict clause meant nothing was inserted.
+func (d *sqlDb) insert(query string, args ...interface{}) (int64, error) {
+	return d.insertWith(d.db, query, args...)
+}
+
+// insertWith runs insert through e, such as a transaction.
+func (d *sqlDb) insertWith(e execQuerier, query string, args ...interface{}) (int64, error) {
+	if d.kind == Postgres {
+		var id int64
+		err := e.QueryRow(rebind(d.kind, query)+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	resp, err := e.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	return resp.LastInsertId()
+}
+
+// rebind rewrites ? placeholders as the numbered $n placeholders that
+// Postgres expects, leaving quoted strings untouched.
+func rebind(kind, query string) string {
+	if kind != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
 }
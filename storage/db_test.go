@@ -0,0 +1,29 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+)
+
+// forEachDB runs test against each kind of database that needs no server.
+func forEachDB(t *testing.T, test func(t *testing.T, db storage.DB)) {
+	for _, kind := range []string{storage.Memory, storage.SQLite} {
+		t.Run(kind, func(t *testing.T) {
+			db, err := storage.GetDB(kind, filepath.Join(t.TempDir(), "rss.db"))
+			if err != nil {
+				t.Fatalf("could not create database: %v", err)
+			}
+			test(t, db)
+		})
+	}
+}
+
+func createUser(t *testing.T, db storage.DB, username string) {
+	err := db.CreateUser(&models.User{Username: username, Password: "hash", Email: username + "@example.com"})
+	if err != nil {
+		t.Fatalf("could not create user %v: %v", username, err)
+	}
+}
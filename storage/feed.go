@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+type feed interface {
+	CreateFeed(feed *models.Feed, limit int64) error
+	GetFeed(id int64) (*models.Feed, error)
+	GetFeeds(owner string) ([]*models.Feed, error)
+	GetTeamFeeds(team string) ([]*models.Feed, error)
+	UpdateFeed(id int64, feed *models.Feed) error
+	DeleteFeed(id int64) error
+	GetDueFeeds(now time.Time, limit int) ([]*models.Feed, error)
+	UpdateFeedRefresh(id int64, refreshed time.Time, next time.Time, refreshErr string) error
+	UpdateFeedAccess(id int64, private bool, token string) error
+}
+
+const feedColumns = `Feeds.id, Feeds.owner, Feeds.team, Feeds.title, Feeds.description, Feeds.sourceurl, Feeds.rules,
+		Feeds.refreshinterval, Feeds.lastrefreshed, Feeds.nextrefresh, Feeds.lasterror, Feeds.private, Feeds.token`
+
+// CreateFeed stores a feed unless its owner already owns limit feeds, where 0
+// is unlimited, in which case LimitReached is returned.
+func (d *sqlDb) CreateFeed(feed *models.Feed, limit int64) error {
+	rules, err := json.Marshal(feed.Rules)
+	if err != nil {
+		log.Printf("error marshalling rules for feed %v\n%v", feed, err)
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("error starting transaction\n %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	guard := ""
+	args := []interface{}{feed.Owner, sql.NullString{String: feed.Team, Valid: feed.Team != ""}, feed.Title,
+		feed.Description, feed.SourceURL, string(rules), feed.Interval, feed.Private, feed.Token}
+	if limit > 0 {
+		// writing to the owner's row makes concurrent creations wait for
+		// each other, so they cannot all count the same feeds
+		_, err = tx.Exec(rebind(d.kind, `UPDATE Users SET plan = plan WHERE username = ?`), feed.Owner)
+		if err != nil {
+			log.Printf("error locking user %v\n %v", feed.Owner, err)
+			return err
+		}
+
+		guard = " WHERE (SELECT COUNT(*) FROM Feeds WHERE Feeds.owner = ?) < ?"
+		args = append(args, feed.Owner, limit)
+	}
+
+	feed.ID, err = d.insertWith(tx, `
+        INSERT INTO Feeds (owner, team, title, description, sourceurl, rules, refreshinterval, private, token)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?`+guard, args...)
+	if err == sql.ErrNoRows {
+		return &LimitReached{fmt.Sprintf("feed limit of %v", feed.Owner)}
+	} else if err != nil {
+		log.Printf("error inserting feed %v into the database\n %v", feed, err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *sqlDb) GetFeed(id int64) (*models.Feed, error) {
+	rows, err := d.query(`
+        SELECT `+feedColumns+` FROM Feeds
+		WHERE Feeds.id = ?
+    `, id)
+	if err != nil {
+		log.Printf("error reading feed %v from database\n%v", id, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanFeed(rows)
+	}
+
+	return nil, &NotFound{fmt.Sprintf("feed %v", id)}
+}
+
+// GetFeeds returns the feeds owned by the user rather than by one of their
+// teams.
+func (d *sqlDb) GetFeeds(owner string) ([]*models.Feed, error) {
+	rows, err := d.query(`
+        SELECT `+feedColumns+` FROM Feeds
+		WHERE Feeds.owner = ? AND Feeds.team IS NULL ORDER BY Feeds.id
+    `, owner)
+	if err != nil {
+		log.Printf("error reading feeds for %v from database\n%v", owner, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFeeds(rows)
+}
+
+func (d *sqlDb) GetTeamFeeds(team string) ([]*models.Feed, error) {
+	rows, err := d.query(`
+        SELECT `+feedColumns+` FROM Feeds
+		WHERE Feeds.team = ? ORDER BY Feeds.id
+    `, team)
+	if err != nil {
+		log.Printf("error reading feeds of team %v from database\n%v", team, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFeeds(rows)
+}
+
+func (d *sqlDb) UpdateFeed(id int64, feed *models.Feed) error {
+	values := []string{}
+	args := make([]interface{}, 0)
+
+	if feed.Title != "" {
+		values = append(values, "title = ?")
+		args = append(args, feed.Title)
+	}
+
+	if feed.Description != "" {
+		values = append(values, "description = ?")
+		args = append(args, feed.Description)
+	}
+
+	if feed.SourceURL != "" {
+		values = append(values, "sourceurl = ?")
+		args = append(args, feed.SourceURL)
+	}
+
+	if feed.Interval != 0 {
+		values = append(values, "refreshinterval = ?")
+		args = append(args, feed.Interval)
+	}
+
+	if !feed.NextRefresh.IsZero() {
+		values = append(values, "nextrefresh = ?")
+		args = append(args, feed.NextRefresh.UTC().Format(TimeFormat))
+	}
+
+	if feed.Rules != (models.ExtractionRules{}) {
+		rules, err := json.Marshal(feed.Rules)
+		if err != nil {
+			log.Printf("error marshalling rules for feed %v\n%v", id, err)
+			return err
+		}
+		values = append(values, "rules = ?")
+		args = append(args, string(rules))
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	resp, err := d.exec(`
+        UPDATE Feeds SET `+strings.Join(values, ",")+` WHERE id = ?
+    `, append(args, id)...)
+	if err != nil {
+		log.Printf("error updating feed %v in the database\n %v", id, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by update\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("feed %v", id)}
+	}
+
+	return nil
+}
+
+func (d *sqlDb) DeleteFeed(id int64) error {
+	resp, err := d.exec(`DELETE FROM Feeds WHERE id = ?`, id)
+	if err != nil {
+		log.Printf("error deleting feed %v from the database\n %v", id, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("feed %v", id)}
+	}
+
+	return nil
+}
+
+// GetDueFeeds returns feeds whose next refresh is at or before now, oldest
+// first. Feeds that have never been refreshed are always due.
+func (d *sqlDb) GetDueFeeds(now time.Time, limit int) ([]*models.Feed, error) {
+	rows, err := d.query(`
+        SELECT `+feedColumns+` FROM Feeds
+		WHERE Feeds.nextrefresh <= ? ORDER BY Feeds.nextrefresh LIMIT ?
+    `, now.UTC().Format(TimeFormat), limit)
+	if err != nil {
+		log.Printf("error reading due feeds from database\n%v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFeeds(rows)
+}
+
+func (d *sqlDb) UpdateFeedRefresh(id int64, refreshed time.Time, next time.Time, refreshErr string) error {
+	resp, err := d.exec(`
+        UPDATE Feeds SET lastrefreshed = ?, nextrefresh = ?, lasterror = ? WHERE id = ?
+    `, refreshed.UTC().Format(TimeFormat), next.UTC().Format(TimeFormat), refreshErr, id)
+	if err != nil {
+		log.Printf("error updating refresh time of feed %v\n %v", id, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by refresh update\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("feed %v", id)}
+	}
+
+	return nil
+}
+
+// UpdateFeedAccess sets whether the feed is private and the token that must be
+// presented to read it.
+func (d *sqlDb) UpdateFeedAccess(id int64, private bool, token string) error {
+	resp, err := d.exec(`
+        UPDATE Feeds SET private = ?, token = ? WHERE id = ?
+    `, private, token, id)
+	if err != nil {
+		log.Printf("error updating access to feed %v\n %v", id, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by access update\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("feed %v", id)}
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFeed(row scanner) (*models.Feed, error) {
+	f := &models.Feed{}
+	var team sql.NullString
+	var rules, lastRefreshed, nextRefresh string
+	err := row.Scan(&f.ID, &f.Owner, &team, &f.Title, &f.Description, &f.SourceURL, &rules,
+		&f.Interval, &lastRefreshed, &nextRefresh, &f.LastError, &f.Private, &f.Token)
+	if err != nil {
+		log.Printf("error parsing database rows\n%v", err)
+		return nil, err
+	}
+	f.Team = team.String
+
+	f.LastRefreshed, err = parseTime(lastRefreshed)
+	if err == nil {
+		f.NextRefresh, err = parseTime(nextRefresh)
+	}
+	if err != nil {
+		log.Printf("error parsing refresh times of feed %v\n%v", f.ID, err)
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(rules), &f.Rules)
+	if err != nil {
+		log.Printf("error parsing rules for feed %v\n%v", f.ID, err)
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func scanFeeds(rows *sql.Rows) ([]*models.Feed, error) {
+	feeds := []*models.Feed{}
+	for rows.Next() {
+		f, err := scanFeed(rows)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, f)
+	}
+
+	return feeds, nil
+}
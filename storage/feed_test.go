@@ -0,0 +1,75 @@
+package storage_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+)
+
+func TestCreateFeedLimit(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		createUser(t, db, "alice")
+		createUser(t, db, "bob")
+
+		errs := make(chan error, 10)
+		var wg sync.WaitGroup
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- db.CreateFeed(&models.Feed{Owner: "alice", Title: "Feed", Interval: 60}, 3)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		created := 0
+		for err := range errs {
+			if err == nil {
+				created++
+			} else if !storage.IsLimitReached(err) {
+				t.Errorf("creating a feed failed: %v", err)
+			}
+		}
+		if created != 3 {
+			t.Errorf("created %v feeds, want the limit of 3", created)
+		}
+
+		// the limit is per owner, and 0 is unlimited
+		if err := db.CreateFeed(&models.Feed{Owner: "bob", Title: "Feed", Interval: 60}, 3); err != nil {
+			t.Errorf("creating a feed for bob failed: %v", err)
+		}
+		if err := db.CreateFeed(&models.Feed{Owner: "alice", Title: "Feed", Interval: 60}, 0); err != nil {
+			t.Errorf("creating a feed without a limit failed: %v", err)
+		}
+	})
+}
+
+func TestUpdateFeedNextRefresh(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		createUser(t, db, "alice")
+		feed := &models.Feed{Owner: "alice", Title: "Feed", Interval: 60}
+		if err := db.CreateFeed(feed, 0); err != nil {
+			t.Fatalf("could not create feed: %v", err)
+		}
+
+		next := time.Now().Add(time.Minute * 10).UTC().Truncate(time.Second)
+		if err := db.UpdateFeed(feed.ID, &models.Feed{Interval: 10, NextRefresh: next}); err != nil {
+			t.Fatalf("could not update feed: %v", err)
+		}
+		if err := db.UpdateFeed(feed.ID, &models.Feed{Title: "Renamed"}); err != nil {
+			t.Fatalf("could not update feed: %v", err)
+		}
+
+		updated, err := db.GetFeed(feed.ID)
+		if err != nil {
+			t.Fatalf("could not get feed: %v", err)
+		}
+		if updated.Interval != 10 || !updated.NextRefresh.Equal(next) {
+			t.Errorf("feed refreshes every %v minutes from %v, want 10 from %v", updated.Interval, updated.NextRefresh, next)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+type identity interface {
+	CreateIdentity(identity *models.Identity) error
+	GetIdentity(issuer string, subject string) (*models.Identity, error)
+	GetIdentities(username string) ([]*models.Identity, error)
+	DeleteIdentity(username string, id int64) error
+	CreateLoginState(state *models.LoginState) error
+	ConsumeLoginState(hash string) (*models.LoginState, error)
+}
+
+const identityColumns = `Identities.id, Identities.username, Identities.issuer, Identities.subject,
+		Identities.email, Identities.created`
+
+// CreateIdentity links an identity to a user, returning AlreadyExists if it is
+// already linked to any user.
+func (d *sqlDb) CreateIdentity(identity *models.Identity) error {
+	var err error
+	identity.ID, err = d.insert(`
+        INSERT INTO Identities (username, issuer, subject, email, created) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (issuer, subject) DO NOTHING
+    `, identity.Username, identity.Issuer, identity.Subject, identity.Email, identity.Created.UTC().Format(TimeFormat))
+	if err == sql.ErrNoRows {
+		return &AlreadyExists{fmt.Sprintf("identity %v at %v", identity.Subject, identity.Issuer)}
+	} else if err != nil {
+		log.Printf("error inserting identity of user %v\n %v", identity.Username, err)
+	}
+	return err
+}
+
+func (d *sqlDb) GetIdentity(issuer string, subject string) (*models.Identity, error) {
+	rows, err := d.query(`
+        SELECT `+identityColumns+` FROM Identities
+		WHERE Identities.issuer = ? AND Identities.subject = ?
+    `, issuer, subject)
+	if err != nil {
+		log.Printf("error reading identity %v at %v from database\n%v", subject, issuer, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanIdentity(rows)
+	}
+
+	return nil, &NotFound{fmt.Sprintf("identity %v at %v", subject, issuer)}
+}
+
+func (d *sqlDb) GetIdentities(username string) ([]*models.Identity, error) {
+	rows, err := d.query(`
+        SELECT `+identityColumns+` FROM Identities
+		WHERE Identities.username = ? ORDER BY Identities.id
+    `, username)
+	if err != nil {
+		log.Printf("error reading identities of user %v from database\n%v", username, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*models.Identity{}
+	for rows.Next() {
+		i, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+
+	return identities, nil
+}
+
+func (d *sqlDb) DeleteIdentity(username string, id int64) error {
+	resp, err := d.exec(`DELETE FROM Identities WHERE id = ? AND username = ?`, id, username)
+	if err != nil {
+		log.Printf("error deleting identity %v from the database\n %v", id, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("identity %v", id)}
+	}
+
+	return nil
+}
+
+// CreateLoginState stores a new login state. Expired states are purged at the
+// same time, since their callbacks will be rejected.
+func (d *sqlDb) CreateLoginState(state *models.LoginState) error {
+	_, err := d.exec(`DELETE FROM LoginStates WHERE expires < ?`, time.Now().UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error purging expired login states\n %v", err)
+		return err
+	}
+
+	_, err = d.exec(`
+        INSERT INTO LoginStates (hash, verifier, nonce, username, expires) VALUES (?, ?, ?, ?, ?)
+    `, state.Hash, state.Verifier, state.Nonce, state.Username, state.Expires.UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error inserting login state\n %v", err)
+	}
+	return err
+}
+
+// ConsumeLoginState deletes and returns the unexpired login state with the
+// given hash, so that each callback can only be completed once.
+func (d *sqlDb) ConsumeLoginState(hash string) (*models.LoginState, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("error starting transaction\n %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	s := &models.LoginState{}
+	var expires string
+	err = tx.QueryRow(rebind(d.kind, `
+        SELECT LoginStates.hash, LoginStates.verifier, LoginStates.nonce, LoginStates.username, LoginStates.expires
+		FROM LoginStates WHERE LoginStates.hash = ? AND LoginStates.expires >= ?
+    `), hash, time.Now().UTC().Format(TimeFormat)).Scan(&s.Hash, &s.Verifier, &s.Nonce, &s.Username, &expires)
+	if err == sql.ErrNoRows {
+		return nil, &NotFound{"login state"}
+	} else if err != nil {
+		log.Printf("error reading login state from database\n%v", err)
+		return nil, err
+	}
+
+	s.Expires, err = parseTime(expires)
+	if err != nil {
+		log.Printf("error parsing expiry of login state\n%v", err)
+		return nil, err
+	}
+
+	resp, err := tx.Exec(rebind(d.kind, `DELETE FROM LoginStates WHERE hash = ?`), hash)
+	if err != nil {
+		log.Printf("error deleting login state\n %v", err)
+		return nil, err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, &NotFound{"login state"}
+	}
+
+	return s, tx.Commit()
+}
+
+func scanIdentity(row scanner) (*models.Identity, error) {
+	i := &models.Identity{}
+	var created string
+	err := row.Scan(&i.ID, &i.Username, &i.Issuer, &i.Subject, &i.Email, &created)
+	if err != nil {
+		log.Printf("error parsing database rows\n%v", err)
+		return nil, err
+	}
+
+	i.Created, err = parseTime(created)
+	if err != nil {
+		log.Printf("error parsing creation time of identity %v\n%v", i.ID, err)
+		return nil, err
+	}
+
+	return i, nil
+}
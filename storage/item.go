@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/rss-creator/models"
+)
+
+type item interface {
+	CreateItem(item *models.Item) (bool, error)
+	GetItems(feedID int64, limit int) ([]*models.Item, error)
+	PruneItems(owner string, keep int64) (int64, error)
+}
+
+// CreateItem stores an item unless its feed already has an item with the same
+// GUID, or had one that was evicted by PruneItems, in which case nothing is
+// stored and false is returned.
+func (d *sqlDb) CreateItem(item *models.Item) (bool, error) {
+	id, err := d.insert(`
+        INSERT INTO FeedItems (feedid, guid, title, link, summary, image, published, firstseen)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM EvictedItems WHERE EvictedItems.feedid = ? AND EvictedItems.guid = ?)
+		ON CONFLICT (feedid, guid) DO NOTHING
+    `, item.FeedID, item.GUID, item.Title, item.Link, item.Summary, item.Image,
+		item.Published.UTC().Format(TimeFormat), item.FirstSeen.UTC().Format(TimeFormat), item.FeedID, item.GUID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		log.Printf("error inserting item %v into the database\n %v", item, err)
+		return false, err
+	}
+
+	item.ID = id
+	return true, nil
+}
+
+func (d *sqlDb) GetItems(feedID int64, limit int) ([]*models.Item, error) {
+	rows, err := d.query(`
+        SELECT FeedItems.id, FeedItems.feedid, FeedItems.guid, FeedItems.title, FeedItems.link,
+		FeedItems.summary, FeedItems.image, FeedItems.published, FeedItems.firstseen FROM FeedItems
+		WHERE FeedItems.feedid = ? ORDER BY FeedItems.published DESC, FeedItems.id DESC LIMIT ?
+    `, feedID, limit)
+	if err != nil {
+		log.Printf("error reading items for feed %v from database\n%v", feedID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*models.Item{}
+	for rows.Next() {
+		i := &models.Item{}
+		var published, firstSeen string
+		err := rows.Scan(&i.ID, &i.FeedID, &i.GUID, &i.Title, &i.Link, &i.Summary, &i.Image, &published, &firstSeen)
+		if err != nil {
+			log.Printf("error parsing database rows\n%v", err)
+			return nil, err
+		}
+
+		i.Published, err = parseTime(published)
+		if err == nil {
+			i.FirstSeen, err = parseTime(firstSeen)
+		}
+		if err != nil {
+			log.Printf("error parsing times of item %v\n%v", i.ID, err)
+			return nil, err
+		}
+		items = append(items, i)
+	}
+
+	return items, nil
+}
+
+// PruneItems deletes items of the owner's feeds until only the keep first seen
+// most recently are left, and returns how many it deleted. The GUIDs of the
+// deleted items are kept, so that CreateItem does not store them again when
+// their feeds still list them.
+func (d *sqlDb) PruneItems(owner string, keep int64) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("error starting transaction\n %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(rebind(d.kind, `
+        INSERT INTO EvictedItems (feedid, guid)
+		SELECT FeedItems.feedid, FeedItems.guid FROM FeedItems
+		WHERE FeedItems.feedid IN (SELECT Feeds.id FROM Feeds WHERE Feeds.owner = ?)
+		AND FeedItems.id NOT IN (
+			SELECT Kept.id FROM FeedItems Kept JOIN Feeds ON Feeds.id = Kept.feedid WHERE Feeds.owner = ?
+			ORDER BY Kept.firstseen DESC, Kept.id DESC LIMIT ?
+		)
+		ON CONFLICT (feedid, guid) DO NOTHING
+    `), owner, owner, keep)
+	if err != nil {
+		log.Printf("error evicting items of user %v\n %v", owner, err)
+		return 0, err
+	}
+
+	// CreateItem never stores an evicted GUID, so the only items left with one
+	// are those evicted above
+	resp, err := tx.Exec(rebind(d.kind, `
+        DELETE FROM FeedItems WHERE FeedItems.feedid IN (SELECT Feeds.id FROM Feeds WHERE Feeds.owner = ?)
+		AND EXISTS (
+			SELECT 1 FROM EvictedItems WHERE EvictedItems.feedid = FeedItems.feedid AND EvictedItems.guid = FeedItems.guid
+		)
+    `), owner)
+	if err != nil {
+		log.Printf("error pruning items of user %v\n %v", owner, err)
+		return 0, err
+	}
+
+	deleted, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"log"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+// loginFailureRetention is how long failures are kept for auditing
+const loginFailureRetention = time.Hour * 24 * 90
+
+type loginFailure interface {
+	ReserveLoginFailure(failure *models.LoginFailure, since time.Time) (*models.LoginFailureCounts, error)
+	UpdateLoginFailureReason(id int64, reason string) error
+	DeleteLoginFailure(id int64) error
+	ClearLoginFailures(username string) error
+}
+
+// ReserveLoginFailure records a login attempt as failed before it is checked,
+// and counts the earlier failures since the given time for the username,
+// ignoring those cleared by a successful login, and for the IP. Concurrent
+// attempts each count those recorded ahead of them. Failures older than the
+// retention period are purged at the same time.
+func (d *sqlDb) ReserveLoginFailure(failure *models.LoginFailure, since time.Time) (*models.LoginFailureCounts, error) {
+	purgeBefore := time.Now().Add(-loginFailureRetention).UTC().Format(TimeFormat)
+	_, err := d.exec(`DELETE FROM LoginFailures WHERE attempted < ?`, purgeBefore)
+	if err != nil {
+		log.Printf("error purging old login failures\n %v", err)
+		return nil, err
+	}
+
+	failure.ID, err = d.insert(`
+        INSERT INTO LoginFailures (username, ip, reason, attempted) VALUES (?, ?, ?, ?)
+    `, failure.Username, failure.IP, failure.Reason, failure.Attempted.UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error recording login failure of user %v\n %v", failure.Username, err)
+		return nil, err
+	}
+
+	counts := &models.LoginFailureCounts{}
+	after := since.UTC().Format(TimeFormat)
+
+	var usernameLast, ipLast string
+	err = d.db.QueryRow(rebind(d.kind, `
+        SELECT COUNT(*), COALESCE(MAX(LoginFailures.attempted), '') FROM LoginFailures
+		WHERE LoginFailures.username = ? AND LoginFailures.cleared = ? AND LoginFailures.attempted >= ?
+		AND LoginFailures.id < ?
+    `), failure.Username, false, after, failure.ID).Scan(&counts.Username, &usernameLast)
+	if err == nil {
+		err = d.db.QueryRow(rebind(d.kind, `
+            SELECT COUNT(*), COALESCE(MAX(LoginFailures.attempted), '') FROM LoginFailures
+		    WHERE LoginFailures.ip = ? AND LoginFailures.attempted >= ? AND LoginFailures.id < ?
+        `), failure.IP, after, failure.ID).Scan(&counts.IP, &ipLast)
+	}
+	if err != nil {
+		log.Printf("error counting login failures of user %v\n%v", failure.Username, err)
+		return nil, err
+	}
+
+	counts.UsernameLast, err = parseTime(usernameLast)
+	if err == nil {
+		counts.IPLast, err = parseTime(ipLast)
+	}
+	if err != nil {
+		log.Printf("error parsing login failure times\n%v", err)
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// UpdateLoginFailureReason changes which factor a reserved failure records as
+// wrong.
+func (d *sqlDb) UpdateLoginFailureReason(id int64, reason string) error {
+	_, err := d.exec(`UPDATE LoginFailures SET reason = ? WHERE id = ?`, reason, id)
+	if err != nil {
+		log.Printf("error updating login failure %v\n %v", id, err)
+	}
+	return err
+}
+
+func (d *sqlDb) DeleteLoginFailure(id int64) error {
+	_, err := d.exec(`DELETE FROM LoginFailures WHERE id = ?`, id)
+	if err != nil {
+		log.Printf("error deleting login failure %v\n %v", id, err)
+	}
+	return err
+}
+
+func (d *sqlDb) ClearLoginFailures(username string) error {
+	_, err := d.exec(`
+        UPDATE LoginFailures SET cleared = ? WHERE username = ? AND cleared = ?
+    `, true, username, false)
+	if err != nil {
+		log.Printf("error clearing login failures of user %v\n %v", username, err)
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package storage_test
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+)
+
+func TestReserveLoginFailure(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		since := time.Now().Add(-time.Hour)
+		reserve := func(username string) (*models.LoginFailure, *models.LoginFailureCounts) {
+			failure := &models.LoginFailure{Username: username, IP: "192.0.2.1", Reason: "password", Attempted: time.Now()}
+			counts, err := db.ReserveLoginFailure(failure, since)
+			if err != nil {
+				t.Fatalf("reserving a login failure failed: %v", err)
+			}
+			return failure, counts
+		}
+
+		// concurrent attempts each count those ahead of them
+		counted := make(chan int, 10)
+		var wg sync.WaitGroup
+		for i := 0; i < cap(counted); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, counts := reserve("alice")
+				counted <- counts.Username
+			}()
+		}
+		wg.Wait()
+		close(counted)
+
+		got := []int{}
+		for n := range counted {
+			got = append(got, n)
+		}
+		sort.Ints(got)
+		if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !reflect.DeepEqual(got, want) {
+			t.Errorf("concurrent attempts counted %v earlier failures, want %v", got, want)
+		}
+
+		// deleted attempts no longer count, and cleared ones only count for
+		// the IP
+		failure, _ := reserve("alice")
+		if err := db.DeleteLoginFailure(failure.ID); err != nil {
+			t.Fatalf("deleting a login failure failed: %v", err)
+		}
+		if err := db.ClearLoginFailures("alice"); err != nil {
+			t.Fatalf("clearing login failures failed: %v", err)
+		}
+		if _, counts := reserve("alice"); counts.Username != 0 || counts.IP != 10 {
+			t.Errorf("counted %v failures of alice and %v of her IP, want 0 and 10", counts.Username, counts.IP)
+		}
+	})
+}
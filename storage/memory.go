@@ -0,0 +1,1313 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+// memoryDb is a DB held entirely in memory, for tests and demos. It returns
+// the same errors as sqlDb and stores times at the same precision, and hands
+// out copies so callers cannot modify stored values in place.
+type memoryDb struct {
+	mu sync.RWMutex
+
+	users   map[string]*models.User
+	feeds   map[int64]*models.Feed
+	items   map[int64][]*models.Item
+	revoked map[string]time.Time
+	// evictedItems holds the set of evicted GUIDs of each feed
+	evictedItems map[int64]map[string]bool
+	// revokedFamilies is keyed by family id
+	revokedFamilies map[string]time.Time
+	apiKeys         map[string]*models.APIKey
+	totp            map[string]*models.TOTP
+	// recoveryCodes holds the set of recovery code hashes of each user
+	recoveryCodes map[string]map[string]bool
+	// userTokens is keyed by token hash
+	userTokens map[string]*models.UserToken
+	identities map[int64]*models.Identity
+	// loginStates is keyed by state hash
+	loginStates map[string]*models.LoginState
+	// loginFailures are in the order they were recorded, along with whether
+	// each has been cleared
+	loginFailures []memoryLoginFailure
+	teams         map[string]*models.Team
+	// teamMembers is keyed by team and then username
+	teamMembers     map[string]map[string]*models.TeamMember
+	teamInvitations map[string]*models.TeamInvitation
+	// scraperUsage is keyed by username and then the start of the day, as
+	// counted by usageDay
+	scraperUsage map[string]map[time.Time]*models.Usage
+
+	nextFeedID     int64
+	nextItemID     int64
+	nextIdentityID int64
+	nextFailureID  int64
+}
+
+func newMemoryDb() *memoryDb {
+	return &memoryDb{
+		users:   map[string]*models.User{},
+		feeds:   map[int64]*models.Feed{},
+		items:   map[int64][]*models.Item{},
+		revoked: map[string]time.Time{},
+
+		evictedItems:    map[int64]map[string]bool{},
+		revokedFamilies: map[string]time.Time{},
+		apiKeys:         map[string]*models.APIKey{},
+		totp:            map[string]*models.TOTP{},
+		recoveryCodes:   map[string]map[string]bool{},
+		userTokens:      map[string]*models.UserToken{},
+		identities:      map[int64]*models.Identity{},
+		loginStates:     map[string]*models.LoginState{},
+		teams:           map[string]*models.Team{},
+		teamMembers:     map[string]map[string]*models.TeamMember{},
+		teamInvitations: map[string]*models.TeamInvitation{},
+		scraperUsage:    map[string]map[time.Time]*models.Usage{},
+	}
+}
+
+type memoryLoginFailure struct {
+	models.LoginFailure
+	cleared bool
+}
+
+// storedTime truncates a time to what TimeFormat can represent.
+func storedTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.UTC().Truncate(time.Second)
+}
+
+func (m *memoryDb) CreateUser(user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.Username]; ok {
+		return fmt.Errorf("user %v already exists", user.Username)
+	}
+
+	u := *user
+	u.EmailVerified = false
+	u.Role = models.UserRole
+	u.Disabled = false
+	u.Plan = models.DefaultPlan
+	u.Created = storedTime(time.Now())
+	m.users[u.Username] = &u
+	return nil
+}
+
+func (m *memoryDb) GetUser(username string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.users[username]
+	if !ok {
+		return nil, &NotFound{fmt.Sprintf("user %v", username)}
+	}
+
+	c := *u
+	return &c, nil
+}
+
+func (m *memoryDb) UpdateUser(username string, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[username]
+	if !ok {
+		return &NotFound{fmt.Sprintf("user %v", username)}
+	}
+
+	if user.Password != "" {
+		u.Password = user.Password
+	}
+	if user.Email != "" {
+		u.Email = user.Email
+		u.EmailVerified = false
+	}
+	return nil
+}
+
+func (m *memoryDb) VerifyEmail(username string, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[username]
+	if !ok || u.Email != email {
+		return &NotFound{fmt.Sprintf("user %v with email %v", username, email)}
+	}
+
+	u.EmailVerified = true
+	return nil
+}
+
+func (m *memoryDb) GetUsers(query *models.UserQuery) ([]*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	domain := ""
+	if query.EmailDomain != "" {
+		domain = "@" + strings.ToLower(query.EmailDomain)
+	}
+
+	users := make([]*models.User, 0, len(m.users))
+	for _, u := range m.users {
+		if !strings.HasPrefix(u.Username, query.UsernamePrefix) ||
+			!strings.HasSuffix(strings.ToLower(u.Email), domain) ||
+			(!query.CreatedAfter.IsZero() && u.Created.Before(query.CreatedAfter)) ||
+			(!query.CreatedBefore.IsZero() && (u.Created.IsZero() || !u.Created.Before(query.CreatedBefore))) {
+			continue
+		}
+		c := *u
+		users = append(users, &c)
+	}
+
+	field := strings.TrimPrefix(query.Sort, "-")
+	desc := strings.HasPrefix(query.Sort, "-")
+	sort.Slice(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		var cmp int
+		switch field {
+		case "username":
+			cmp = strings.Compare(a.Username, b.Username)
+		case "email":
+			cmp = strings.Compare(a.Email, b.Email)
+		case "created":
+			if a.Created.Before(b.Created) {
+				cmp = -1
+			} else if a.Created.After(b.Created) {
+				cmp = 1
+			}
+		}
+		if desc {
+			cmp = -cmp
+		}
+		if cmp == 0 {
+			return a.Username < b.Username
+		}
+		return cmp < 0
+	})
+
+	if query.Offset >= len(users) {
+		return []*models.User{}, nil
+	}
+	users = users[query.Offset:]
+	if len(users) > query.Count {
+		users = users[:query.Count]
+	}
+	return users, nil
+}
+
+func (m *memoryDb) UpdateUserAccess(username string, role string, disabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[username]
+	if !ok {
+		return &NotFound{fmt.Sprintf("user %v", username)}
+	}
+
+	u.Role = role
+	u.Disabled = disabled
+	return nil
+}
+
+func (m *memoryDb) UpdateUserPlan(username string, plan string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[username]
+	if !ok {
+		return &NotFound{fmt.Sprintf("user %v", username)}
+	}
+
+	u.Plan = plan
+	return nil
+}
+
+func (m *memoryDb) DeleteUser(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[username]; !ok {
+		return &NotFound{fmt.Sprintf("user %v", username)}
+	}
+
+	for team, members := range m.teamMembers {
+		if _, ok := members[username]; ok {
+			m.leaveTeam(team, username)
+		}
+	}
+	for id, i := range m.teamInvitations {
+		if i.Username == username {
+			delete(m.teamInvitations, id)
+		}
+	}
+
+	delete(m.users, username)
+	for id, f := range m.feeds {
+		if f.Owner == username {
+			delete(m.feeds, id)
+			delete(m.items, id)
+			delete(m.evictedItems, id)
+		}
+	}
+	for id, k := range m.apiKeys {
+		if k.Owner == username {
+			delete(m.apiKeys, id)
+		}
+	}
+	delete(m.totp, username)
+	delete(m.recoveryCodes, username)
+	for hash, t := range m.userTokens {
+		if t.Username == username {
+			delete(m.userTokens, hash)
+		}
+	}
+	for id, i := range m.identities {
+		if i.Username == username {
+			delete(m.identities, id)
+		}
+	}
+	delete(m.scraperUsage, username)
+	return nil
+}
+
+func (m *memoryDb) CreateFeed(feed *models.Feed, limit int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if limit > 0 {
+		var owned int64
+		for _, f := range m.feeds {
+			if f.Owner == feed.Owner {
+				owned++
+			}
+		}
+		if owned >= limit {
+			return &LimitReached{fmt.Sprintf("feed limit of %v", feed.Owner)}
+		}
+	}
+
+	m.nextFeedID++
+	feed.ID = m.nextFeedID
+
+	f := *feed
+	f.LastRefreshed = time.Time{}
+	f.NextRefresh = time.Time{}
+	f.LastError = ""
+	m.feeds[f.ID] = &f
+	return nil
+}
+
+func (m *memoryDb) GetFeed(id int64) (*models.Feed, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	f, ok := m.feeds[id]
+	if !ok {
+		return nil, &NotFound{fmt.Sprintf("feed %v", id)}
+	}
+
+	c := *f
+	return &c, nil
+}
+
+func (m *memoryDb) GetFeeds(owner string) ([]*models.Feed, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	feeds := []*models.Feed{}
+	for _, f := range m.feeds {
+		if f.Owner == owner && f.Team == "" {
+			c := *f
+			feeds = append(feeds, &c)
+		}
+	}
+
+	sort.Slice(feeds, func(i, j int) bool { return feeds[i].ID < feeds[j].ID })
+	return feeds, nil
+}
+
+func (m *memoryDb) GetTeamFeeds(team string) ([]*models.Feed, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	feeds := []*models.Feed{}
+	for _, f := range m.feeds {
+		if f.Team == team {
+			c := *f
+			feeds = append(feeds, &c)
+		}
+	}
+
+	sort.Slice(feeds, func(i, j int) bool { return feeds[i].ID < feeds[j].ID })
+	return feeds, nil
+}
+
+func (m *memoryDb) UpdateFeed(id int64, feed *models.Feed) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.feeds[id]
+	if !ok {
+		return &NotFound{fmt.Sprintf("feed %v", id)}
+	}
+
+	if feed.Title != "" {
+		f.Title = feed.Title
+	}
+	if feed.Description != "" {
+		f.Description = feed.Description
+	}
+	if feed.SourceURL != "" {
+		f.SourceURL = feed.SourceURL
+	}
+	if feed.Interval != 0 {
+		f.Interval = feed.Interval
+	}
+	if !feed.NextRefresh.IsZero() {
+		f.NextRefresh = storedTime(feed.NextRefresh)
+	}
+	if feed.Rules != (models.ExtractionRules{}) {
+		f.Rules = feed.Rules
+	}
+	return nil
+}
+
+func (m *memoryDb) DeleteFeed(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.feeds[id]; !ok {
+		return &NotFound{fmt.Sprintf("feed %v", id)}
+	}
+
+	delete(m.feeds, id)
+	delete(m.items, id)
+	delete(m.evictedItems, id)
+	return nil
+}
+
+func (m *memoryDb) GetDueFeeds(now time.Time, limit int) ([]*models.Feed, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	feeds := []*models.Feed{}
+	for _, f := range m.feeds {
+		if !f.NextRefresh.After(now) {
+			c := *f
+			feeds = append(feeds, &c)
+		}
+	}
+
+	sort.Slice(feeds, func(i, j int) bool { return feeds[i].NextRefresh.Before(feeds[j].NextRefresh) })
+	if len(feeds) > limit {
+		feeds = feeds[:limit]
+	}
+	return feeds, nil
+}
+
+func (m *memoryDb) UpdateFeedRefresh(id int64, refreshed time.Time, next time.Time, refreshErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.feeds[id]
+	if !ok {
+		return &NotFound{fmt.Sprintf("feed %v", id)}
+	}
+
+	f.LastRefreshed = storedTime(refreshed)
+	f.NextRefresh = storedTime(next)
+	f.LastError = refreshErr
+	return nil
+}
+
+func (m *memoryDb) UpdateFeedAccess(id int64, private bool, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.feeds[id]
+	if !ok {
+		return &NotFound{fmt.Sprintf("feed %v", id)}
+	}
+
+	f.Private = private
+	f.Token = token
+	return nil
+}
+
+func (m *memoryDb) CreateItem(item *models.Item) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.evictedItems[item.FeedID][item.GUID] {
+		return false, nil
+	}
+	for _, i := range m.items[item.FeedID] {
+		if i.GUID == item.GUID {
+			return false, nil
+		}
+	}
+
+	m.nextItemID++
+	item.ID = m.nextItemID
+
+	i := *item
+	i.Published = storedTime(i.Published)
+	i.FirstSeen = storedTime(i.FirstSeen)
+	m.items[i.FeedID] = append(m.items[i.FeedID], &i)
+	return true, nil
+}
+
+func (m *memoryDb) GetItems(feedID int64, limit int) ([]*models.Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := []*models.Item{}
+	for _, i := range m.items[feedID] {
+		c := *i
+		items = append(items, &c)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].Published.Equal(items[j].Published) {
+			return items[i].Published.After(items[j].Published)
+		}
+		return items[i].ID > items[j].ID
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (m *memoryDb) PruneItems(owner string, keep int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := []*models.Item{}
+	for id, f := range m.feeds {
+		if f.Owner == owner {
+			items = append(items, m.items[id]...)
+		}
+	}
+	if int64(len(items)) <= keep {
+		return 0, nil
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].FirstSeen.Equal(items[j].FirstSeen) {
+			return items[i].FirstSeen.After(items[j].FirstSeen)
+		}
+		return items[i].ID > items[j].ID
+	})
+
+	pruned := map[int64]bool{}
+	for _, i := range items[keep:] {
+		pruned[i.ID] = true
+		if m.evictedItems[i.FeedID] == nil {
+			m.evictedItems[i.FeedID] = map[string]bool{}
+		}
+		m.evictedItems[i.FeedID][i.GUID] = true
+	}
+	for id, feedItems := range m.items {
+		kept := []*models.Item{}
+		for _, i := range feedItems {
+			if !pruned[i.ID] {
+				kept = append(kept, i)
+			}
+		}
+		m.items[id] = kept
+	}
+	return int64(len(pruned)), nil
+}
+
+func (m *memoryDb) RevokeToken(jti string, username string, expires time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range m.revoked {
+		if exp.Before(now) {
+			delete(m.revoked, id)
+		}
+	}
+
+	if _, ok := m.revoked[jti]; ok {
+		return false, nil
+	}
+	m.revoked[jti] = expires
+	return true, nil
+}
+
+func (m *memoryDb) RevokeTokenFamily(family string, username string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range m.revokedFamilies {
+		if exp.Before(now) {
+			delete(m.revokedFamilies, id)
+		}
+	}
+
+	m.revokedFamilies[family] = expires
+	return nil
+}
+
+func (m *memoryDb) IsTokenRevoked(jti string, family string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.revoked[jti]; ok {
+		return true, nil
+	}
+
+	_, ok := m.revokedFamilies[family]
+	return ok && family != "", nil
+}
+
+func (m *memoryDb) RevokeAllTokens(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[username]
+	if !ok {
+		return &NotFound{fmt.Sprintf("user %v", username)}
+	}
+
+	u.TokenGeneration++
+	for id, k := range m.apiKeys {
+		if k.Owner == username {
+			delete(m.apiKeys, id)
+		}
+	}
+	return nil
+}
+
+func (m *memoryDb) CreateAPIKey(key *models.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[key.Owner]; !ok {
+		return fmt.Errorf("user %v does not exist", key.Owner)
+	}
+	if _, ok := m.apiKeys[key.ID]; ok {
+		return fmt.Errorf("api key %v already exists", key.ID)
+	}
+
+	k := copyAPIKey(key)
+	k.Key = ""
+	k.Created = storedTime(k.Created)
+	k.Expires = storedTime(k.Expires)
+	k.LastUsed = time.Time{}
+	m.apiKeys[k.ID] = k
+	return nil
+}
+
+func (m *memoryDb) GetAPIKey(id string) (*models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return nil, &NotFound{fmt.Sprintf("api key %v", id)}
+	}
+
+	return copyAPIKey(k), nil
+}
+
+func (m *memoryDb) GetAPIKeys(owner string) ([]*models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []*models.APIKey{}
+	for _, k := range m.apiKeys {
+		if k.Owner == owner {
+			keys = append(keys, copyAPIKey(k))
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].Created.Equal(keys[j].Created) {
+			return keys[i].Created.Before(keys[j].Created)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (m *memoryDb) DeleteAPIKey(owner string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ok := m.apiKeys[id]
+	if !ok || k.Owner != owner {
+		return &NotFound{fmt.Sprintf("api key %v", id)}
+	}
+
+	delete(m.apiKeys, id)
+	return nil
+}
+
+func (m *memoryDb) UpdateAPIKeyLastUsed(id string, used time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if k, ok := m.apiKeys[id]; ok {
+		k.LastUsed = storedTime(used)
+	}
+	return nil
+}
+
+// copyAPIKey copies the key along with its scopes, which would otherwise be
+// shared with the caller.
+func copyAPIKey(key *models.APIKey) *models.APIKey {
+	k := *key
+	k.Scopes = append([]string{}, key.Scopes...)
+	return &k
+}
+
+func (m *memoryDb) SetTOTP(t *models.TOTP) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[t.Username]; !ok {
+		return fmt.Errorf("user %v does not exist", t.Username)
+	}
+
+	c := *t
+	c.LastStep = 0
+	m.totp[c.Username] = &c
+	return nil
+}
+
+func (m *memoryDb) GetTOTP(username string) (*models.TOTP, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.totp[username]
+	if !ok {
+		return nil, &NotFound{fmt.Sprintf("totp of user %v", username)}
+	}
+
+	c := *t
+	return &c, nil
+}
+
+func (m *memoryDb) EnableTOTP(username string, recoveryCodes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.totp[username]
+	if !ok {
+		return &NotFound{fmt.Sprintf("totp of user %v", username)}
+	}
+
+	t.Enabled = true
+	codes := map[string]bool{}
+	for _, hash := range recoveryCodes {
+		codes[hash] = true
+	}
+	m.recoveryCodes[username] = codes
+	return nil
+}
+
+func (m *memoryDb) UseTOTPStep(username string, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.totp[username]
+	if !ok || t.LastStep >= step {
+		return false, nil
+	}
+
+	t.LastStep = step
+	return true, nil
+}
+
+func (m *memoryDb) UseRecoveryCode(username string, hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.recoveryCodes[username][hash] {
+		return false, nil
+	}
+
+	delete(m.recoveryCodes[username], hash)
+	return true, nil
+}
+
+func (m *memoryDb) DeleteTOTP(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.totp[username]; !ok {
+		return &NotFound{fmt.Sprintf("totp of user %v", username)}
+	}
+
+	delete(m.totp, username)
+	delete(m.recoveryCodes, username)
+	return nil
+}
+
+func (m *memoryDb) CreateUserToken(token *models.UserToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[token.Username]; !ok {
+		return fmt.Errorf("user %v does not exist", token.Username)
+	}
+	if _, ok := m.userTokens[token.Hash]; ok {
+		return fmt.Errorf("user token already exists")
+	}
+
+	now := time.Now()
+	for hash, t := range m.userTokens {
+		if t.Expires.Before(now) {
+			delete(m.userTokens, hash)
+		}
+	}
+
+	t := *token
+	t.Expires = storedTime(t.Expires)
+	m.userTokens[t.Hash] = &t
+	return nil
+}
+
+func (m *memoryDb) ConsumeUserToken(hash string, purpose string) (*models.UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.userTokens[hash]
+	if !ok || t.Purpose != purpose || t.Expires.Before(storedTime(time.Now())) {
+		return nil, &NotFound{fmt.Sprintf("%v token", purpose)}
+	}
+
+	delete(m.userTokens, hash)
+	c := *t
+	return &c, nil
+}
+
+func (m *memoryDb) CreateIdentity(identity *models.Identity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[identity.Username]; !ok {
+		return fmt.Errorf("user %v does not exist", identity.Username)
+	}
+	for _, i := range m.identities {
+		if i.Issuer == identity.Issuer && i.Subject == identity.Subject {
+			return &AlreadyExists{fmt.Sprintf("identity %v at %v", identity.Subject, identity.Issuer)}
+		}
+	}
+
+	m.nextIdentityID++
+	identity.ID = m.nextIdentityID
+
+	i := *identity
+	i.Created = storedTime(i.Created)
+	m.identities[i.ID] = &i
+	return nil
+}
+
+func (m *memoryDb) GetIdentity(issuer string, subject string) (*models.Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, i := range m.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			c := *i
+			return &c, nil
+		}
+	}
+
+	return nil, &NotFound{fmt.Sprintf("identity %v at %v", subject, issuer)}
+}
+
+func (m *memoryDb) GetIdentities(username string) ([]*models.Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	identities := []*models.Identity{}
+	for _, i := range m.identities {
+		if i.Username == username {
+			c := *i
+			identities = append(identities, &c)
+		}
+	}
+
+	sort.Slice(identities, func(i, j int) bool { return identities[i].ID < identities[j].ID })
+	return identities, nil
+}
+
+func (m *memoryDb) DeleteIdentity(username string, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.identities[id]
+	if !ok || i.Username != username {
+		return &NotFound{fmt.Sprintf("identity %v", id)}
+	}
+
+	delete(m.identities, id)
+	return nil
+}
+
+func (m *memoryDb) CreateLoginState(state *models.LoginState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for hash, s := range m.loginStates {
+		if s.Expires.Before(now) {
+			delete(m.loginStates, hash)
+		}
+	}
+
+	if _, ok := m.loginStates[state.Hash]; ok {
+		return fmt.Errorf("login state already exists")
+	}
+
+	s := *state
+	s.Expires = storedTime(s.Expires)
+	m.loginStates[s.Hash] = &s
+	return nil
+}
+
+func (m *memoryDb) ConsumeLoginState(hash string) (*models.LoginState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.loginStates[hash]
+	if !ok || s.Expires.Before(storedTime(time.Now())) {
+		return nil, &NotFound{"login state"}
+	}
+
+	delete(m.loginStates, hash)
+	c := *s
+	return &c, nil
+}
+
+func (m *memoryDb) ReserveLoginFailure(failure *models.LoginFailure, since time.Time) (*models.LoginFailureCounts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purgeBefore := time.Now().Add(-loginFailureRetention)
+	kept := m.loginFailures[:0]
+	for _, f := range m.loginFailures {
+		if !f.Attempted.Before(purgeBefore) {
+			kept = append(kept, f)
+		}
+	}
+	m.loginFailures = kept
+
+	// failures are in the order they were recorded, so every one counted is
+	// ahead of the new one
+	since = storedTime(since)
+	counts := &models.LoginFailureCounts{}
+	for _, f := range m.loginFailures {
+		if f.Attempted.Before(since) {
+			continue
+		}
+
+		if f.Username == failure.Username && !f.cleared {
+			counts.Username++
+			if f.Attempted.After(counts.UsernameLast) {
+				counts.UsernameLast = f.Attempted
+			}
+		}
+		if f.IP == failure.IP {
+			counts.IP++
+			if f.Attempted.After(counts.IPLast) {
+				counts.IPLast = f.Attempted
+			}
+		}
+	}
+
+	m.nextFailureID++
+	failure.ID = m.nextFailureID
+
+	f := *failure
+	f.Attempted = storedTime(f.Attempted)
+	m.loginFailures = append(m.loginFailures, memoryLoginFailure{LoginFailure: f})
+	return counts, nil
+}
+
+func (m *memoryDb) UpdateLoginFailureReason(id int64, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.loginFailures {
+		if m.loginFailures[i].ID == id {
+			m.loginFailures[i].Reason = reason
+		}
+	}
+	return nil
+}
+
+func (m *memoryDb) DeleteLoginFailure(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.loginFailures[:0]
+	for _, f := range m.loginFailures {
+		if f.ID != id {
+			kept = append(kept, f)
+		}
+	}
+	m.loginFailures = kept
+	return nil
+}
+
+func (m *memoryDb) ClearLoginFailures(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.loginFailures {
+		if m.loginFailures[i].Username == username {
+			m.loginFailures[i].cleared = true
+		}
+	}
+	return nil
+}
+
+func (m *memoryDb) CreateTeam(team *models.Team, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.teams[team.Name]; ok {
+		return &AlreadyExists{fmt.Sprintf("team %v", team.Name)}
+	}
+	if _, ok := m.users[owner]; !ok {
+		return fmt.Errorf("user %v does not exist", owner)
+	}
+
+	t := *team
+	t.Created = storedTime(t.Created)
+	m.teams[t.Name] = &t
+	m.teamMembers[t.Name] = map[string]*models.TeamMember{
+		owner: {Team: t.Name, Username: owner, Role: models.TeamOwnerRole, Joined: t.Created},
+	}
+	return nil
+}
+
+func (m *memoryDb) GetTeam(name string) (*models.Team, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.teams[name]
+	if !ok {
+		return nil, &NotFound{fmt.Sprintf("team %v", name)}
+	}
+
+	c := *t
+	return &c, nil
+}
+
+func (m *memoryDb) DeleteTeam(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.teams[name]; !ok {
+		return &NotFound{fmt.Sprintf("team %v", name)}
+	}
+
+	m.deleteTeam(name)
+	return nil
+}
+
+// deleteTeam deletes a team and everything it owns. m.mu must be held.
+func (m *memoryDb) deleteTeam(name string) {
+	delete(m.teams, name)
+	delete(m.teamMembers, name)
+	for id, f := range m.feeds {
+		if f.Team == name {
+			delete(m.feeds, id)
+			delete(m.items, id)
+			delete(m.evictedItems, id)
+		}
+	}
+	for id, i := range m.teamInvitations {
+		if i.Team == name {
+			delete(m.teamInvitations, id)
+		}
+	}
+}
+
+func (m *memoryDb) GetTeamMember(team string, username string) (*models.TeamMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	member, ok := m.teamMembers[team][username]
+	if !ok {
+		return nil, &NotFound{fmt.Sprintf("member %v of team %v", username, team)}
+	}
+
+	c := *member
+	return &c, nil
+}
+
+func (m *memoryDb) GetTeamMembers(team string) ([]*models.TeamMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := []*models.TeamMember{}
+	for _, member := range m.teamMembers[team] {
+		c := *member
+		members = append(members, &c)
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i].Username < members[j].Username })
+	return members, nil
+}
+
+func (m *memoryDb) GetUserTeams(username string) ([]*models.TeamMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	memberships := []*models.TeamMember{}
+	for _, members := range m.teamMembers {
+		if member, ok := members[username]; ok {
+			c := *member
+			memberships = append(memberships, &c)
+		}
+	}
+
+	sort.Slice(memberships, func(i, j int) bool { return memberships[i].Team < memberships[j].Team })
+	return memberships, nil
+}
+
+func (m *memoryDb) UpdateTeamMember(team string, username string, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member, ok := m.teamMembers[team][username]
+	if !ok {
+		return &NotFound{fmt.Sprintf("member %v of team %v", username, team)}
+	}
+
+	member.Role = role
+	return nil
+}
+
+func (m *memoryDb) DeleteTeamMember(team string, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.teamMembers[team][username]; !ok {
+		return &NotFound{fmt.Sprintf("member %v of team %v", username, team)}
+	}
+
+	m.leaveTeam(team, username)
+	return nil
+}
+
+// leaveTeam removes a member from a team in the same way as sqlDb. m.mu must
+// be held.
+func (m *memoryDb) leaveTeam(team string, username string) {
+	// the same order as sqlDb.leaveTeam, owners first then by username
+	rank := func(member *models.TeamMember) int {
+		switch member.Role {
+		case models.TeamOwnerRole:
+			return 0
+		case models.TeamMaintainerRole:
+			return 1
+		}
+		return 2
+	}
+
+	var successor *models.TeamMember
+	for _, member := range m.teamMembers[team] {
+		if member.Username == username {
+			continue
+		}
+		if successor == nil || rank(member) < rank(successor) ||
+			(rank(member) == rank(successor) && member.Username < successor.Username) {
+			successor = member
+		}
+	}
+
+	if successor == nil {
+		m.deleteTeam(team)
+		return
+	}
+
+	delete(m.teamMembers[team], username)
+	for _, f := range m.feeds {
+		if f.Team == team && f.Owner == username {
+			f.Owner = successor.Username
+		}
+	}
+	successor.Role = models.TeamOwnerRole
+}
+
+func (m *memoryDb) CreateTeamInvitation(invitation *models.TeamInvitation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.teams[invitation.Team]; !ok {
+		return fmt.Errorf("team %v does not exist", invitation.Team)
+	}
+	if _, ok := m.teamInvitations[invitation.ID]; ok {
+		return fmt.Errorf("team invitation %v already exists", invitation.ID)
+	}
+
+	now := time.Now()
+	for id, i := range m.teamInvitations {
+		if i.Expires.Before(now) {
+			delete(m.teamInvitations, id)
+		}
+	}
+
+	i := *invitation
+	i.Created = storedTime(i.Created)
+	i.Expires = storedTime(i.Expires)
+	m.teamInvitations[i.ID] = &i
+	return nil
+}
+
+func (m *memoryDb) GetTeamInvitation(id string) (*models.TeamInvitation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i, ok := m.teamInvitations[id]
+	if !ok || i.Expires.Before(storedTime(time.Now())) {
+		return nil, &NotFound{fmt.Sprintf("team invitation %v", id)}
+	}
+
+	c := *i
+	return &c, nil
+}
+
+func (m *memoryDb) GetTeamInvitations(team string) ([]*models.TeamInvitation, error) {
+	return m.findTeamInvitations(func(i *models.TeamInvitation) bool {
+		return i.Team == team
+	}), nil
+}
+
+func (m *memoryDb) GetUserInvitations(username string, email string) ([]*models.TeamInvitation, error) {
+	return m.findTeamInvitations(func(i *models.TeamInvitation) bool {
+		return i.Username == username || (email != "" && i.Email == email)
+	}), nil
+}
+
+func (m *memoryDb) findTeamInvitations(match func(i *models.TeamInvitation) bool) []*models.TeamInvitation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := storedTime(time.Now())
+	invitations := []*models.TeamInvitation{}
+	for _, i := range m.teamInvitations {
+		if match(i) && !i.Expires.Before(now) {
+			c := *i
+			invitations = append(invitations, &c)
+		}
+	}
+
+	sort.Slice(invitations, func(i, j int) bool {
+		if !invitations[i].Created.Equal(invitations[j].Created) {
+			return invitations[i].Created.Before(invitations[j].Created)
+		}
+		return invitations[i].ID < invitations[j].ID
+	})
+	return invitations
+}
+
+func (m *memoryDb) AcceptTeamInvitation(id string, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.teamInvitations[id]
+	if !ok || i.Expires.Before(storedTime(time.Now())) {
+		return &NotFound{fmt.Sprintf("team invitation %v", id)}
+	}
+	if _, ok := m.teamMembers[i.Team][username]; ok {
+		return &AlreadyExists{fmt.Sprintf("member %v of team %v", username, i.Team)}
+	}
+	if _, ok := m.users[username]; !ok {
+		return fmt.Errorf("user %v does not exist", username)
+	}
+
+	m.teamMembers[i.Team][username] = &models.TeamMember{
+		Team:     i.Team,
+		Username: username,
+		Role:     i.Role,
+		Joined:   storedTime(time.Now()),
+	}
+	delete(m.teamInvitations, id)
+	return nil
+}
+
+func (m *memoryDb) DeleteTeamInvitation(team string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.teamInvitations[id]
+	if !ok || i.Team != team {
+		return &NotFound{fmt.Sprintf("team invitation %v", id)}
+	}
+
+	delete(m.teamInvitations, id)
+	return nil
+}
+
+func (m *memoryDb) ReserveScrape(username string, at time.Time, bytes int64, scrapeLimit int64, byteLimit int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	day := usageDay(at)
+	if m.scraperUsage[username] == nil {
+		m.scraperUsage[username] = map[time.Time]*models.Usage{}
+	}
+	u, ok := m.scraperUsage[username][day]
+	if !ok {
+		u = &models.Usage{Day: day}
+		m.scraperUsage[username][day] = u
+	}
+
+	if (scrapeLimit > 0 && u.Scrapes >= scrapeLimit) || (byteLimit > 0 && u.Bytes+bytes > byteLimit) {
+		return false, nil
+	}
+
+	u.Scrapes++
+	u.Bytes += bytes
+	return true, nil
+}
+
+func (m *memoryDb) RefundScrapeBytes(username string, at time.Time, bytes int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, ok := m.scraperUsage[username][usageDay(at)]; ok {
+		u.Bytes -= bytes
+	}
+	return nil
+}
+
+func (m *memoryDb) GetUsage(username string, at time.Time) (*models.Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	usage := &models.Usage{Day: usageDay(at)}
+	if u, ok := m.scraperUsage[username][usage.Day]; ok {
+		usage.Scrapes = u.Scrapes
+		usage.Bytes = u.Bytes
+	}
+
+	for id, f := range m.feeds {
+		if f.Owner == username {
+			usage.Feeds++
+			usage.Items += int64(len(m.items[id]))
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations are stored per database type as NNNN_description.sql, and are
+// applied in order of their number.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+type SchemaTooNew struct {
+	current   int
+	supported int
+}
+
+func (err *SchemaTooNew) Error() string {
+	return fmt.Sprintf("database schema version %v is newer than the latest supported version %v",
+		err.current, err.supported)
+}
+
+func IsSchemaTooNew(err error) bool {
+	if _, ok := err.(*SchemaTooNew); ok {
+		return true
+	}
+	return false
+}
+
+// migrate brings the schema up to date, refusing to touch a database whose
+// schema was created by a newer build. It returns the resulting version.
+func migrate(db *sql.DB, kind string) (int, error) {
+	migrations, err := loadMigrations(kind)
+	if err != nil {
+		log.Printf("error loading %v migrations\n%v", kind, err)
+		return 0, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS SchemaVersion (version INTEGER NOT NULL)`)
+	if err != nil {
+		log.Printf("error creating schema version table\n%v", err)
+		return 0, err
+	}
+
+	current := 0
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM SchemaVersion`).Scan(&current)
+	if err != nil {
+		log.Printf("error reading schema version\n%v", err)
+		return 0, err
+	}
+
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].version
+	}
+	if current > latest {
+		return current, &SchemaTooNew{current, latest}
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		log.Printf("applying migration %v", m.name)
+		if err := applyMigration(db, kind, m); err != nil {
+			log.Printf("error applying migration %v\n%v", m.name, err)
+			return current, err
+		}
+		current = m.version
+	}
+
+	return current, nil
+}
+
+func applyMigration(db *sql.DB, kind string, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(m.sql); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(rebind(kind, `INSERT INTO SchemaVersion (version) VALUES (?)`), m.version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func loadMigrations(kind string) ([]migration, error) {
+	dir := path.Join("migrations", kind)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for database type %v", kind)
+	}
+
+	migrations := []migration{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+
+		version, err := strconv.Atoi(strings.SplitN(e.Name(), "_", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("migration %v does not start with a version number", e.Name())
+		}
+
+		contents, err := fs.ReadFile(migrationFiles, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{version, e.Name(), string(contents)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("migrations %v and %v share a version", migrations[i-1].name, migrations[i].name)
+		}
+	}
+
+	return migrations, nil
+}
@@ -0,0 +1,142 @@
+package storage_test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rss-creator/storage"
+)
+
+// sqliteMigrations is the number of each SQLite migration, in order.
+func sqliteMigrations(t *testing.T) []int {
+	entries, err := os.ReadDir(filepath.Join("migrations", storage.SQLite))
+	if err != nil {
+		t.Fatalf("could not list migrations: %v", err)
+	}
+
+	versions := []int{}
+	for _, e := range entries {
+		v, err := strconv.Atoi(strings.SplitN(e.Name(), "_", 2)[0])
+		if err != nil {
+			t.Fatalf("migration %v has no version: %v", e.Name(), err)
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+func openRaw(t *testing.T, path string) *sql.DB {
+	raw, err := sql.Open(storage.SQLite, path)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	t.Cleanup(func() { raw.Close() })
+	return raw
+}
+
+// appliedMigrations is the version recorded by each migration applied, in the
+// order they were applied.
+func appliedMigrations(t *testing.T, raw *sql.DB) []int {
+	rows, err := raw.Query(`SELECT version FROM SchemaVersion ORDER BY rowid`)
+	if err != nil {
+		t.Fatalf("could not read schema versions: %v", err)
+	}
+	defer rows.Close()
+
+	versions := []int{}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			t.Fatalf("could not read schema version: %v", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rss.db")
+	if _, err := storage.GetDB(storage.SQLite, path); err != nil {
+		t.Fatalf("could not create database: %v", err)
+	}
+
+	raw := openRaw(t, path)
+	want := sqliteMigrations(t)
+	if got := appliedMigrations(t, raw); !reflect.DeepEqual(got, want) {
+		t.Fatalf("applied migrations %v, want %v", got, want)
+	}
+
+	// an up to date database is left alone
+	db, err := storage.GetDB(storage.SQLite, path)
+	if err != nil {
+		t.Fatalf("could not reopen database: %v", err)
+	}
+	if got := appliedMigrations(t, raw); !reflect.DeepEqual(got, want) {
+		t.Errorf("applied migrations %v after reopening, want %v", got, want)
+	}
+	createUser(t, db, "alice")
+}
+
+func TestMigrateExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rss.db")
+	raw := openRaw(t, path)
+
+	// a database created by hand before migrations existed
+	_, err := raw.Exec(`
+        CREATE TABLE Users (
+            username VARCHAR(64) NOT NULL,
+            password VARCHAR(128) NOT NULL,
+            email VARCHAR(256) NOT NULL,
+            invalidatedtokens BOOLEAN NOT NULL DEFAULT FALSE,
+            PRIMARY KEY (username)
+        );
+        INSERT INTO Users (username, password, email) VALUES ('alice', 'hash', 'alice@example.com');
+    `)
+	if err != nil {
+		t.Fatalf("could not create users table: %v", err)
+	}
+
+	db, err := storage.GetDB(storage.SQLite, path)
+	if err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	if got, want := appliedMigrations(t, raw), sqliteMigrations(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("applied migrations %v, want %v", got, want)
+	}
+
+	user, err := db.GetUser("alice")
+	if err != nil {
+		t.Fatalf("could not get user created before migrating: %v", err)
+	}
+	if user.Email != "alice@example.com" {
+		t.Errorf("user created before migrating has email %v, want alice@example.com", user.Email)
+	}
+}
+
+func TestMigrateSchemaTooNew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rss.db")
+	if _, err := storage.GetDB(storage.SQLite, path); err != nil {
+		t.Fatalf("could not create database: %v", err)
+	}
+
+	// as left by a newer build with a migration this one does not know
+	raw := openRaw(t, path)
+	versions := sqliteMigrations(t)
+	latest := versions[len(versions)-1]
+	if _, err := raw.Exec(`INSERT INTO SchemaVersion (version) VALUES (?)`, latest+1); err != nil {
+		t.Fatalf("could not record schema version: %v", err)
+	}
+
+	_, err := storage.GetDB(storage.SQLite, path)
+	if !storage.IsSchemaTooNew(err) {
+		t.Fatalf("opening a newer schema returned %v, want SchemaTooNew", err)
+	}
+	if got := appliedMigrations(t, raw); len(got) != len(versions)+1 {
+		t.Errorf("applied migrations %v after refusing, want them untouched", got)
+	}
+}
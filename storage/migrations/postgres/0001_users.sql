@@ -1,4 +1,4 @@
-CREATE TABLE Users (
+CREATE TABLE IF NOT EXISTS Users (
     username VARCHAR(64) NOT NULL,
     password VARCHAR(128) NOT NULL,
     email VARCHAR(256) NOT NULL,
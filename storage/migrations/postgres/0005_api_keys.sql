@@ -0,0 +1,13 @@
+CREATE TABLE APIKeys (
+    id VARCHAR(32) NOT NULL,
+    owner VARCHAR(64) NOT NULL REFERENCES Users (username) ON DELETE CASCADE,
+    name VARCHAR(128) NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    scopes TEXT NOT NULL,
+    created VARCHAR(19) NOT NULL,
+    expires VARCHAR(19) NOT NULL DEFAULT '',
+    lastused VARCHAR(19) NOT NULL DEFAULT '',
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX APIKeysByOwner ON APIKeys (owner);
@@ -0,0 +1,14 @@
+-- laststep is the last accepted TOTP time step, so a code cannot be replayed
+CREATE TABLE TOTP (
+    username VARCHAR(64) NOT NULL REFERENCES Users (username) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    laststep BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (username)
+);
+
+CREATE TABLE RecoveryCodes (
+    username VARCHAR(64) NOT NULL REFERENCES Users (username) ON DELETE CASCADE,
+    hash VARCHAR(64) NOT NULL,
+    PRIMARY KEY (username, hash)
+);
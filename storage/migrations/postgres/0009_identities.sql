@@ -0,0 +1,24 @@
+CREATE TABLE Identities (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(64) NOT NULL REFERENCES Users (username) ON DELETE CASCADE,
+    issuer VARCHAR(256) NOT NULL,
+    subject VARCHAR(256) NOT NULL,
+    email VARCHAR(256) NOT NULL DEFAULT '',
+    created VARCHAR(19) NOT NULL,
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IdentitiesByUser ON Identities (username);
+
+-- In progress OpenID Connect logins, keyed by a hash of the state parameter.
+-- username is set when the login links an identity rather than signing in.
+CREATE TABLE LoginStates (
+    hash VARCHAR(64) NOT NULL,
+    verifier VARCHAR(128) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    username VARCHAR(64) NOT NULL DEFAULT '',
+    expires VARCHAR(19) NOT NULL,
+    PRIMARY KEY (hash)
+);
+
+CREATE INDEX LoginStatesByExpiry ON LoginStates (expires);
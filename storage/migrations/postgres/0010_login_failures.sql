@@ -0,0 +1,14 @@
+-- Failed logins, kept as an audit trail. cleared is set on a user's failures
+-- when they next log in successfully, so that they no longer count towards
+-- the user's lockout.
+CREATE TABLE LoginFailures (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(64) NOT NULL,
+    ip VARCHAR(64) NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    attempted VARCHAR(19) NOT NULL,
+    cleared BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX LoginFailuresByUser ON LoginFailures (username, attempted);
+CREATE INDEX LoginFailuresByIP ON LoginFailures (ip, attempted);
@@ -0,0 +1,2 @@
+ALTER TABLE Users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user';
+ALTER TABLE Users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- Users created before this migration are left with an empty creation time
+ALTER TABLE Users ADD COLUMN created VARCHAR(19) NOT NULL DEFAULT '';
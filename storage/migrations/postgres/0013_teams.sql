@@ -0,0 +1,39 @@
+CREATE TABLE Teams (
+    name VARCHAR(64) NOT NULL,
+    title VARCHAR(256) NOT NULL DEFAULT '',
+    created VARCHAR(19) NOT NULL,
+    PRIMARY KEY (name)
+);
+
+CREATE TABLE TeamMembers (
+    team VARCHAR(64) NOT NULL REFERENCES Teams (name) ON DELETE CASCADE,
+    username VARCHAR(64) NOT NULL REFERENCES Users (username) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL,
+    joined VARCHAR(19) NOT NULL,
+    PRIMARY KEY (team, username)
+);
+
+CREATE INDEX TeamMembersByUser ON TeamMembers (username);
+
+-- Invitations are addressed to either username or email, leaving the other
+-- empty.
+CREATE TABLE TeamInvitations (
+    id VARCHAR(32) NOT NULL,
+    team VARCHAR(64) NOT NULL REFERENCES Teams (name) ON DELETE CASCADE,
+    username VARCHAR(64) NOT NULL DEFAULT '',
+    email VARCHAR(256) NOT NULL DEFAULT '',
+    role VARCHAR(16) NOT NULL,
+    invitedby VARCHAR(64) NOT NULL,
+    created VARCHAR(19) NOT NULL,
+    expires VARCHAR(19) NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX TeamInvitationsByTeam ON TeamInvitations (team);
+CREATE INDEX TeamInvitationsByUser ON TeamInvitations (username);
+CREATE INDEX TeamInvitationsByEmail ON TeamInvitations (email);
+
+-- Feeds owned by a user rather than a team have no team.
+ALTER TABLE Feeds ADD COLUMN team VARCHAR(64) REFERENCES Teams (name) ON DELETE CASCADE;
+
+CREATE INDEX FeedsByTeam ON Feeds (team);
@@ -0,0 +1,9 @@
+-- IF NOT EXISTS lets databases created by hand before migrations existed
+-- adopt the migration history
+CREATE TABLE IF NOT EXISTS Users (
+    username VARCHAR(64) NOT NULL,
+    password VARCHAR(128) NOT NULL,
+    email VARCHAR(256) NOT NULL,
+    invalidatedtokens BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (username)
+);
@@ -0,0 +1,29 @@
+CREATE TABLE Feeds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner VARCHAR(64) NOT NULL REFERENCES Users (username) ON DELETE CASCADE,
+    title VARCHAR(256) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    sourceurl VARCHAR(2048) NOT NULL,
+    rules TEXT NOT NULL,
+    refreshinterval INTEGER NOT NULL DEFAULT 60,
+    lastrefreshed VARCHAR(19) NOT NULL DEFAULT '',
+    nextrefresh VARCHAR(19) NOT NULL DEFAULT '',
+    lasterror TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX FeedsByNextRefresh ON Feeds (nextrefresh);
+
+CREATE TABLE FeedItems (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    feedid INTEGER NOT NULL REFERENCES Feeds (id) ON DELETE CASCADE,
+    guid VARCHAR(2048) NOT NULL,
+    title TEXT NOT NULL,
+    link VARCHAR(2048) NOT NULL DEFAULT '',
+    summary TEXT NOT NULL DEFAULT '',
+    image VARCHAR(2048) NOT NULL DEFAULT '',
+    published VARCHAR(19) NOT NULL,
+    firstseen VARCHAR(19) NOT NULL,
+    UNIQUE (feedid, guid)
+);
+
+CREATE INDEX FeedItemsByFeed ON FeedItems (feedid, published);
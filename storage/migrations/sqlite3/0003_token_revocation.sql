@@ -0,0 +1,14 @@
+-- invalidatedtokens is superseded by tokengeneration and no longer read.
+-- Tokens issued before generations existed carry generation 0, so users whose
+-- tokens were invalidated start at generation 1.
+ALTER TABLE Users ADD COLUMN tokengeneration INTEGER NOT NULL DEFAULT 0;
+UPDATE Users SET tokengeneration = 1 WHERE invalidatedtokens;
+
+CREATE TABLE RevokedTokens (
+    jti VARCHAR(64) NOT NULL,
+    username VARCHAR(64) NOT NULL,
+    expires VARCHAR(19) NOT NULL,
+    PRIMARY KEY (jti)
+);
+
+CREATE INDEX RevokedTokensByExpiry ON RevokedTokens (expires);
@@ -0,0 +1,8 @@
+CREATE TABLE RevokedTokenFamilies (
+    family VARCHAR(64) NOT NULL,
+    username VARCHAR(64) NOT NULL,
+    expires VARCHAR(19) NOT NULL,
+    PRIMARY KEY (family)
+);
+
+CREATE INDEX RevokedTokenFamiliesByExpiry ON RevokedTokenFamilies (expires);
@@ -0,0 +1,3 @@
+-- Existing feeds stay public and get a token when they are made private.
+ALTER TABLE Feeds ADD COLUMN private BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE Feeds ADD COLUMN token VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+ALTER TABLE Users ADD COLUMN emailverified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Single use tokens emailed to users. Only a hash of each token is stored, and
+-- email records the address a verification token was sent to.
+CREATE TABLE UserTokens (
+    hash VARCHAR(64) NOT NULL,
+    username VARCHAR(64) NOT NULL REFERENCES Users (username) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL,
+    email VARCHAR(256) NOT NULL DEFAULT '',
+    expires VARCHAR(19) NOT NULL,
+    PRIMARY KEY (hash)
+);
+
+CREATE INDEX UserTokensByExpiry ON UserTokens (expires);
@@ -0,0 +1,11 @@
+ALTER TABLE Users ADD COLUMN plan VARCHAR(32) NOT NULL DEFAULT 'default';
+
+-- Requests made through the scraper by each user per UTC day, where day is
+-- the start of the day.
+CREATE TABLE ScraperUsage (
+    username VARCHAR(64) NOT NULL REFERENCES Users (username) ON DELETE CASCADE,
+    day VARCHAR(19) NOT NULL,
+    scrapes BIGINT NOT NULL DEFAULT 0,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (username, day)
+);
@@ -0,0 +1,5 @@
+-- Keys created before scopes were enforced could be used for anything, and
+-- keep doing so with every scope listed, since keys no longer grant every
+-- scope when they list none.
+UPDATE APIKeys SET scopes = '["feeds:read","feeds:write","scraper:use","account:admin"]'
+WHERE scopes IN ('null', '[]');
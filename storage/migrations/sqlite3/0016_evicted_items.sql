@@ -0,0 +1,9 @@
+-- GUIDs of items evicted over their owner's item limit, so that refreshes do
+-- not store them again as new items.
+CREATE TABLE EvictedItems (
+    feedid INTEGER NOT NULL REFERENCES Feeds (id) ON DELETE CASCADE,
+    guid VARCHAR(2048) NOT NULL,
+    PRIMARY KEY (feedid, guid)
+);
+
+CREATE INDEX FeedItemsByFirstSeen ON FeedItems (feedid, firstseen);
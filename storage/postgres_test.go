@@ -0,0 +1,42 @@
+package storage
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	for query, want := range map[string]string{
+		`SELECT * FROM Users`:                                 `SELECT * FROM Users`,
+		`SELECT * FROM Users WHERE username = ?`:              `SELECT * FROM Users WHERE username = $1`,
+		`UPDATE Feeds SET title = ?, rules = ? WHERE id = ?`:  `UPDATE Feeds SET title = $1, rules = $2 WHERE id = $3`,
+		`SELECT '?' FROM Users WHERE email = ?`:               `SELECT '?' FROM Users WHERE email = $1`,
+		`SELECT 'it''s ?' FROM Users WHERE a = ? AND b = '?'`: `SELECT 'it''s ?' FROM Users WHERE a = $1 AND b = '?'`,
+	} {
+		if got := rebind(Postgres, query); got != want {
+			t.Errorf("rebinding %q for Postgres gave %q, want %q", query, got, want)
+		}
+		if got := rebind(SQLite, query); got != query {
+			t.Errorf("rebinding %q for SQLite gave %q, want it unchanged", query, got)
+		}
+	}
+}
+
+// Every migration needs a Postgres counterpart, or databases of the two kinds
+// would end up at the same version with different schemas.
+func TestPostgresMigrations(t *testing.T) {
+	sqlite, err := loadMigrations(SQLite)
+	if err != nil {
+		t.Fatalf("could not load SQLite migrations: %v", err)
+	}
+	postgres, err := loadMigrations(Postgres)
+	if err != nil {
+		t.Fatalf("could not load Postgres migrations: %v", err)
+	}
+
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("got %v Postgres migrations, want one for each of the %v SQLite migrations", len(postgres), len(sqlite))
+	}
+	for i := range sqlite {
+		if postgres[i].name != sqlite[i].name {
+			t.Errorf("Postgres migration %v is %v, want %v", i+1, postgres[i].name, sqlite[i].name)
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+type team interface {
+	CreateTeam(team *models.Team, owner string) error
+	GetTeam(name string) (*models.Team, error)
+	DeleteTeam(name string) error
+	GetTeamMember(team string, username string) (*models.TeamMember, error)
+	GetTeamMembers(team string) ([]*models.TeamMember, error)
+	GetUserTeams(username string) ([]*models.TeamMember, error)
+	UpdateTeamMember(team string, username string, role string) error
+	DeleteTeamMember(team string, username string) error
+	CreateTeamInvitation(invitation *models.TeamInvitation) error
+	GetTeamInvitation(id string) (*models.TeamInvitation, error)
+	GetTeamInvitations(team string) ([]*models.TeamInvitation, error)
+	GetUserInvitations(username string, email string) ([]*models.TeamInvitation, error)
+	AcceptTeamInvitation(id string, username string) error
+	DeleteTeamInvitation(team string, id string) error
+}
+
+const teamMemberColumns = `TeamMembers.team, TeamMembers.username, TeamMembers.role, TeamMembers.joined`
+
+const teamInvitationColumns = `TeamInvitations.id, TeamInvitations.team, TeamInvitations.username,
+		TeamInvitations.email, TeamInvitations.role, TeamInvitations.invitedby, TeamInvitations.created,
+		TeamInvitations.expires`
+
+// CreateTeam creates a team with owner as its only member, returning
+// AlreadyExists if the name is taken.
+func (d *sqlDb) CreateTeam(team *models.Team, owner string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("error starting transaction\n %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	created := team.Created.UTC().Format(TimeFormat)
+	resp, err := tx.Exec(rebind(d.kind, `
+        INSERT INTO Teams (name, title, created) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO NOTHING
+    `), team.Name, team.Title, created)
+	if err != nil {
+		log.Printf("error inserting team %v into the database\n %v", team.Name, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by insert\n %v", err)
+		return err
+	}
+	if rows == 0 {
+		return &AlreadyExists{fmt.Sprintf("team %v", team.Name)}
+	}
+
+	_, err = tx.Exec(rebind(d.kind, `
+        INSERT INTO TeamMembers (team, username, role, joined) VALUES (?, ?, ?, ?)
+    `), team.Name, owner, models.TeamOwnerRole, created)
+	if err != nil {
+		log.Printf("error inserting owner %v of team %v\n %v", owner, team.Name, err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *sqlDb) GetTeam(name string) (*models.Team, error) {
+	rows, err := d.query(`
+        SELECT Teams.name, Teams.title, Teams.created FROM Teams
+		WHERE Teams.name = ?
+    `, name)
+	if err != nil {
+		log.Printf("error reading team %v from database\n%v", name, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, &NotFound{fmt.Sprintf("team %v", name)}
+	}
+
+	t := &models.Team{}
+	var created string
+	err = rows.Scan(&t.Name, &t.Title, &created)
+	if err != nil {
+		log.Printf("error parsing database rows\n%v", err)
+		return nil, err
+	}
+
+	t.Created, err = parseTime(created)
+	if err != nil {
+		log.Printf("error parsing creation time of team %v\n%v", name, err)
+		return nil, err
+	}
+	return t, nil
+}
+
+// DeleteTeam deletes the team along with its feeds.
+func (d *sqlDb) DeleteTeam(name string) error {
+	resp, err := d.exec(`DELETE FROM Teams WHERE name = ?`, name)
+	if err != nil {
+		log.Printf("error deleting team %v from the database\n %v", name, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("team %v", name)}
+	}
+
+	return nil
+}
+
+func (d *sqlDb) GetTeamMember(team string, username string) (*models.TeamMember, error) {
+	rows, err := d.query(`
+        SELECT `+teamMemberColumns+` FROM TeamMembers
+		WHERE TeamMembers.team = ? AND TeamMembers.username = ?
+    `, team, username)
+	if err != nil {
+		log.Printf("error reading member %v of team %v from database\n%v", username, team, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanTeamMember(rows)
+	}
+
+	return nil, &NotFound{fmt.Sprintf("member %v of team %v", username, team)}
+}
+
+func (d *sqlDb) GetTeamMembers(team string) ([]*models.TeamMember, error) {
+	rows, err := d.query(`
+        SELECT `+teamMemberColumns+` FROM TeamMembers
+		WHERE TeamMembers.team = ? ORDER BY TeamMembers.username
+    `, team)
+	if err != nil {
+		log.Printf("error reading members of team %v from database\n%v", team, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTeamMembers(rows)
+}
+
+// GetUserTeams returns the user's membership of each of their teams.
+func (d *sqlDb) GetUserTeams(username string) ([]*models.TeamMember, error) {
+	rows, err := d.query(`
+        SELECT `+teamMemberColumns+` FROM TeamMembers
+		WHERE TeamMembers.username = ? ORDER BY TeamMembers.team
+    `, username)
+	if err != nil {
+		log.Printf("error reading teams of user %v from database\n%v", username, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTeamMembers(rows)
+}
+
+func (d *sqlDb) UpdateTeamMember(team string, username string, role string) error {
+	resp, err := d.exec(`
+        UPDATE TeamMembers SET role = ? WHERE team = ? AND username = ?
+    `, role, team, username)
+	if err != nil {
+		log.Printf("error updating member %v of team %v\n %v", username, team, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by update\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("member %v of team %v", username, team)}
+	}
+
+	return nil
+}
+
+// DeleteTeamMember removes a user from a team. The team's feeds they own are
+// handed to the highest ranked remaining member, who becomes an owner if the
+// team would otherwise have none, and a team left without members is deleted.
+func (d *sqlDb) DeleteTeamMember(team string, username string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("error starting transaction\n %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := d.leaveTeam(tx, team, username); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// leaveTeam removes a user from a team as described by DeleteTeamMember.
+func (d *sqlDb) leaveTeam(tx *sql.Tx, team string, username string) error {
+	var successor, role string
+	err := tx.QueryRow(rebind(d.kind, `
+        SELECT username, role FROM TeamMembers WHERE team = ? AND username <> ?
+		ORDER BY CASE role WHEN ? THEN 0 WHEN ? THEN 1 ELSE 2 END, username LIMIT 1
+    `), team, username, models.TeamOwnerRole, models.TeamMaintainerRole).Scan(&successor, &role)
+	if err == sql.ErrNoRows {
+		_, err = tx.Exec(rebind(d.kind, `DELETE FROM Teams WHERE name = ?`), team)
+		if err != nil {
+			log.Printf("error deleting team %v\n %v", team, err)
+		}
+		return err
+	} else if err != nil {
+		log.Printf("error reading members of team %v\n %v", team, err)
+		return err
+	}
+
+	resp, err := tx.Exec(rebind(d.kind, `
+        DELETE FROM TeamMembers WHERE team = ? AND username = ?
+    `), team, username)
+	if err != nil {
+		log.Printf("error deleting member %v of team %v\n %v", username, team, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return err
+	}
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("member %v of team %v", username, team)}
+	}
+
+	_, err = tx.Exec(rebind(d.kind, `
+        UPDATE Feeds SET owner = ? WHERE team = ? AND owner = ?
+    `), successor, team, username)
+	if err != nil {
+		log.Printf("error handing feeds of team %v to %v\n %v", team, successor, err)
+		return err
+	}
+
+	// members are ordered owners first, so a successor that is not an owner
+	// means there are no owners left
+	if role != models.TeamOwnerRole {
+		_, err = tx.Exec(rebind(d.kind, `
+            UPDATE TeamMembers SET role = ? WHERE team = ? AND username = ?
+        `), models.TeamOwnerRole, team, successor)
+		if err != nil {
+			log.Printf("error promoting member %v of team %v\n %v", successor, team, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateTeamInvitation stores an invitation. Expired invitations are purged at
+// the same time.
+func (d *sqlDb) CreateTeamInvitation(invitation *models.TeamInvitation) error {
+	_, err := d.exec(`DELETE FROM TeamInvitations WHERE expires < ?`, time.Now().UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error purging expired team invitations\n %v", err)
+		return err
+	}
+
+	_, err = d.exec(`
+        INSERT INTO TeamInvitations (id, team, username, email, role, invitedby, created, expires)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `, invitation.ID, invitation.Team, invitation.Username, invitation.Email, invitation.Role,
+		invitation.InvitedBy, invitation.Created.UTC().Format(TimeFormat), invitation.Expires.UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error inserting invitation to team %v\n %v", invitation.Team, err)
+	}
+	return err
+}
+
+// GetTeamInvitation returns an invitation that has not expired.
+func (d *sqlDb) GetTeamInvitation(id string) (*models.TeamInvitation, error) {
+	rows, err := d.query(`
+        SELECT `+teamInvitationColumns+` FROM TeamInvitations
+		WHERE TeamInvitations.id = ? AND TeamInvitations.expires >= ?
+    `, id, time.Now().UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error reading team invitation %v from database\n%v", id, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanTeamInvitation(rows)
+	}
+
+	return nil, &NotFound{fmt.Sprintf("team invitation %v", id)}
+}
+
+func (d *sqlDb) GetTeamInvitations(team string) ([]*models.TeamInvitation, error) {
+	rows, err := d.query(`
+        SELECT `+teamInvitationColumns+` FROM TeamInvitations
+		WHERE TeamInvitations.team = ? AND TeamInvitations.expires >= ?
+		ORDER BY TeamInvitations.created, TeamInvitations.id
+    `, team, time.Now().UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error reading invitations to team %v from database\n%v", team, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTeamInvitations(rows)
+}
+
+// GetUserInvitations returns the invitations addressed to the username, or to
+// the email when it is not empty.
+func (d *sqlDb) GetUserInvitations(username string, email string) ([]*models.TeamInvitation, error) {
+	addressee := `TeamInvitations.username = ?`
+	args := []interface{}{username}
+	if email != "" {
+		addressee = `(TeamInvitations.username = ? OR TeamInvitations.email = ?)`
+		args = append(args, email)
+	}
+
+	rows, err := d.query(`
+        SELECT `+teamInvitationColumns+` FROM TeamInvitations
+		WHERE `+addressee+` AND TeamInvitations.expires >= ?
+		ORDER BY TeamInvitations.created, TeamInvitations.id
+    `, append(args, time.Now().UTC().Format(TimeFormat))...)
+	if err != nil {
+		log.Printf("error reading invitations of user %v from database\n%v", username, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTeamInvitations(rows)
+}
+
+// AcceptTeamInvitation adds the user to the team with the role they were
+// invited with, and deletes the invitation. AlreadyExists is returned, and
+// the invitation kept, if the user is already a member.
+func (d *sqlDb) AcceptTeamInvitation(id string, username string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("error starting transaction\n %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var team, role string
+	err = tx.QueryRow(rebind(d.kind, `
+        SELECT team, role FROM TeamInvitations WHERE id = ? AND expires >= ?
+    `), id, time.Now().UTC().Format(TimeFormat)).Scan(&team, &role)
+	if err == sql.ErrNoRows {
+		return &NotFound{fmt.Sprintf("team invitation %v", id)}
+	} else if err != nil {
+		log.Printf("error reading team invitation %v\n %v", id, err)
+		return err
+	}
+
+	resp, err := tx.Exec(rebind(d.kind, `
+        INSERT INTO TeamMembers (team, username, role, joined) VALUES (?, ?, ?, ?)
+		ON CONFLICT (team, username) DO NOTHING
+    `), team, username, role, time.Now().UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error adding member %v to team %v\n %v", username, team, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by insert\n %v", err)
+		return err
+	}
+	if rows == 0 {
+		return &AlreadyExists{fmt.Sprintf("member %v of team %v", username, team)}
+	}
+
+	_, err = tx.Exec(rebind(d.kind, `DELETE FROM TeamInvitations WHERE id = ?`), id)
+	if err != nil {
+		log.Printf("error deleting team invitation %v\n %v", id, err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *sqlDb) DeleteTeamInvitation(team string, id string) error {
+	resp, err := d.exec(`DELETE FROM TeamInvitations WHERE team = ? AND id = ?`, team, id)
+	if err != nil {
+		log.Printf("error deleting team invitation %v\n %v", id, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("team invitation %v", id)}
+	}
+
+	return nil
+}
+
+func scanTeamMember(row scanner) (*models.TeamMember, error) {
+	m := &models.TeamMember{}
+	var joined string
+	err := row.Scan(&m.Team, &m.Username, &m.Role, &joined)
+	if err != nil {
+		log.Printf("error parsing database rows\n%v", err)
+		return nil, err
+	}
+
+	m.Joined, err = parseTime(joined)
+	if err != nil {
+		log.Printf("error parsing join time of member %v of team %v\n%v", m.Username, m.Team, err)
+		return nil, err
+	}
+	return m, nil
+}
+
+func scanTeamMembers(rows *sql.Rows) ([]*models.TeamMember, error) {
+	members := []*models.TeamMember{}
+	for rows.Next() {
+		m, err := scanTeamMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, nil
+}
+
+func scanTeamInvitation(row scanner) (*models.TeamInvitation, error) {
+	i := &models.TeamInvitation{}
+	var created, expires string
+	err := row.Scan(&i.ID, &i.Team, &i.Username, &i.Email, &i.Role, &i.InvitedBy, &created, &expires)
+	if err != nil {
+		log.Printf("error parsing database rows\n%v", err)
+		return nil, err
+	}
+
+	i.Created, err = parseTime(created)
+	if err == nil {
+		i.Expires, err = parseTime(expires)
+	}
+	if err != nil {
+		log.Printf("error parsing times of team invitation %v\n%v", i.ID, err)
+		return nil, err
+	}
+	return i, nil
+}
+
+func scanTeamInvitations(rows *sql.Rows) ([]*models.TeamInvitation, error) {
+	invitations := []*models.TeamInvitation{}
+	for rows.Next() {
+		i, err := scanTeamInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+
+	return invitations, nil
+}
@@ -0,0 +1,90 @@
+package storage_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+)
+
+func joinTeam(t *testing.T, db storage.DB, team string, username string, role string) {
+	now := time.Now()
+	invitation := &models.TeamInvitation{
+		ID: team + "-" + username, Team: team, Username: username, Role: role,
+		InvitedBy: "alice", Created: now, Expires: now.Add(time.Hour),
+	}
+	if err := db.CreateTeamInvitation(invitation); err != nil {
+		t.Fatalf("could not invite %v: %v", username, err)
+	}
+	if err := db.AcceptTeamInvitation(invitation.ID, username); err != nil {
+		t.Fatalf("could not add %v to team %v: %v", username, team, err)
+	}
+}
+
+func TestDeleteTeamMemberSuccessor(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		for _, username := range []string{"alice", "aaron", "bob", "zed"} {
+			createUser(t, db, username)
+		}
+		if err := db.CreateTeam(&models.Team{Name: "writers", Title: "Writers"}, "alice"); err != nil {
+			t.Fatalf("could not create team: %v", err)
+		}
+		joinTeam(t, db, "writers", "aaron", models.TeamMemberRole)
+		joinTeam(t, db, "writers", "zed", models.TeamMaintainerRole)
+		joinTeam(t, db, "writers", "bob", models.TeamMaintainerRole)
+
+		feed := &models.Feed{Owner: "alice", Team: "writers", Title: "Feed", Interval: 60}
+		if err := db.CreateFeed(feed, 0); err != nil {
+			t.Fatalf("could not create feed: %v", err)
+		}
+
+		// roles of each member still in the team after each one leaves, and
+		// who then owns the feed
+		steps := []struct {
+			leaving string
+			roles   map[string]string
+			owner   string
+		}{
+			{"alice", map[string]string{"aaron": models.TeamMemberRole, "bob": models.TeamOwnerRole, "zed": models.TeamMaintainerRole}, "bob"},
+			{"zed", map[string]string{"aaron": models.TeamMemberRole, "bob": models.TeamOwnerRole}, "bob"},
+			{"bob", map[string]string{"aaron": models.TeamOwnerRole}, "aaron"},
+		}
+		for _, step := range steps {
+			if err := db.DeleteTeamMember("writers", step.leaving); err != nil {
+				t.Fatalf("%v could not leave the team: %v", step.leaving, err)
+			}
+
+			members, err := db.GetTeamMembers("writers")
+			if err != nil {
+				t.Fatalf("could not get team members: %v", err)
+			}
+			roles := map[string]string{}
+			for _, m := range members {
+				roles[m.Username] = m.Role
+			}
+			if !reflect.DeepEqual(roles, step.roles) {
+				t.Errorf("after %v left the team has roles %v, want %v", step.leaving, roles, step.roles)
+			}
+
+			got, err := db.GetFeed(feed.ID)
+			if err != nil {
+				t.Fatalf("could not get feed: %v", err)
+			}
+			if got.Owner != step.owner {
+				t.Errorf("after %v left the feed is owned by %v, want %v", step.leaving, got.Owner, step.owner)
+			}
+		}
+
+		if err := db.DeleteTeamMember("writers", "aaron"); err != nil {
+			t.Fatalf("the last member could not leave the team: %v", err)
+		}
+		if _, err := db.GetTeam("writers"); !storage.IsNotFound(err) {
+			t.Errorf("getting the team after the last member left returned %v, want not found", err)
+		}
+		if _, err := db.GetFeed(feed.ID); !storage.IsNotFound(err) {
+			t.Errorf("getting the team's feed after the last member left returned %v, want not found", err)
+		}
+	})
+}
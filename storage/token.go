@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+type token interface {
+	RevokeToken(jti string, username string, expires time.Time) (bool, error)
+	RevokeTokenFamily(family string, username string, expires time.Time) error
+	IsTokenRevoked(jti string, family string) (bool, error)
+	RevokeAllTokens(username string) error
+}
+
+// RevokeToken adds a token to the revocation list until it expires, returning
+// false if it was already on the list. Entries for tokens that have since
+// expired are purged at the same time, since expired tokens are rejected
+// regardless.
+func (d *sqlDb) RevokeToken(jti string, username string, expires time.Time) (bool, error) {
+	_, err := d.exec(`DELETE FROM RevokedTokens WHERE expires < ?`, time.Now().UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error purging expired revoked tokens\n %v", err)
+		return false, err
+	}
+
+	resp, err := d.exec(`
+        INSERT INTO RevokedTokens (jti, username, expires) VALUES (?, ?, ?)
+		ON CONFLICT (jti) DO NOTHING
+    `, jti, username, expires.UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error revoking token %v\n %v", jti, err)
+		return false, err
+	}
+
+	inserted, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by insert\n %v", err)
+		return false, err
+	}
+
+	return inserted > 0, nil
+}
+
+// RevokeTokenFamily revokes every token issued through refresh token rotation
+// from a single login. expires must be no earlier than the expiry of the
+// latest token in the family.
+func (d *sqlDb) RevokeTokenFamily(family string, username string, expires time.Time) error {
+	_, err := d.exec(`DELETE FROM RevokedTokenFamilies WHERE expires < ?`, time.Now().UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error purging expired revoked token families\n %v", err)
+		return err
+	}
+
+	_, err = d.exec(`
+        INSERT INTO RevokedTokenFamilies (family, username, expires) VALUES (?, ?, ?)
+		ON CONFLICT (family) DO NOTHING
+    `, family, username, expires.UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error revoking token family %v\n %v", family, err)
+	}
+	return err
+}
+
+// IsTokenRevoked reports whether the token or its family has been revoked.
+// Tokens issued before families existed have an empty family.
+func (d *sqlDb) IsTokenRevoked(jti string, family string) (bool, error) {
+	rows, err := d.query(`
+        SELECT RevokedTokens.jti FROM RevokedTokens WHERE RevokedTokens.jti = ?
+		UNION ALL
+		SELECT RevokedTokenFamilies.family FROM RevokedTokenFamilies
+		WHERE RevokedTokenFamilies.family = ? AND RevokedTokenFamilies.family != ''
+    `, jti, family)
+	if err != nil {
+		log.Printf("error reading revoked token %v from database\n%v", jti, err)
+		return false, err
+	}
+	defer rows.Close()
+
+	return rows.Next(), nil
+}
+
+// RevokeAllTokens invalidates every token issued to the user so far by moving
+// them to a new generation, and deletes their API keys, which are not tied to
+// a generation.
+func (d *sqlDb) RevokeAllTokens(username string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("error starting transaction\n %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	resp, err := tx.Exec(rebind(d.kind, `
+        UPDATE Users SET tokengeneration = tokengeneration + 1 WHERE username = ?
+    `), username)
+	if err != nil {
+		log.Printf("error revoking tokens of user %v\n %v", username, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by token revocation\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("user %v", username)}
+	}
+
+	_, err = tx.Exec(rebind(d.kind, `DELETE FROM APIKeys WHERE owner = ?`), username)
+	if err != nil {
+		log.Printf("error deleting api keys of user %v\n %v", username, err)
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,44 @@
+package storage_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+)
+
+func TestRevokeAllTokens(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		createUser(t, db, "alice")
+		createUser(t, db, "bob")
+		for _, owner := range []string{"alice", "bob"} {
+			key := &models.APIKey{ID: owner + "-key", Owner: owner, Name: "key", Scopes: []string{"feeds:read"}, Hash: "hash", Created: time.Now()}
+			if err := db.CreateAPIKey(key); err != nil {
+				t.Fatalf("could not create key of %v: %v", owner, err)
+			}
+		}
+
+		if err := db.RevokeAllTokens("alice"); err != nil {
+			t.Fatalf("revoking tokens failed: %v", err)
+		}
+
+		user, err := db.GetUser("alice")
+		if err != nil {
+			t.Fatalf("could not get alice: %v", err)
+		}
+		if user.TokenGeneration != 1 {
+			t.Errorf("alice is at token generation %v, want 1", user.TokenGeneration)
+		}
+		if _, err := db.GetAPIKey("alice-key"); !storage.IsNotFound(err) {
+			t.Errorf("getting alice's key after revoking her tokens returned %v, want not found", err)
+		}
+		if _, err := db.GetAPIKey("bob-key"); err != nil {
+			t.Errorf("getting bob's key failed: %v", err)
+		}
+
+		if err := db.RevokeAllTokens("mallory"); !storage.IsNotFound(err) {
+			t.Errorf("revoking tokens of a missing user returned %v, want not found", err)
+		}
+	})
+}
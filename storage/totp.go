@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/rss-creator/models"
+)
+
+type totp interface {
+	SetTOTP(t *models.TOTP) error
+	GetTOTP(username string) (*models.TOTP, error)
+	EnableTOTP(username string, recoveryCodes []string) error
+	UseTOTPStep(username string, step int64) (bool, error)
+	UseRecoveryCode(username string, hash string) (bool, error)
+	DeleteTOTP(username string) error
+}
+
+// SetTOTP stores a new, not yet enabled, enrollment in place of any existing
+// one.
+func (d *sqlDb) SetTOTP(t *models.TOTP) error {
+	_, err := d.exec(`
+        INSERT INTO TOTP (username, secret, enabled, laststep) VALUES (?, ?, ?, 0)
+		ON CONFLICT (username) DO UPDATE SET secret = excluded.secret, enabled = excluded.enabled, laststep = 0
+    `, t.Username, t.Secret, t.Enabled)
+	if err != nil {
+		log.Printf("error storing totp secret of user %v\n %v", t.Username, err)
+	}
+	return err
+}
+
+func (d *sqlDb) GetTOTP(username string) (*models.TOTP, error) {
+	rows, err := d.query(`
+        SELECT TOTP.username, TOTP.secret, TOTP.enabled, TOTP.laststep FROM TOTP
+		WHERE TOTP.username = ?
+    `, username)
+	if err != nil {
+		log.Printf("error reading totp secret of user %v from database\n%v", username, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, &NotFound{fmt.Sprintf("totp of user %v", username)}
+	}
+
+	t := &models.TOTP{}
+	err = rows.Scan(&t.Username, &t.Secret, &t.Enabled, &t.LastStep)
+	if err != nil {
+		log.Printf("error parsing database rows\n%v", err)
+		return nil, err
+	}
+	return t, nil
+}
+
+// EnableTOTP enables the user's enrollment and replaces their recovery codes
+// with the given hashes.
+func (d *sqlDb) EnableTOTP(username string, recoveryCodes []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("error starting transaction\n %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	resp, err := tx.Exec(rebind(d.kind, `UPDATE TOTP SET enabled = ? WHERE username = ?`), true, username)
+	if err != nil {
+		log.Printf("error enabling totp of user %v\n %v", username, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by update\n %v", err)
+		return err
+	}
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("totp of user %v", username)}
+	}
+
+	_, err = tx.Exec(rebind(d.kind, `DELETE FROM RecoveryCodes WHERE username = ?`), username)
+	if err != nil {
+		log.Printf("error deleting recovery codes of user %v\n %v", username, err)
+		return err
+	}
+
+	for _, hash := range recoveryCodes {
+		_, err = tx.Exec(rebind(d.kind, `INSERT INTO RecoveryCodes (username, hash) VALUES (?, ?)`), username, hash)
+		if err != nil {
+			log.Printf("error inserting recovery code of user %v\n %v", username, err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that a code from the given time step was accepted,
+// returning false if a code from the same or a later step was already used.
+func (d *sqlDb) UseTOTPStep(username string, step int64) (bool, error) {
+	resp, err := d.exec(`
+        UPDATE TOTP SET laststep = ? WHERE username = ? AND laststep < ?
+    `, step, username, step)
+	if err != nil {
+		log.Printf("error updating totp step of user %v\n %v", username, err)
+		return false, err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by update\n %v", err)
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// UseRecoveryCode deletes the recovery code with the given hash, returning
+// false if the user has no such code.
+func (d *sqlDb) UseRecoveryCode(username string, hash string) (bool, error) {
+	resp, err := d.exec(`DELETE FROM RecoveryCodes WHERE username = ? AND hash = ?`, username, hash)
+	if err != nil {
+		log.Printf("error using recovery code of user %v\n %v", username, err)
+		return false, err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+func (d *sqlDb) DeleteTOTP(username string) error {
+	_, err := d.exec(`DELETE FROM RecoveryCodes WHERE username = ?`, username)
+	if err != nil {
+		log.Printf("error deleting recovery codes of user %v\n %v", username, err)
+		return err
+	}
+
+	resp, err := d.exec(`DELETE FROM TOTP WHERE username = ?`, username)
+	if err != nil {
+		log.Printf("error deleting totp of user %v\n %v", username, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("totp of user %v", username)}
+	}
+
+	return nil
+}
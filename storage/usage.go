@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"log"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+type usage interface {
+	ReserveScrape(username string, at time.Time, bytes int64, scrapeLimit int64, byteLimit int64) (bool, error)
+	RefundScrapeBytes(username string, at time.Time, bytes int64) error
+	GetUsage(username string, at time.Time) (*models.Usage, error)
+}
+
+// usageDay is the start of the UTC day that scrapes made at t are counted in.
+func usageDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// ReserveScrape counts a request the user is about to make through the
+// scraper, along with the most bytes it may fetch, towards their usage on the
+// day of the given time. Nothing is counted and false is returned if that would
+// take them past either limit, where 0 is unlimited. The check and the count
+// are a single statement, so concurrent requests cannot overshoot the limits
+// between them.
+func (d *sqlDb) ReserveScrape(username string, at time.Time, bytes int64, scrapeLimit int64, byteLimit int64) (bool, error) {
+	day := usageDay(at).Format(TimeFormat)
+	_, err := d.exec(`
+        INSERT INTO ScraperUsage (username, day) VALUES (?, ?)
+		ON CONFLICT (username, day) DO NOTHING
+    `, username, day)
+	if err != nil {
+		log.Printf("error recording scrape of user %v\n %v", username, err)
+		return false, err
+	}
+
+	guard := ""
+	args := []interface{}{bytes, username, day}
+	if scrapeLimit > 0 {
+		guard += " AND scrapes < ?"
+		args = append(args, scrapeLimit)
+	}
+	if byteLimit > 0 {
+		guard += " AND bytes + ? <= ?"
+		args = append(args, bytes, byteLimit)
+	}
+
+	resp, err := d.exec(`
+        UPDATE ScraperUsage SET scrapes = scrapes + 1, bytes = bytes + ?
+		WHERE username = ? AND day = ?`+guard, args...)
+	if err != nil {
+		log.Printf("error recording scrape of user %v\n %v", username, err)
+		return false, err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by update\n %v", err)
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// RefundScrapeBytes takes bytes that a scrape reserved but did not fetch back
+// off the user's usage on the day of the given time.
+func (d *sqlDb) RefundScrapeBytes(username string, at time.Time, bytes int64) error {
+	_, err := d.exec(`
+        UPDATE ScraperUsage SET bytes = bytes - ? WHERE username = ? AND day = ?
+    `, bytes, username, usageDay(at).Format(TimeFormat))
+	if err != nil {
+		log.Printf("error refunding scrape of user %v\n %v", username, err)
+	}
+	return err
+}
+
+// GetUsage counts the feeds the user owns, the items stored for them, and what
+// they have fetched through the scraper on the day of the given time.
+func (d *sqlDb) GetUsage(username string, at time.Time) (*models.Usage, error) {
+	usage := &models.Usage{Day: usageDay(at)}
+	err := d.db.QueryRow(rebind(d.kind, `
+        SELECT
+		(SELECT COUNT(*) FROM Feeds WHERE Feeds.owner = ?),
+		(SELECT COUNT(*) FROM FeedItems JOIN Feeds ON Feeds.id = FeedItems.feedid WHERE Feeds.owner = ?),
+		COALESCE((SELECT ScraperUsage.scrapes FROM ScraperUsage WHERE ScraperUsage.username = ? AND ScraperUsage.day = ?), 0),
+		COALESCE((SELECT ScraperUsage.bytes FROM ScraperUsage WHERE ScraperUsage.username = ? AND ScraperUsage.day = ?), 0)
+    `), username, username, username, usage.Day.Format(TimeFormat), username, usage.Day.Format(TimeFormat)).
+		Scan(&usage.Feeds, &usage.Items, &usage.Scrapes, &usage.Bytes)
+	if err != nil {
+		log.Printf("error reading usage of user %v from database\n%v", username, err)
+		return nil, err
+	}
+
+	return usage, nil
+}
@@ -4,22 +4,38 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/rss-creator/models"
+	"github.com/rss-creator/utils"
 )
 
+const userColumns = `Users.username, Users.password, Users.email, Users.emailverified,
+        Users.role, Users.disabled, Users.plan, Users.created, Users.tokengeneration`
+
+// UserSorts maps the fields users can be sorted by to their columns
+var UserSorts = map[string]string{
+	"username": "Users.username",
+	"email":    "Users.email",
+	"created":  "Users.created",
+}
+
 type user interface {
 	CreateUser(user *models.User) error
 	GetUser(username string) (*models.User, error)
 	UpdateUser(username string, user *models.User) error
 	DeleteUser(username string) error
-	UpdateTokenValidity(username string, valid bool) error
+	VerifyEmail(username string, email string) error
+	GetUsers(query *models.UserQuery) ([]*models.User, error)
+	UpdateUserAccess(username string, role string, disabled bool) error
+	UpdateUserPlan(username string, plan string) error
 }
 
 func (d *sqlDb) CreateUser(user *models.User) error {
-	_, err := d.db.Exec(`
-        INSERT INTO Users (username, password, email) VALUES (?, ?, ?)
-    `, user.Username, user.Password, user.Email)
+	_, err := d.exec(`
+        INSERT INTO Users (username, password, email, role, created) VALUES (?, ?, ?, ?, ?)
+    `, user.Username, user.Password, user.Email, models.UserRole, time.Now().UTC().Format(TimeFormat))
 	if err != nil {
 		log.Printf("error inserting user %v into the database\n %v", user, err)
 	}
@@ -27,8 +43,8 @@ func (d *sqlDb) CreateUser(user *models.User) error {
 }
 
 func (d *sqlDb) GetUser(username string) (*models.User, error) {
-	rows, err := d.db.Query(`
-        SELECT Users.username, Users.password, Users.email, Users.invalidatedtokens FROM Users
+	rows, err := d.query(`
+        SELECT `+userColumns+` FROM Users
 		WHERE Users.username = ?
     `, username)
 	if err != nil {
@@ -38,16 +54,67 @@ func (d *sqlDb) GetUser(username string) (*models.User, error) {
 	defer rows.Close()
 
 	if rows.Next() {
-		u := &models.User{}
-		err := rows.Scan(&u.Username, &u.Password, &u.Email, &u.InvalidatedTokens)
+		return scanUser(rows)
+	}
+
+	return nil, &NotFound{fmt.Sprintf("user %v", username)}
+}
+
+// GetUsers returns a page of the users matching the query. Users are ordered
+// by username when the query does not name a sort, and ties are broken by
+// username so pages do not overlap.
+func (d *sqlDb) GetUsers(query *models.UserQuery) ([]*models.User, error) {
+	domain := ""
+	if query.EmailDomain != "" {
+		domain = "@" + strings.ToLower(query.EmailDomain)
+	}
+
+	where, args := utils.SqlWhere([]utils.SqlCondition{
+		{
+			Column:     fmt.Sprintf("SUBSTR(Users.username, 1, %d)", utf8.RuneCountInString(query.UsernamePrefix)),
+			Comparator: "=",
+			Arg:        query.UsernamePrefix,
+		},
+		{
+			Column:     fmt.Sprintf("LOWER(SUBSTR(Users.email, LENGTH(Users.email) - %d))", utf8.RuneCountInString(domain)-1),
+			Comparator: "=",
+			Arg:        domain,
+		},
+		{Column: "Users.created", Comparator: ">=", Arg: query.CreatedAfter},
+		// users created before it was recorded have no creation time, which
+		// would otherwise sort before every other
+		{Column: "NULLIF(Users.created, '')", Comparator: "<", Arg: query.CreatedBefore},
+	})
+
+	order := "Users.username"
+	if column, ok := UserSorts[strings.TrimPrefix(query.Sort, "-")]; ok {
+		order = column
+		if strings.HasPrefix(query.Sort, "-") {
+			order += " DESC"
+		}
+		order += ", Users.username"
+	}
+
+	rows, err := d.query(`
+        SELECT `+userColumns+` FROM Users `+where+`
+		ORDER BY `+order+` LIMIT ? OFFSET ?
+    `, append(args, query.Count, query.Offset)...)
+	if err != nil {
+		log.Printf("error reading users from database\n%v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*models.User, 0)
+	for rows.Next() {
+		u, err := scanUser(rows)
 		if err != nil {
-			log.Printf("error parsing database rows\n%v", err)
 			return nil, err
 		}
-		return u, nil
+		users = append(users, u)
 	}
 
-	return nil, &NotFound{fmt.Sprintf("user %v", username)}
+	return users, rows.Err()
 }
 
 func (d *sqlDb) UpdateUser(username string, user *models.User) error {
@@ -60,15 +127,15 @@ func (d *sqlDb) UpdateUser(username string, user *models.User) error {
 	}
 
 	if user.Email != "" {
-		values = append(values, "email = ?")
-		args = append(args, user.Email)
+		values = append(values, "email = ?", "emailverified = ?")
+		args = append(args, user.Email, false)
 	}
 
 	if len(args) == 0 {
 		return nil
 	}
 
-	resp, err := d.db.Exec(`
+	resp, err := d.exec(`
         UPDATE Users SET `+strings.Join(values, ",")+` WHERE username = ?
     `, append(args, username)...)
 	if err != nil {
@@ -88,15 +155,106 @@ func (d *sqlDb) UpdateUser(username string, user *models.User) error {
 	return err
 }
 
+// DeleteUser deletes the user and everything they own. They leave each of
+// their teams first, as described by DeleteTeamMember, so that feeds they
+// created for a team stay with it.
 func (d *sqlDb) DeleteUser(username string) error {
-	resp, err := d.db.Exec(`DELETE FROM Users WHERE username = ?`, username)
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("error starting transaction\n %v", err)
+		return err
+	}
+	defer tx.Rollback()
 
-	rows, err := resp.RowsAffected()
+	rows, err := tx.Query(rebind(d.kind, `SELECT team FROM TeamMembers WHERE username = ?`), username)
+	if err != nil {
+		log.Printf("error reading teams of user %v\n %v", username, err)
+		return err
+	}
+
+	teams := []string{}
+	for rows.Next() {
+		var team string
+		if err := rows.Scan(&team); err != nil {
+			rows.Close()
+			log.Printf("error parsing database rows\n%v", err)
+			return err
+		}
+		teams = append(teams, team)
+	}
+	rows.Close()
+
+	for _, team := range teams {
+		if err := d.leaveTeam(tx, team, username); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(rebind(d.kind, `DELETE FROM TeamInvitations WHERE username = ?`), username)
+	if err != nil {
+		log.Printf("error deleting team invitations of user %v\n %v", username, err)
+		return err
+	}
+
+	resp, err := tx.Exec(rebind(d.kind, `DELETE FROM Users WHERE username = ?`), username)
+	if err != nil {
+		log.Printf("error deleting user %v from the database\n %v", username, err)
+		return err
+	}
+
+	deleted, err := resp.RowsAffected()
 	if err != nil {
 		log.Printf("error getting number of rows affected by delete\n %v", err)
 		return err
 	}
 
+	if deleted == 0 {
+		return &NotFound{fmt.Sprintf("user %v", username)}
+	}
+
+	return tx.Commit()
+}
+
+// VerifyEmail marks the user's email as verified, provided it is still the
+// address the verification was sent to.
+func (d *sqlDb) VerifyEmail(username string, email string) error {
+	resp, err := d.exec(`
+        UPDATE Users SET emailverified = ? WHERE username = ? AND email = ?
+    `, true, username, email)
+	if err != nil {
+		log.Printf("error verifying email of user %v\n %v", username, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by update\n %v", err)
+		return err
+	}
+
+	if rows == 0 {
+		return &NotFound{fmt.Sprintf("user %v with email %v", username, email)}
+	}
+
+	return nil
+}
+
+// UpdateUserAccess sets the user's role and whether their account is disabled.
+func (d *sqlDb) UpdateUserAccess(username string, role string, disabled bool) error {
+	resp, err := d.exec(`
+        UPDATE Users SET role = ?, disabled = ? WHERE username = ?
+    `, role, disabled, username)
+	if err != nil {
+		log.Printf("error updating access of user %v\n %v", username, err)
+		return err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by update\n %v", err)
+		return err
+	}
+
 	if rows == 0 {
 		return &NotFound{fmt.Sprintf("user %v", username)}
 	}
@@ -104,18 +262,19 @@ func (d *sqlDb) DeleteUser(username string) error {
 	return nil
 }
 
-func (d *sqlDb) UpdateTokenValidity(username string, valid bool) error {
-	resp, err := d.db.Exec(`
-        UPDATE Users SET invalidatedtokens = ? WHERE username = ?
-    `, !valid, username)
+// UpdateUserPlan moves the user to another plan.
+func (d *sqlDb) UpdateUserPlan(username string, plan string) error {
+	resp, err := d.exec(`
+        UPDATE Users SET plan = ? WHERE username = ?
+    `, plan, username)
 	if err != nil {
-		log.Printf("error updating user %v token validity\n %v", username, err)
+		log.Printf("error updating plan of user %v\n %v", username, err)
 		return err
 	}
 
 	rows, err := resp.RowsAffected()
 	if err != nil {
-		log.Printf("error getting number of rows affected by token validity update\n %v", err)
+		log.Printf("error getting number of rows affected by update\n %v", err)
 		return err
 	}
 
@@ -123,5 +282,22 @@ func (d *sqlDb) UpdateTokenValidity(username string, valid bool) error {
 		return &NotFound{fmt.Sprintf("user %v", username)}
 	}
 
-	return err
+	return nil
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	u := &models.User{}
+	var created string
+	err := row.Scan(&u.Username, &u.Password, &u.Email, &u.EmailVerified, &u.Role, &u.Disabled, &u.Plan, &created, &u.TokenGeneration)
+	if err != nil {
+		log.Printf("error parsing database rows\n%v", err)
+		return nil, err
+	}
+
+	u.Created, err = parseTime(created)
+	if err != nil {
+		log.Printf("error parsing creation time of user %v\n%v", u.Username, err)
+		return nil, err
+	}
+	return u, nil
 }
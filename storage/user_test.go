@@ -0,0 +1,107 @@
+package storage_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+)
+
+func TestGetUsersCreatedUnknown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rss.db")
+	db, err := storage.GetDB(storage.SQLite, path)
+	if err != nil {
+		t.Fatalf("could not create database: %v", err)
+	}
+	createUser(t, db, "alice")
+	createUser(t, db, "bob")
+
+	// as left by the migration that started recording creation times
+	raw, err := sql.Open(storage.SQLite, path)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	defer raw.Close()
+	if _, err := raw.Exec(`UPDATE Users SET created = '' WHERE username = 'bob'`); err != nil {
+		t.Fatalf("could not clear creation time: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query models.UserQuery
+		want  []string
+	}{
+		{"no filter", models.UserQuery{}, []string{"alice", "bob"}},
+		{"created before", models.UserQuery{CreatedBefore: time.Now().Add(time.Hour)}, []string{"alice"}},
+		{"created after", models.UserQuery{CreatedAfter: time.Now().Add(-time.Hour)}, []string{"alice"}},
+	}
+	for _, test := range tests {
+		test.query.Count = 10
+		users, err := db.GetUsers(&test.query)
+		if err != nil {
+			t.Fatalf("getting users %v failed: %v", test.name, err)
+		}
+
+		got := []string{}
+		for _, u := range users {
+			got = append(got, u.Username)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("getting users %v returned %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetUsers(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		for _, u := range []*models.User{
+			{Username: "carol", Password: "hash", Email: "carol@other.com"},
+			{Username: "alice", Password: "hash", Email: "alice@example.com"},
+			{Username: "albert", Password: "hash", Email: "albert@Example.org"},
+			{Username: "bob", Password: "hash", Email: "bob@example.com"},
+		} {
+			if err := db.CreateUser(u); err != nil {
+				t.Fatalf("could not create user %v: %v", u.Username, err)
+			}
+		}
+
+		tests := []struct {
+			name  string
+			query models.UserQuery
+			want  []string
+		}{
+			{"no filter", models.UserQuery{}, []string{"albert", "alice", "bob", "carol"}},
+			{"username prefix", models.UserQuery{UsernamePrefix: "al"}, []string{"albert", "alice"}},
+			{"email domain", models.UserQuery{EmailDomain: "example.com"}, []string{"alice", "bob"}},
+			{"email domain in another case", models.UserQuery{EmailDomain: "EXAMPLE.org"}, []string{"albert"}},
+			{"part of an email domain", models.UserQuery{EmailDomain: "ample.com"}, []string{}},
+			{"both", models.UserQuery{UsernamePrefix: "al", EmailDomain: "example.com"}, []string{"alice"}},
+			{"sorted by email", models.UserQuery{Sort: "email"}, []string{"albert", "alice", "bob", "carol"}},
+			{"sorted by username descending", models.UserQuery{Sort: "-username"}, []string{"carol", "bob", "alice", "albert"}},
+			{"first page", models.UserQuery{Count: 3}, []string{"albert", "alice", "bob"}},
+			{"second page", models.UserQuery{Count: 3, Offset: 3}, []string{"carol"}},
+			{"past the end", models.UserQuery{Count: 3, Offset: 6}, []string{}},
+		}
+		for _, test := range tests {
+			if test.query.Count == 0 {
+				test.query.Count = 10
+			}
+			users, err := db.GetUsers(&test.query)
+			if err != nil {
+				t.Fatalf("getting users %v failed: %v", test.name, err)
+			}
+
+			got := []string{}
+			for _, u := range users {
+				got = append(got, u.Username)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("getting users %v returned %v, want %v", test.name, got, test.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+type userToken interface {
+	CreateUserToken(token *models.UserToken) error
+	ConsumeUserToken(hash string, purpose string) (*models.UserToken, error)
+}
+
+// CreateUserToken stores a new token. Expired tokens are purged at the same
+// time, since they can no longer be consumed.
+func (d *sqlDb) CreateUserToken(token *models.UserToken) error {
+	_, err := d.exec(`DELETE FROM UserTokens WHERE expires < ?`, time.Now().UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error purging expired user tokens\n %v", err)
+		return err
+	}
+
+	_, err = d.exec(`
+        INSERT INTO UserTokens (hash, username, purpose, email, expires) VALUES (?, ?, ?, ?, ?)
+    `, token.Hash, token.Username, token.Purpose, token.Email, token.Expires.UTC().Format(TimeFormat))
+	if err != nil {
+		log.Printf("error inserting %v token of user %v\n %v", token.Purpose, token.Username, err)
+	}
+	return err
+}
+
+// ConsumeUserToken deletes and returns the unexpired token with the given hash
+// and purpose, so that it can only be used once.
+func (d *sqlDb) ConsumeUserToken(hash string, purpose string) (*models.UserToken, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Printf("error starting transaction\n %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t := &models.UserToken{}
+	var expires string
+	err = tx.QueryRow(rebind(d.kind, `
+        SELECT UserTokens.hash, UserTokens.username, UserTokens.purpose, UserTokens.email, UserTokens.expires
+		FROM UserTokens WHERE UserTokens.hash = ? AND UserTokens.purpose = ? AND UserTokens.expires >= ?
+    `), hash, purpose, time.Now().UTC().Format(TimeFormat)).Scan(&t.Hash, &t.Username, &t.Purpose, &t.Email, &expires)
+	if err == sql.ErrNoRows {
+		return nil, &NotFound{fmt.Sprintf("%v token", purpose)}
+	} else if err != nil {
+		log.Printf("error reading %v token from database\n%v", purpose, err)
+		return nil, err
+	}
+
+	t.Expires, err = parseTime(expires)
+	if err != nil {
+		log.Printf("error parsing expiry of %v token\n%v", purpose, err)
+		return nil, err
+	}
+
+	// a concurrent request may have consumed the token since it was read
+	resp, err := tx.Exec(rebind(d.kind, `DELETE FROM UserTokens WHERE hash = ?`), hash)
+	if err != nil {
+		log.Printf("error deleting %v token\n %v", purpose, err)
+		return nil, err
+	}
+
+	rows, err := resp.RowsAffected()
+	if err != nil {
+		log.Printf("error getting number of rows affected by delete\n %v", err)
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, &NotFound{fmt.Sprintf("%v token", purpose)}
+	}
+
+	return t, tx.Commit()
+}
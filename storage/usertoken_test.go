@@ -0,0 +1,44 @@
+package storage_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/storage"
+)
+
+func TestConsumeUserToken(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db storage.DB) {
+		createUser(t, db, "alice")
+
+		tokens := []*models.UserToken{
+			{Hash: "valid", Username: "alice", Purpose: models.ResetPasswordPurpose, Email: "alice@example.com", Expires: time.Now().Add(time.Hour)},
+			{Hash: "expired", Username: "alice", Purpose: models.ResetPasswordPurpose, Email: "alice@example.com", Expires: time.Now().Add(-time.Minute)},
+		}
+		for _, token := range tokens {
+			if err := db.CreateUserToken(token); err != nil {
+				t.Fatalf("could not create token: %v", err)
+			}
+		}
+
+		if _, err := db.ConsumeUserToken("valid", models.VerifyEmailPurpose); !storage.IsNotFound(err) {
+			t.Errorf("consuming a token for another purpose returned %v, want not found", err)
+		}
+
+		token, err := db.ConsumeUserToken("valid", models.ResetPasswordPurpose)
+		if err != nil {
+			t.Fatalf("could not consume token: %v", err)
+		}
+		if token.Username != "alice" || token.Email != "alice@example.com" {
+			t.Errorf("consumed token %+v, want alice's", token)
+		}
+
+		if _, err := db.ConsumeUserToken("valid", models.ResetPasswordPurpose); !storage.IsNotFound(err) {
+			t.Errorf("consuming a used token returned %v, want not found", err)
+		}
+		if _, err := db.ConsumeUserToken("expired", models.ResetPasswordPurpose); !storage.IsNotFound(err) {
+			t.Errorf("consuming an expired token returned %v, want not found", err)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package syndication
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+const (
+	AtomContentType = "application/atom+xml"
+)
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	NS       string      `xml:"xmlns,attr"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   atomAuthor  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary,omitempty"`
+}
+
+// Atom renders the document as an Atom 1.0 feed. Atom requires an updated
+// time on every entry, so undated documents and entries use the current time.
+func Atom(doc *Document) ([]byte, error) {
+	now := time.Now().UTC()
+
+	feed := atomFeed{
+		NS:       atomNamespace,
+		ID:       atomID(doc.SelfURL),
+		Title:    doc.Title,
+		Subtitle: doc.Description,
+		Updated:  atomTime(doc.Updated, now),
+		Author:   atomAuthor{Name: doc.Author},
+		Links: []atomLink{
+			{Href: doc.SelfURL, Rel: "self", Type: AtomContentType},
+			{Href: doc.Link, Rel: "alternate"},
+		},
+		Entries: make([]atomEntry, 0, len(doc.Entries)),
+	}
+
+	for _, e := range doc.Entries {
+		entry := atomEntry{
+			ID:      e.ID,
+			Title:   e.Title,
+			Updated: atomTime(e.Published, now),
+			Summary: e.Summary,
+		}
+
+		if !e.Published.IsZero() {
+			entry.Published = entry.Updated
+		}
+
+		if e.Link != "" {
+			entry.Links = append(entry.Links, atomLink{Href: e.Link, Rel: "alternate"})
+		}
+
+		if e.Image != "" {
+			entry.Links = append(entry.Links, atomLink{Href: e.Image, Rel: "enclosure", Type: imageType(e.Image)})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
+
+func atomTime(t time.Time, fallback time.Time) string {
+	if t.IsZero() {
+		t = fallback
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// atomID is the self url without its query, so that the permanent id of a
+// private feed does not contain its token.
+func atomID(selfURL string) string {
+	if i := strings.Index(selfURL, "?"); i >= 0 {
+		return selfURL[:i]
+	}
+	return selfURL
+}
@@ -0,0 +1,94 @@
+package syndication_test
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/syndication"
+)
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name   `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Author  string     `xml:"author>name"`
+	Links   []atomLink `xml:"link"`
+	Entries []struct {
+		ID        string     `xml:"id"`
+		Title     string     `xml:"title"`
+		Updated   string     `xml:"updated"`
+		Published string     `xml:"published"`
+		Summary   string     `xml:"summary"`
+		Links     []atomLink `xml:"link"`
+	} `xml:"entry"`
+}
+
+func TestAtom(t *testing.T) {
+	out, err := syndication.Atom(document())
+	if err != nil {
+		t.Fatalf("could not render Atom: %v", err)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(out, &feed); err != nil {
+		t.Fatalf("could not parse Atom: %v\n%s", err, out)
+	}
+
+	if feed.ID != "https://rss.example.com/v1/feeds/7/feed" || feed.Title != "Posts" || feed.Author != "alice" {
+		t.Errorf("got feed %v titled %v by %v, want the feed url, Posts and alice", feed.ID, feed.Title, feed.Author)
+	}
+	if want := published.Format(time.RFC3339); feed.Updated != want {
+		t.Errorf("feed was updated %v, want the newest item's date %v", feed.Updated, want)
+	}
+	wantLinks := []atomLink{
+		{Href: "https://rss.example.com/v1/feeds/7/feed", Rel: "self", Type: syndication.AtomContentType},
+		{Href: "https://example.com/", Rel: "alternate"},
+	}
+	if len(feed.Links) != len(wantLinks) || feed.Links[0] != wantLinks[0] || feed.Links[1] != wantLinks[1] {
+		t.Errorf("feed links are %+v, want %+v", feed.Links, wantLinks)
+	}
+
+	if len(feed.Entries) != 3 {
+		t.Fatalf("got %v entries, want 3", len(feed.Entries))
+	}
+	third, second, first := feed.Entries[0], feed.Entries[1], feed.Entries[2]
+	if third.ID != "https://example.com/3" || third.Title != "Third" || third.Summary != "The third post" {
+		t.Errorf("first entry is %+v, want the third post", third)
+	}
+	if want := published.Format(time.RFC3339); third.Updated != want || third.Published != want {
+		t.Errorf("entry was updated %v and published %v, want %v", third.Updated, third.Published, want)
+	}
+	if len(second.Links) != 2 || second.Links[1] != (atomLink{Href: "https://example.com/2.png", Rel: "enclosure", Type: "image/png"}) {
+		t.Errorf("links of an entry with an image are %+v, want an enclosure", second.Links)
+	}
+
+	// Atom requires every entry to have been updated at some time
+	if first.Published != "" || first.Updated == "" {
+		t.Errorf("undated entry was updated %q and published %q, want updated now only", first.Updated, first.Published)
+	}
+}
+
+func TestAtomPrivateID(t *testing.T) {
+	doc := syndication.NewDocument(&models.Feed{Title: "Posts"}, nil, "https://rss.example.com/v1/feeds/7/atom.xml?token=secret")
+	out, err := syndication.Atom(doc)
+	if err != nil {
+		t.Fatalf("could not render Atom: %v", err)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(out, &feed); err != nil {
+		t.Fatalf("could not parse Atom: %v\n%s", err, out)
+	}
+	if feed.ID != "https://rss.example.com/v1/feeds/7/atom.xml" {
+		t.Errorf("id of a private feed is %v, want its url without the token", feed.ID)
+	}
+}
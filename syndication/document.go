@@ -0,0 +1,70 @@
+package syndication
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rss-creator/models"
+)
+
+// Document is the format independent view of a feed that every renderer is
+// built from, so that RSS, Atom and JSON Feed output always agree.
+type Document struct {
+	Title       string
+	Link        string
+	Description string
+	Author      string
+	SelfURL     string
+	Updated     time.Time
+	Entries     []Entry
+}
+
+type Entry struct {
+	// ID is stable for the lifetime of the item. Permalink reports whether it
+	// is also the address of the item.
+	ID        string
+	Permalink bool
+	Title     string
+	Link      string
+	Summary   string
+	Image     string
+	Published time.Time
+}
+
+// NewDocument builds a Document from a stored feed and its items, which are
+// expected to be ordered newest first.
+func NewDocument(feed *models.Feed, items []*models.Item, selfURL string) *Document {
+	doc := &Document{
+		Title:       feed.Title,
+		Link:        feed.SourceURL,
+		Description: feed.Description,
+		Author:      feed.Owner,
+		SelfURL:     selfURL,
+		Entries:     make([]Entry, 0, len(items)),
+	}
+
+	for _, i := range items {
+		entry := Entry{
+			ID:        i.GUID,
+			Permalink: i.GUID != "" && i.GUID == i.Link,
+			Title:     i.Title,
+			Link:      i.Link,
+			Summary:   i.Summary,
+			Image:     i.Image,
+			Published: i.Published,
+		}
+
+		// items stored before GUIDs were assigned fall back to their row id
+		if entry.ID == "" {
+			entry.ID = fmt.Sprintf("urn:rss-creator:feed:%v:item:%v", feed.ID, i.ID)
+		}
+
+		if entry.Published.After(doc.Updated) {
+			doc.Updated = entry.Published
+		}
+
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return doc
+}
@@ -0,0 +1,84 @@
+package syndication
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+type Format struct {
+	File        string
+	ContentType string
+	// Aliases are generic media types that clients commonly send when they
+	// will accept this format.
+	Aliases []string
+	Render  func(doc *Document) ([]byte, error)
+}
+
+// Formats lists every supported output format, the first being the default
+// when a client expresses no preference.
+var Formats = []Format{
+	{File: "rss.xml", ContentType: RSSContentType, Aliases: []string{"application/xml", "text/xml"}, Render: RSS},
+	{File: "atom.xml", ContentType: AtomContentType, Render: Atom},
+	{File: "feed.json", ContentType: JSONFeedContentType, Aliases: []string{"application/json"}, Render: JSONFeed},
+}
+
+// FormatForFile returns the format served under the given file name, such
+// as rss.xml.
+func FormatForFile(file string) (Format, bool) {
+	for _, f := range Formats {
+		if f.File == file {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Negotiate picks the format that best matches an Accept header, returning
+// false if the header rules out every supported format.
+func Negotiate(accept string) (Format, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return Formats[0], true
+	}
+
+	best, bestQ := Format{}, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		for _, f := range Formats {
+			if q > bestQ && f.matches(mediaType) {
+				best, bestQ = f, q
+			}
+		}
+	}
+
+	return best, bestQ > 0
+}
+
+func (f Format) matches(pattern string) bool {
+	switch {
+	case pattern == "*/*":
+		return true
+	case strings.HasSuffix(pattern, "/*"):
+		return strings.HasPrefix(f.ContentType, strings.TrimSuffix(pattern, "*"))
+	case pattern == f.ContentType:
+		return true
+	}
+
+	for _, alias := range f.Aliases {
+		if pattern == alias {
+			return true
+		}
+	}
+	return false
+}
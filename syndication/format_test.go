@@ -0,0 +1,51 @@
+package syndication_test
+
+import (
+	"testing"
+
+	"github.com/rss-creator/syndication"
+)
+
+func TestFormatForFile(t *testing.T) {
+	for file, want := range map[string]string{
+		"rss.xml":   syndication.RSSContentType,
+		"atom.xml":  syndication.AtomContentType,
+		"feed.json": syndication.JSONFeedContentType,
+	} {
+		if f, ok := syndication.FormatForFile(file); !ok || f.ContentType != want {
+			t.Errorf("format of %v is %v, want %v", file, f.ContentType, want)
+		}
+	}
+
+	if _, ok := syndication.FormatForFile("feed.html"); ok {
+		t.Errorf("feed.html has a format, want none")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                                syndication.RSSContentType,
+		"*/*":                             syndication.RSSContentType,
+		"application/atom+xml":            syndication.AtomContentType,
+		"application/feed+json":           syndication.JSONFeedContentType,
+		"application/json":                syndication.JSONFeedContentType,
+		"text/xml":                        syndication.RSSContentType,
+		"application/*":                   syndication.RSSContentType,
+		"text/html, application/atom+xml": syndication.AtomContentType,
+		"application/rss+xml;q=0.5, application/atom+xml;q=0.9": syndication.AtomContentType,
+		"application/atom+xml;q=0.1, */*;q=0.5":                 syndication.RSSContentType,
+		"application/feed+json, */*;q=0.1":                      syndication.JSONFeedContentType,
+		"garbage;;, application/atom+xml":                       syndication.AtomContentType,
+	} {
+		f, ok := syndication.Negotiate(accept)
+		if !ok || f.ContentType != want {
+			t.Errorf("negotiating %q picked %v, want %v", accept, f.ContentType, want)
+		}
+	}
+
+	for _, accept := range []string{"text/html", "image/*", "application/atom+xml;q=0", "*/*;q=0"} {
+		if f, ok := syndication.Negotiate(accept); ok {
+			t.Errorf("negotiating %q picked %v, want no format", accept, f.ContentType)
+		}
+	}
+}
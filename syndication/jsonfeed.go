@@ -0,0 +1,69 @@
+package syndication
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	JSONFeedContentType = "application/feed+json"
+
+	jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+)
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url,omitempty"`
+	Title         string `json:"title,omitempty"`
+	ContentText   string `json:"content_text"`
+	Image         string `json:"image,omitempty"`
+	DatePublished string `json:"date_published,omitempty"`
+}
+
+// JSONFeed renders the document as a JSON Feed 1.1 document.
+func JSONFeed(doc *Document) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       doc.Title,
+		HomePageURL: doc.Link,
+		FeedURL:     doc.SelfURL,
+		Description: doc.Description,
+		Items:       make([]jsonFeedItem, 0, len(doc.Entries)),
+	}
+
+	if doc.Author != "" {
+		feed.Authors = []jsonFeedAuthor{{Name: doc.Author}}
+	}
+
+	for _, e := range doc.Entries {
+		item := jsonFeedItem{
+			ID:          e.ID,
+			URL:         e.Link,
+			Title:       e.Title,
+			ContentText: e.Summary,
+			Image:       e.Image,
+		}
+
+		if !e.Published.IsZero() {
+			item.DatePublished = e.Published.UTC().Format(time.RFC3339)
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	return json.MarshalIndent(feed, "", "  ")
+}
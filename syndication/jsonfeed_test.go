@@ -0,0 +1,66 @@
+package syndication_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/syndication"
+)
+
+func TestJSONFeed(t *testing.T) {
+	out, err := syndication.JSONFeed(document())
+	if err != nil {
+		t.Fatalf("could not render JSON Feed: %v", err)
+	}
+
+	var feed struct {
+		Version     string `json:"version"`
+		Title       string `json:"title"`
+		HomePageURL string `json:"home_page_url"`
+		FeedURL     string `json:"feed_url"`
+		Authors     []struct {
+			Name string `json:"name"`
+		} `json:"authors"`
+		Items []struct {
+			ID            string  `json:"id"`
+			URL           string  `json:"url"`
+			Title         string  `json:"title"`
+			ContentText   *string `json:"content_text"`
+			Image         string  `json:"image"`
+			DatePublished string  `json:"date_published"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &feed); err != nil {
+		t.Fatalf("could not parse JSON Feed: %v\n%s", err, out)
+	}
+
+	if feed.Version != "https://jsonfeed.org/version/1.1" || feed.Title != "Posts" {
+		t.Errorf("got version %v feed %v, want version 1.1 feed Posts", feed.Version, feed.Title)
+	}
+	if feed.HomePageURL != "https://example.com/" || feed.FeedURL != "https://rss.example.com/v1/feeds/7/feed" {
+		t.Errorf("feed is at %v with home page %v, want the feed url and source", feed.FeedURL, feed.HomePageURL)
+	}
+	if len(feed.Authors) != 1 || feed.Authors[0].Name != "alice" {
+		t.Errorf("feed authors are %+v, want alice", feed.Authors)
+	}
+
+	if len(feed.Items) != 3 {
+		t.Fatalf("got %v items, want 3", len(feed.Items))
+	}
+	third, second, first := feed.Items[0], feed.Items[1], feed.Items[2]
+	if third.ID != "https://example.com/3" || third.URL != "https://example.com/3" || third.Title != "Third" {
+		t.Errorf("first item is %+v, want the third post", third)
+	}
+	if want := published.Format(time.RFC3339); third.DatePublished != want {
+		t.Errorf("item was published %v, want %v", third.DatePublished, want)
+	}
+	if second.Image != "https://example.com/2.png" {
+		t.Errorf("image of the second item is %v, want the png", second.Image)
+	}
+
+	// JSON Feed requires content on every item, even when it is empty
+	if first.ContentText == nil || first.DatePublished != "" || first.ID != "urn:rss-creator:feed:7:item:1" {
+		t.Errorf("item stored without a GUID or date is %+v, want empty content, no date and a GUID from its id", first)
+	}
+}
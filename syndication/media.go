@@ -0,0 +1,19 @@
+package syndication
+
+import (
+	"mime"
+	"net/url"
+	"path"
+)
+
+// imageType guesses the MIME type of an image from its URL extension, falling
+// back to application/octet-stream when the extension is missing or unknown.
+func imageType(link string) string {
+	u, err := url.Parse(link)
+	if err == nil {
+		if t := mime.TypeByExtension(path.Ext(u.Path)); t != "" {
+			return t
+		}
+	}
+	return "application/octet-stream"
+}
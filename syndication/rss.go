@@ -0,0 +1,101 @@
+package syndication
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const (
+	RSSContentType = "application/rss+xml"
+
+	atomNamespace = "http://www.w3.org/2005/Atom"
+)
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	SelfLink      rssLink   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title,omitempty"`
+	Link        string        `xml:"link,omitempty"`
+	Description string        `xml:"description,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// RSS renders the document as RSS 2.0. The self link is advertised in the
+// channel since RSS validators expect it.
+func RSS(doc *Document) ([]byte, error) {
+	channel := rssChannel{
+		Title:       doc.Title,
+		Link:        doc.Link,
+		Description: doc.Description,
+		SelfLink:    rssLink{Href: doc.SelfURL, Rel: "self", Type: RSSContentType},
+		Items:       make([]rssItem, 0, len(doc.Entries)),
+	}
+
+	// RSS requires a channel description, so fall back to the title
+	if channel.Description == "" {
+		channel.Description = doc.Title
+	}
+
+	if !doc.Updated.IsZero() {
+		channel.LastBuildDate = doc.Updated.Format(time.RFC1123Z)
+	}
+
+	for _, e := range doc.Entries {
+		item := rssItem{
+			Title:       e.Title,
+			Link:        e.Link,
+			Description: e.Summary,
+			GUID:        rssGUID{IsPermaLink: e.Permalink, Value: e.ID},
+		}
+
+		if !e.Published.IsZero() {
+			item.PubDate = e.Published.Format(time.RFC1123Z)
+		}
+
+		if e.Image != "" {
+			item.Enclosure = &rssEnclosure{URL: e.Image, Type: imageType(e.Image)}
+		}
+
+		channel.Items = append(channel.Items, item)
+	}
+
+	out, err := xml.MarshalIndent(rss{Version: "2.0", AtomNS: atomNamespace, Channel: channel}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
@@ -0,0 +1,129 @@
+package syndication_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rss-creator/models"
+	"github.com/rss-creator/syndication"
+)
+
+var published = time.Date(2001, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// document is a feed with an item linked by its GUID, an item with an
+// image, and an undated item stored before GUIDs were assigned.
+func document() *syndication.Document {
+	feed := &models.Feed{ID: 7, Owner: "alice", Title: "Posts", SourceURL: "https://example.com/"}
+	items := []*models.Item{
+		{ID: 3, GUID: "https://example.com/3", Title: "Third", Link: "https://example.com/3", Summary: "The third post", Published: published},
+		{ID: 2, GUID: "post-2", Title: "Second", Link: "https://example.com/2", Image: "https://example.com/2.png", Published: published.Add(-time.Hour)},
+		{ID: 1, Title: "First", Link: "https://example.com/1"},
+	}
+	return syndication.NewDocument(feed, items, "https://rss.example.com/v1/feeds/7/feed")
+}
+
+func TestRSS(t *testing.T) {
+	out, err := syndication.RSS(document())
+	if err != nil {
+		t.Fatalf("could not render RSS: %v", err)
+	}
+	if !strings.HasPrefix(string(out), xml.Header) {
+		t.Errorf("RSS does not start with an XML declaration:\n%s", out)
+	}
+
+	var doc struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		Channel struct {
+			// the namespaced self link comes first, as an unqualified
+			// field would match it too
+			SelfLink struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"http://www.w3.org/2005/Atom link"`
+			Title         string `xml:"title"`
+			Link          string `xml:"link"`
+			Description   string `xml:"description"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title       string `xml:"title"`
+				Link        string `xml:"link"`
+				Description string `xml:"description"`
+				GUID        struct {
+					IsPermaLink bool   `xml:"isPermaLink,attr"`
+					Value       string `xml:",chardata"`
+				} `xml:"guid"`
+				PubDate   string `xml:"pubDate"`
+				Enclosure *struct {
+					URL  string `xml:"url,attr"`
+					Type string `xml:"type,attr"`
+				} `xml:"enclosure"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("could not parse RSS: %v\n%s", err, out)
+	}
+
+	c := doc.Channel
+	if doc.Version != "2.0" || c.Title != "Posts" || c.Link != "https://example.com/" {
+		t.Errorf("got RSS %v channel %v linking %v, want 2.0 channel Posts linking https://example.com/", doc.Version, c.Title, c.Link)
+	}
+	if c.Description != "Posts" {
+		t.Errorf("channel description is %q, want the title when the feed has none", c.Description)
+	}
+	if c.SelfLink.Href != "https://rss.example.com/v1/feeds/7/feed" || c.SelfLink.Rel != "self" {
+		t.Errorf("channel self link is %+v, want the feed url", c.SelfLink)
+	}
+	if want := published.Format(time.RFC1123Z); c.LastBuildDate != want {
+		t.Errorf("channel was last built %v, want the newest item's date %v", c.LastBuildDate, want)
+	}
+
+	if len(c.Items) != 3 {
+		t.Fatalf("got %v items, want 3", len(c.Items))
+	}
+	third, second, first := c.Items[0], c.Items[1], c.Items[2]
+	if third.Title != "Third" || third.Link != "https://example.com/3" || third.Description != "The third post" {
+		t.Errorf("first item is %+v, want the third post", third)
+	}
+	if !third.GUID.IsPermaLink || third.GUID.Value != "https://example.com/3" {
+		t.Errorf("GUID of an item linked by it is %+v, want a permalink", third.GUID)
+	}
+	if third.PubDate != published.Format(time.RFC1123Z) {
+		t.Errorf("item was published %v, want %v", third.PubDate, published.Format(time.RFC1123Z))
+	}
+	if second.GUID.IsPermaLink || second.GUID.Value != "post-2" {
+		t.Errorf("GUID of an item not linked by it is %+v, want no permalink", second.GUID)
+	}
+	if second.Enclosure == nil || second.Enclosure.URL != "https://example.com/2.png" || second.Enclosure.Type != "image/png" {
+		t.Errorf("enclosure of an item with an image is %+v, want the png", second.Enclosure)
+	}
+	if first.GUID.Value != "urn:rss-creator:feed:7:item:1" || first.PubDate != "" || first.Enclosure != nil {
+		t.Errorf("item stored without a GUID or date is %+v, want a GUID from its id and no date", first)
+	}
+}
+
+func TestRSSEscaping(t *testing.T) {
+	doc := syndication.NewDocument(&models.Feed{Title: "Fish & <Chips>"}, []*models.Item{{Title: "</title><script>"}}, "")
+	out, err := syndication.RSS(doc)
+	if err != nil {
+		t.Fatalf("could not render RSS: %v", err)
+	}
+
+	var parsed struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title string `xml:"title"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(out, &parsed); err != nil {
+		t.Fatalf("could not parse RSS: %v\n%s", err, out)
+	}
+	if parsed.Channel.Title != "Fish & <Chips>" || len(parsed.Channel.Items) != 1 || parsed.Channel.Items[0].Title != "</title><script>" {
+		t.Errorf("titles did not survive escaping:\n%s", out)
+	}
+}
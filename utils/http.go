@@ -38,17 +38,23 @@ func SendSuccess(w http.ResponseWriter, data interface{}, status int) {
 	}
 }
 
+// Writes an already serialised document, for responses such as feeds that do
+// not use the JSON envelope
+func SendRaw(w http.ResponseWriter, contentType string, body []byte, status int) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// SendPage sends one page of a listing. When more is set, nextLink repeats the
+// request with the offset and count of the next page.
 func SendPage(w http.ResponseWriter, r *http.Request, data interface{}, offset int, count int, more bool) {
 	nextLink := ""
 	if more {
-		query := r.URL.RawQuery
-		if query != "" {
-			query += "&"
-		} else {
-			query += "?"
-		}
-		query += fmt.Sprintf("offset=%v&count=%v", offset, count)
-		nextLink = fmt.Sprintf("https://%v%v%v", r.Host, r.RequestURI, query)
+		query := r.URL.Query()
+		query.Set("offset", strconv.Itoa(offset))
+		query.Set("count", strconv.Itoa(count))
+		nextLink = fmt.Sprintf("https://%v%v?%v", r.Host, r.URL.Path, query.Encode())
 	}
 
 	resp := httpResponse{NextLink: nextLink, Data: data}
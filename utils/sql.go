@@ -19,7 +19,8 @@ type SqlCondition struct {
 }
 
 // Takes an array of SQL conditions, and returns a SQL WHERE statement with
-// an array of arguments. Excludes SQL conditions where Arg is the zero value
+// an array of arguments. Excludes SQL conditions where Arg is the zero value,
+// and returns an empty statement when every condition is excluded
 func SqlWhere(conditions []SqlCondition) (string, []interface{}) {
 	formatted := []string{}
 	args := make([]interface{}, 0)
@@ -43,7 +44,7 @@ func SqlWhere(conditions []SqlCondition) (string, []interface{}) {
 			if a.IsZero() {
 				break
 			}
-			strVal = a.Format(TimeFormat)
+			strVal = a.UTC().Format(TimeFormat)
 		default:
 			log.Printf("type %T not supported by ConstructSqlWhere", a)
 		}
@@ -54,5 +55,9 @@ func SqlWhere(conditions []SqlCondition) (string, []interface{}) {
 		}
 	}
 
+	if len(formatted) == 0 {
+		return "", args
+	}
+
 	return fmt.Sprintf("WHERE %v", strings.Join(formatted, " AND ")), args
 }